@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"Yandex_Calc_V2.0/internal/app"
+	"Yandex_Calc_V2.0/internal/client"
+)
+
+// Exit codes. A calculation error is a failed or cancelled expression; the
+// request itself succeeded.
+const (
+	EXIT_OK          = 0
+	EXIT_ERROR       = 1
+	EXIT_USAGE       = 2
+	EXIT_CALCULATION = 3
+)
+
+const (
+	OUTPUT_TABLE = "table"
+	OUTPUT_JSON  = "json"
+	BAR_WIDTH    = 30
+)
+
+const usage = `Usage: calcctl <command> [flags] [args]
+
+Commands:
+  submit [expression...]  start calculations; expressions are read from stdin, one per line, without arguments or with -
+                          arguments after -- are expressions even when they start with -, as in submit -- -2+3
+  wait <id>...            wait for expressions to finish, showing a progress bar
+  get <id>...             show expressions
+  list                    list expressions
+  cancel <id>...          cancel expressions
+  agents                  show agents and tasks no live agent can run
+
+Flags of every command:
+  --url, --token, --user  server URL, bearer token and user (default from the config file, then CALCCTL_URL, CALCCTL_TOKEN, CALCCTL_USER)
+  --config                config file (default $CALCCTL_CONFIG or calcctl/config.json in the user config directory)
+  -o, --output            json or table (default table)
+
+Exit codes: 0 success, 1 request failed, 2 usage error, 3 calculation failed or cancelled.
+`
+
+// cli is one invocation of calcctl.
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	getenv         func(string) string
+	terminal       bool
+
+	client *client.Client
+	output string
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	c := &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr, getenv: os.Getenv, terminal: isTerminal(os.Stderr)}
+	os.Exit(c.run(ctx, os.Args[1:]))
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// commandFlags is the flag set of a command with the flags every command
+// has.
+type commandFlags struct {
+	*flag.FlagSet
+	url, token, user, config, output *string
+}
+
+func (c *cli) flags(name string) *commandFlags {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	f := &commandFlags{
+		FlagSet: fs,
+		url:     fs.String("url", "", "server URL"),
+		token:   fs.String("token", "", "bearer token"),
+		user:    fs.String("user", "", "user sent in X-User-ID"),
+		config:  fs.String("config", "", "config file"),
+	}
+	f.output = fs.String("output", OUTPUT_TABLE, "json or table")
+	fs.StringVar(f.output, "o", OUTPUT_TABLE, "json or table")
+	return f
+}
+
+// parse parses the flags, which may follow the positional arguments, and
+// sets up the client. Everything after -- is positional, so expressions may
+// start with a minus.
+func (c *cli) parse(f *commandFlags, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := f.Parse(args); errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		} else if err != nil {
+			return nil, errFlags
+		}
+		rest := f.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	if *f.output != OUTPUT_TABLE && *f.output != OUTPUT_JSON {
+		return nil, fmt.Errorf("invalid output %q", *f.output)
+	}
+	path := *f.config
+	if path == "" {
+		path = client.ConfigPath(c.getenv)
+	}
+	config, err := client.LoadConfig(path, c.getenv)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errConfig, err)
+	}
+	for _, flagged := range []struct{ value, field *string }{{f.url, &config.URL}, {f.token, &config.Token}, {f.user, &config.User}} {
+		if *flagged.value != "" {
+			*flagged.field = *flagged.value
+		}
+	}
+	c.client = client.NewFromConfig(config)
+	c.output = *f.output
+	return positional, nil
+}
+
+func (c *cli) run(ctx context.Context, args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(c.stderr, usage)
+		if len(args) == 0 {
+			return EXIT_USAGE
+		}
+		return EXIT_OK
+	}
+	commands := map[string]func(context.Context, []string) (int, error){
+		"submit": c.submit,
+		"wait":   c.wait,
+		"get":    c.get,
+		"list":   c.list,
+		"cancel": c.cancel,
+		"agents": c.agents,
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(c.stderr, "calcctl: unknown command %q\n\n%s", args[0], usage)
+		return EXIT_USAGE
+	}
+	code, err := command(ctx, args[1:])
+	if err != nil {
+		fmt.Fprintf(c.stderr, "calcctl %s: %v\n", args[0], err)
+	}
+	return code
+}
+
+var (
+	// errFlags is returned for flags the flag set has already reported.
+	errFlags  = errors.New("invalid flags")
+	errConfig = errors.New("config")
+)
+
+// parseError maps an error of parse or of the arguments to the exit code.
+func parseError(err error) (int, error) {
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return EXIT_OK, nil
+	case errors.Is(err, errFlags):
+		return EXIT_USAGE, nil
+	case errors.Is(err, errConfig):
+		return EXIT_ERROR, err
+	}
+	return EXIT_USAGE, err
+}
+
+func requestError(err error) (int, error) {
+	return EXIT_ERROR, err
+}
+
+// exitCode is EXIT_CALCULATION if any of the expressions failed or was
+// cancelled.
+func exitCode(exprs []*app.Expression) int {
+	for _, expr := range exprs {
+		if expr.Status == "failed" || expr.Status == "cancelled" {
+			return EXIT_CALCULATION
+		}
+	}
+	return EXIT_OK
+}
+
+func (c *cli) submit(ctx context.Context, args []string) (int, error) {
+	f := c.flags("submit")
+	strict := f.Bool("strict-order", false, "keep the order of operations")
+	natural := f.Bool("natural", false, "natural notation: implicit multiplication and 5!")
+	wait := f.Bool("wait", false, "wait for the results")
+	interval := f.Duration("interval", client.DEFAULT_POLL_INTERVAL, "poll interval with --wait")
+	timeout := f.Duration("timeout", 0, "give up waiting after this long")
+	noProgress := f.Bool("no-progress", false, "hide the progress bar with --wait")
+	expressions, err := c.parse(f, args)
+	if err != nil {
+		return parseError(err)
+	}
+	if len(expressions) == 0 || (len(expressions) == 1 && expressions[0] == "-") {
+		expressions = nil
+		scanner := bufio.NewScanner(c.stdin)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				expressions = append(expressions, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return requestError(err)
+		}
+		if len(expressions) == 0 {
+			return parseError(errors.New("no expressions"))
+		}
+	}
+	ids := make([]string, 0, len(expressions))
+	for _, expression := range expressions {
+		id, err := c.client.Submit(ctx, app.ExpressionRequest{Expression: expression, StrictOrder: *strict, NaturalNotation: *natural})
+		if err != nil {
+			return requestError(fmt.Errorf("%s: %w", expression, err))
+		}
+		ids = append(ids, id)
+	}
+	if *wait {
+		return c.waitAll(ctx, ids, *interval, *timeout, !*noProgress)
+	}
+	if c.output == OUTPUT_JSON {
+		submitted := make([]app.ExpressionsResponse, len(ids))
+		for i, id := range ids {
+			submitted[i] = app.ExpressionsResponse{ID: id, Expression: expressions[i], Status: "pending"}
+		}
+		return EXIT_OK, c.printJSON(submitted)
+	}
+	w := c.table("ID", "EXPRESSION")
+	for i, id := range ids {
+		fmt.Fprintf(w, "%s\t%s\n", id, expressions[i])
+	}
+	return EXIT_OK, w.Flush()
+}
+
+func (c *cli) wait(ctx context.Context, args []string) (int, error) {
+	f := c.flags("wait")
+	interval := f.Duration("interval", client.DEFAULT_POLL_INTERVAL, "poll interval")
+	timeout := f.Duration("timeout", 0, "give up after this long")
+	noProgress := f.Bool("no-progress", false, "hide the progress bar")
+	ids, err := c.parse(f, args)
+	if err != nil {
+		return parseError(err)
+	}
+	if len(ids) == 0 {
+		return parseError(errors.New("no expression IDs"))
+	}
+	return c.waitAll(ctx, ids, *interval, *timeout, !*noProgress)
+}
+
+func (c *cli) waitAll(ctx context.Context, ids []string, interval, timeout time.Duration, progress bool) (int, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	exprs := make([]*app.Expression, 0, len(ids))
+	for _, id := range ids {
+		var bar func(*app.Expression)
+		if progress && c.terminal {
+			bar = c.progressBar(id, time.Now())
+		}
+		expr, err := c.client.Wait(ctx, id, interval, bar)
+		if bar != nil {
+			fmt.Fprintln(c.stderr)
+		}
+		if err != nil {
+			return requestError(fmt.Errorf("%s: %w", id, err))
+		}
+		exprs = append(exprs, expr)
+	}
+	return exitCode(exprs), c.printExpressions(exprs)
+}
+
+// progressBar draws the progress of an expression on stderr. The server
+// reports no progress of a single expression, so it is estimated from the
+// elapsed time and the estimated time of the critical path.
+func (c *cli) progressBar(id string, start time.Time) func(*app.Expression) {
+	return func(expr *app.Expression) {
+		fraction := 0.0
+		switch {
+		case client.Finished(expr):
+			fraction = 1
+		case expr.CriticalPath != nil && expr.CriticalPath.EstimatedMs > 0:
+			estimate := time.Duration(expr.CriticalPath.EstimatedMs) * time.Millisecond
+			fraction = min(float64(time.Since(start))/float64(estimate), 0.99)
+		}
+		done := int(fraction * BAR_WIDTH)
+		fmt.Fprintf(c.stderr, "\r%s [%s%s] %3.0f%% %s", id, strings.Repeat("#", done), strings.Repeat(".", BAR_WIDTH-done), 100*fraction, expr.Status)
+	}
+}
+
+func (c *cli) get(ctx context.Context, args []string) (int, error) {
+	f := c.flags("get")
+	ids, err := c.parse(f, args)
+	if err != nil {
+		return parseError(err)
+	}
+	if len(ids) == 0 {
+		return parseError(errors.New("no expression IDs"))
+	}
+	exprs := make([]*app.Expression, 0, len(ids))
+	for _, id := range ids {
+		expr, err := c.client.Get(ctx, id)
+		if err != nil {
+			return requestError(fmt.Errorf("%s: %w", id, err))
+		}
+		exprs = append(exprs, expr)
+	}
+	return exitCode(exprs), c.printExpressions(exprs)
+}
+
+func (c *cli) list(ctx context.Context, args []string) (int, error) {
+	f := c.flags("list")
+	var options client.ListOptions
+	f.StringVar(&options.Status, "status", "", "comma-separated statuses")
+	f.StringVar(&options.Contains, "q", "", "expression substring")
+	f.StringVar(&options.CreatedFrom, "from", "", "RFC3339 lower bound of created_at")
+	f.StringVar(&options.CreatedTo, "to", "", "RFC3339 upper bound of created_at")
+	f.StringVar(&options.Sort, "sort", "", "id, created_at or completed_at")
+	f.StringVar(&options.Order, "order", "", "asc or desc")
+	f.IntVar(&options.Limit, "limit", 0, "page size")
+	f.StringVar(&options.Cursor, "cursor", "", "cursor of the page")
+	all := f.Bool("all", false, "follow the cursors to the last page")
+	if _, err := c.parse(f, args); err != nil {
+		return parseError(err)
+	}
+	page, err := c.client.List(ctx, options)
+	for err == nil && *all && page.NextCursor != "" {
+		options.Cursor = page.NextCursor
+		var next *client.Page
+		if next, err = c.client.List(ctx, options); err == nil {
+			page.Expressions = append(page.Expressions, next.Expressions...)
+			page.NextCursor = next.NextCursor
+		}
+	}
+	if err != nil {
+		return requestError(err)
+	}
+	if c.output == OUTPUT_JSON {
+		return EXIT_OK, c.printJSON(page)
+	}
+	if err := c.printExpressions(page.Expressions); err != nil {
+		return requestError(err)
+	}
+	if page.NextCursor != "" {
+		fmt.Fprintf(c.stderr, "%d of %d, next page: --cursor %s\n", len(page.Expressions), page.Total, page.NextCursor)
+	}
+	return EXIT_OK, nil
+}
+
+func (c *cli) cancel(ctx context.Context, args []string) (int, error) {
+	f := c.flags("cancel")
+	purge := f.Bool("purge", false, "also remove the expressions from the store")
+	ids, err := c.parse(f, args)
+	if err != nil {
+		return parseError(err)
+	}
+	if len(ids) == 0 {
+		return parseError(errors.New("no expression IDs"))
+	}
+	status := "cancelled"
+	if *purge {
+		status = "purged"
+	}
+	results := make([]app.ExpressionsResponse, 0, len(ids))
+	for _, id := range ids {
+		if err := c.client.Cancel(ctx, id, *purge); err != nil {
+			return requestError(fmt.Errorf("%s: %w", id, err))
+		}
+		results = append(results, app.ExpressionsResponse{ID: id, Status: status})
+	}
+	if c.output == OUTPUT_JSON {
+		return EXIT_OK, c.printJSON(results)
+	}
+	w := c.table("ID", "STATUS")
+	for _, result := range results {
+		fmt.Fprintf(w, "%s\t%s\n", result.ID, result.Status)
+	}
+	return EXIT_OK, w.Flush()
+}
+
+func (c *cli) agents(ctx context.Context, args []string) (int, error) {
+	f := c.flags("agents")
+	if _, err := c.parse(f, args); err != nil {
+		return parseError(err)
+	}
+	resp, err := c.client.Agents(ctx)
+	if err != nil {
+		return requestError(err)
+	}
+	if c.output == OUTPUT_JSON {
+		return EXIT_OK, c.printJSON(resp)
+	}
+	w := c.table("AGENT", "LIVE", "TASKS", "LAST SEEN", "CAPABILITIES")
+	for _, agent := range resp.Agents {
+		fmt.Fprintf(w, "%s\t%t\t%d\t%s\t%s\n", agent.ID, agent.Live, agent.TasksTaken, agent.LastSeen.Format(time.RFC3339), strings.Join(agent.Capabilities, ","))
+	}
+	if err := w.Flush(); err != nil {
+		return requestError(err)
+	}
+	if len(resp.Unroutable) > 0 {
+		fmt.Fprintln(c.stdout)
+		w = c.table("UNROUTABLE TASK", "OPERATION", "EXPRESSIONS")
+		for _, task := range resp.Unroutable {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", task.ID, task.Operation, strings.Join(task.Expressions, ","))
+		}
+		return EXIT_OK, w.Flush()
+	}
+	return EXIT_OK, nil
+}
+
+func (c *cli) table(columns ...string) *tabwriter.Writer {
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+	return w
+}
+
+func (c *cli) printJSON(v any) error {
+	encoder := json.NewEncoder(c.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func (c *cli) printExpressions(exprs []*app.Expression) error {
+	if c.output == OUTPUT_JSON {
+		return c.printJSON(exprs)
+	}
+	w := c.table("ID", "STATUS", "RESULT", "EXPRESSION")
+	for _, expr := range exprs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", expr.ID, expr.Status, formatResult(expr), expr.Expr)
+	}
+	return w.Flush()
+}
+
+// formatResult renders the result of any kind, or the error of a failed
+// expression.
+func formatResult(expr *app.Expression) string {
+	var result string
+	switch {
+	case expr.Error != "":
+		return expr.Error
+	case expr.Result != nil:
+		result = strconv.FormatFloat(*expr.Result, 'g', -1, 64)
+	case expr.SpecialResult != "":
+		result = expr.SpecialResult
+	case expr.ComplexResult != nil:
+		result = strconv.FormatComplex(complex(expr.ComplexResult.Re, expr.ComplexResult.Im), 'g', -1, 128)
+	case expr.MatrixResult != nil:
+		encoded, _ := json.Marshal(expr.MatrixResult)
+		result = string(encoded)
+	default:
+		return "-"
+	}
+	if expr.Unit != "" {
+		result += " " + expr.Unit
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"Yandex_Calc_V2.0/internal/app"
+	"Yandex_Calc_V2.0/internal/client"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.ReleaseMode)
+}
+
+func newCLI(t *testing.T, url, stdin string) (*cli, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+	env := map[string]string{
+		client.ENV_CONFIG: filepath.Join(t.TempDir(), "config.json"),
+		client.ENV_URL:    url,
+	}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	return &cli{
+		stdin:  strings.NewReader(stdin),
+		stdout: stdout,
+		stderr: stderr,
+		getenv: func(name string) string { return env[name] },
+	}, stdout, stderr
+}
+
+func TestRun(t *testing.T) {
+	server := httptest.NewServer(app.NewOrchestrator().Router())
+	defer server.Close()
+
+	tests := []struct {
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+	}{
+		{nil, "", EXIT_USAGE, ""},
+		{[]string{"help"}, "", EXIT_OK, ""},
+		{[]string{"unknown"}, "", EXIT_USAGE, ""},
+		{[]string{"get"}, "", EXIT_USAGE, ""},
+		{[]string{"list", "--output", "xml"}, "", EXIT_USAGE, ""},
+		{[]string{"list", "--bogus"}, "", EXIT_USAGE, ""},
+		{[]string{"submit", "5", "--wait", "--interval", "10ms"}, "", EXIT_OK, "completed  5"},
+		{[]string{"submit", "-"}, "2+3\n\n2*3\n", EXIT_OK, "2*3"},
+		{[]string{"submit", "2+"}, "", EXIT_ERROR, ""},
+		{[]string{"get", "1"}, "", EXIT_OK, "completed"},
+		{[]string{"get", "404"}, "", EXIT_ERROR, ""},
+		{[]string{"cancel", "2"}, "", EXIT_OK, "cancelled"},
+		{[]string{"get", "2"}, "", EXIT_CALCULATION, "cancelled"},
+		{[]string{"wait", "--timeout", "30ms", "--interval", "10ms", "3"}, "", EXIT_ERROR, ""},
+		{[]string{"list", "--status", "pending"}, "", EXIT_OK, "2*3"},
+		{[]string{"agents"}, "", EXIT_OK, "AGENT"},
+		{[]string{"submit", "--", "-2+3", "-1+1"}, "", EXIT_OK, "-1+1"},
+		{[]string{"submit", "-o", "json", "1+1", "--", "-o"}, "", EXIT_ERROR, ""},
+	}
+	for _, test := range tests {
+		c, stdout, stderr := newCLI(t, server.URL, test.stdin)
+		code := c.run(context.Background(), test.args)
+		if code != test.code {
+			t.Errorf("run(%q) = %d, want %d; stderr: %s", test.args, code, test.code, stderr)
+		}
+		if !strings.Contains(stdout.String(), test.stdout) {
+			t.Errorf("run(%q) printed %q, want %q", test.args, stdout, test.stdout)
+		}
+	}
+}
+
+func TestRun_JSONOutput(t *testing.T) {
+	server := httptest.NewServer(app.NewOrchestrator().Router())
+	defer server.Close()
+
+	c, stdout, stderr := newCLI(t, "http://127.0.0.1:1", "")
+	if code := c.run(context.Background(), []string{"submit", "-o", "json", "--url", server.URL, "--wait", "7"}); code != EXIT_OK {
+		t.Fatalf("Expected success, got %d: %s", code, stderr)
+	}
+	var exprs []*app.Expression
+	if err := json.Unmarshal(stdout.Bytes(), &exprs); err != nil {
+		t.Fatal(err)
+	}
+	if len(exprs) != 1 || exprs[0].Status != "completed" || exprs[0].Result == nil || *exprs[0].Result != 7 {
+		t.Errorf("Unexpected output %s", stdout)
+	}
+}
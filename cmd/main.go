@@ -26,6 +26,18 @@ import (
 func main() {
 	orchestrator := app.NewOrchestrator()
 
+	if path := os.Getenv("IDEMPOTENCY_FILE"); path != "" {
+		store, err := app.NewFileIdempotencyStore(path)
+		if err != nil {
+			log.Fatalf("Failed to open idempotency store: %v", err)
+		}
+		orchestrator.SetIdempotencyStore(store)
+	}
+
+	if os.Getenv("REDUCTION_TASKS") == "true" {
+		orchestrator.Config.ReductionTasks = true
+	}
+
 	go func() {
 		if err := orchestrator.StartServer(); err != nil {
 			log.Fatalf("Failed to start orchestrator: %v", err)
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StatsResponse swagger model
+// @Description Состояние хранилища и потребление памяти
+type StatsResponse struct {
+	Expressions ExpressionStats `json:"expressions"`
+	Tasks       TaskStats       `json:"tasks"`
+	Memory      MemoryStats     `json:"memory"`
+	Retention   RetentionStats  `json:"retention"`
+}
+
+type ExpressionStats struct {
+	Total    int            `json:"total" example:"42"`
+	ByStatus map[string]int `json:"by_status"`
+	ByUser   map[string]int `json:"by_user"`
+}
+
+type TaskStats struct {
+	Queued        int   `json:"queued" example:"3"`
+	InFlight      int   `json:"in_flight" example:"1"`
+	CachedResults int   `json:"cached_results" example:"128"`
+	CacheHits     int64 `json:"cache_hits" example:"40"`
+	Deduplicated  int64 `json:"deduplicated" example:"12"`
+	Unroutable    int   `json:"unroutable" example:"0"`
+	LiveAgents    int   `json:"live_agents" example:"2"`
+}
+
+type MemoryStats struct {
+	AllocBytes     uint64 `json:"alloc_bytes"`
+	HeapInuseBytes uint64 `json:"heap_inuse_bytes"`
+	SysBytes       uint64 `json:"sys_bytes"`
+	NumGC          uint32 `json:"num_gc"`
+	Goroutines     int    `json:"goroutines"`
+}
+
+type RetentionStats struct {
+	MaxAge     string       `json:"max_age" example:"24h0m0s"`
+	MaxPerUser int          `json:"max_per_user" example:"1000"`
+	KeepFailed bool         `json:"keep_failed" example:"true"`
+	Janitor    JanitorStats `json:"janitor"`
+}
+
+// @Summary Storage and memory usage
+// @Description Expression store size, task queue depth, process memory and retention janitor state
+// @Tags admin
+// @Produce json
+// @Success 200 {object} StatsResponse
+// @Router /admin/stats [get]
+func (o *Orchestrator) handleStatsRequest(c *gin.Context) {
+	if c.Request.Method != http.MethodGet {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
+		return
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	now := time.Now()
+	o.mutex.Lock()
+	stats := StatsResponse{
+		Expressions: ExpressionStats{
+			Total:    len(o.expressionStore),
+			ByStatus: make(map[string]int),
+			ByUser:   make(map[string]int),
+		},
+		Tasks: TaskStats{
+			Queued:        o.taskQueue.Len(),
+			InFlight:      len(o.taskStorage) - o.taskQueue.Len(),
+			CachedResults: o.resultCache.Len(),
+			CacheHits:     o.sharingStats.CacheHits,
+			Deduplicated:  o.sharingStats.Deduplicated,
+			Unroutable:    len(o.unroutableTasks(now)),
+			LiveAgents:    len(o.liveAgents(now)),
+		},
+		Retention: RetentionStats{
+			MaxAge:     o.Config.Retention.MaxAge.String(),
+			MaxPerUser: o.Config.Retention.MaxPerUser,
+			KeepFailed: o.Config.Retention.KeepFailed,
+			Janitor:    o.janitorStats,
+		},
+	}
+	for _, expr := range o.expressionStore {
+		expr.syncStatus()
+		stats.Expressions.ByStatus[expr.Status]++
+		stats.Expressions.ByUser[expr.Owner]++
+	}
+	o.mutex.Unlock()
+
+	stats.Memory = MemoryStats{
+		AllocBytes:     mem.Alloc,
+		HeapInuseBytes: mem.HeapInuse,
+		SysBytes:       mem.Sys,
+		NumGC:          mem.NumGC,
+		Goroutines:     runtime.NumGoroutine(),
+	}
+	c.JSON(http.StatusOK, stats)
+}
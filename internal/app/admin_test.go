@@ -0,0 +1,60 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandleStatsRequest(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.GET("/admin/stats", orchestrator.handleStatsRequest)
+
+	orchestrator.mutex.Lock()
+	orchestrator.expressionStore["1"] = &Expression{ID: "1", Status: "pending", Owner: "alice", AST: &ASTNode{IsLeaf: true, Value: 3}}
+	orchestrator.expressionStore["2"] = &Expression{ID: "2", Status: "failed", Owner: "bob"}
+	task := &Task{ID: "1", ExprID: "3", Operation: "+"}
+	orchestrator.taskStorage["1"] = task
+	orchestrator.taskStorage["2"] = &Task{ID: "2", ExprID: "3", Operation: "*"}
+	orchestrator.taskQueue.PushBack(task)
+	orchestrator.mutex.Unlock()
+
+	req, err := http.NewRequest("GET", "/admin/stats", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", recorder.Code)
+	}
+
+	var stats StatsResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if stats.Expressions.Total != 2 {
+		t.Errorf("Expected 2 expressions, got %d", stats.Expressions.Total)
+	}
+	if stats.Expressions.ByStatus["completed"] != 1 || stats.Expressions.ByStatus["failed"] != 1 {
+		t.Errorf("Unexpected status breakdown: %v", stats.Expressions.ByStatus)
+	}
+	if stats.Expressions.ByUser["alice"] != 1 || stats.Expressions.ByUser["bob"] != 1 {
+		t.Errorf("Unexpected user breakdown: %v", stats.Expressions.ByUser)
+	}
+	if stats.Tasks.Queued != 1 || stats.Tasks.InFlight != 1 {
+		t.Errorf("Unexpected task stats: %+v", stats.Tasks)
+	}
+	if stats.Memory.AllocBytes == 0 || stats.Memory.Goroutines == 0 {
+		t.Errorf("Expected memory stats to be filled, got %+v", stats.Memory)
+	}
+	if stats.Retention.MaxAge != RETENTION_MAX_AGE.String() {
+		t.Errorf("Expected max age %s, got %s", RETENTION_MAX_AGE, stats.Retention.MaxAge)
+	}
+}
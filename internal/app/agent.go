@@ -1,6 +1,8 @@
 package app
 
 import (
+	"Yandex_Calc_V2.0/internal/matrix"
+	"Yandex_Calc_V2.0/internal/ops"
 	"bytes"
 	"encoding/json"
 	"errors"
@@ -8,6 +10,8 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 )
 
@@ -21,11 +25,14 @@ const (
 // @Description Информация о задаче
 type TaskResponse struct {
 	Task struct {
-		ID            string  `json:"id" example:"1"`
-		Arg1          float64 `json:"arg1" example:"2.0"`
-		Arg2          float64 `json:"arg2" example:"3.0"`
-		Operation     string  `json:"operation" example:"+"`
-		OperationTime int     `json:"operation_time" example:"200"`
+		ID            string           `json:"id" example:"1"`
+		Arg1          float64          `json:"arg1" example:"2.0"`
+		Arg2          float64          `json:"arg2" example:"3.0"`
+		Args          []float64        `json:"args,omitempty"`
+		ComplexArgs   []ComplexValue   `json:"complex_args,omitempty"`
+		Matrices      []*matrix.Matrix `json:"matrices,omitempty"`
+		Operation     string           `json:"operation" example:"+"`
+		OperationTime int              `json:"operation_time" example:"200"`
 	} `json:"task"`
 }
 
@@ -34,20 +41,40 @@ type TaskResponse struct {
 type TaskResult struct {
 	ID     string  `json:"id" example:"1"`
 	Result float64 `json:"result" example:"5.0"`
+	Imag   float64 `json:"imag,omitempty" example:"0"`
+	// Special is a result that is not finite: inf, -inf or nan.
+	Special string         `json:"special,omitempty" example:"inf"`
+	Matrix  *matrix.Matrix `json:"matrix,omitempty"`
+	Error   string         `json:"error,omitempty" example:"division by zero is not allowed"`
 }
 
 type Agent struct {
 	ComputingPower  int
 	OrchestratorURL string
+	// ID identifies the agent in the orchestrator's agent list.
+	ID string
+	// Capabilities are sent with every task request so that the orchestrator
+	// only hands out operations this agent understands.
+	Capabilities []string
 }
 
 func SetDefaultAgent() *Agent {
 	return &Agent{
 		ComputingPower:  COMPUTING_POWER,
 		OrchestratorURL: ORCHESTRATOR_URL,
+		Capabilities:    append(ops.Default.Extensions(), COMPLEX_CAPABILITY, MATRIX_CAPABILITY),
+		ID:              defaultAgentID(),
 	}
 }
 
+func defaultAgentID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "agent"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
 func NewAgent() *Agent {
 	return SetDefaultAgent()
 }
@@ -60,27 +87,78 @@ func (a *Agent) Run() {
 	select {}
 }
 
-func (a *Agent) Calculate(op string, x, y float64) (float64, error) {
-	switch op {
-	case "+":
-		return x + y, nil
-	case "-":
-		return x - y, nil
-	case "*":
-		return x * y, nil
-	case "/":
-		if y == 0 {
-			return 0, errors.New("division by zero is not allowed")
-		}
-		return x / y, nil
-	default:
-		return 0, errors.New(fmt.Sprintf("invalid operator: %s", op))
+// Calculate applies an operation of the registry: a binary operator to two
+// arguments, a built-in function to one, or a reduction (sum, prod) to any
+// number of them.
+func (a *Agent) Calculate(op string, args ...float64) (float64, error) {
+	return ops.Apply(op, args...)
+}
+
+// CalculateComplex applies an operation of the registry to complex operands.
+func (a *Agent) CalculateComplex(op string, args ...complex128) (complex128, error) {
+	return ops.ApplyComplex(op, args...)
+}
+
+// CalculateMatrix applies an operation of the registry to matrix operands;
+// numbers are passed as 1x1 matrices.
+func (a *Agent) CalculateMatrix(op string, args ...*matrix.Matrix) (*matrix.Matrix, error) {
+	return ops.ApplyMatrix(op, args...)
+}
+
+func (a *Agent) supportsComplex() bool {
+	for _, capability := range a.Capabilities {
+		if capability == COMPLEX_CAPABILITY {
+			return true
+		}
+	}
+	return false
+}
+
+// compute runs the task. Complex operands are computed in complex
+// arithmetic; so is a real task without a real result, like sqrt(-1), if the
+// agent supports complex numbers.
+func (a *Agent) compute(operation string, args []float64, complexArgs []ComplexValue) (complex128, error) {
+	if len(complexArgs) == 0 {
+		result, err := a.Calculate(operation, args...)
+		if err == nil || !errors.Is(err, ops.ErrUndefined) || !a.supportsComplex() {
+			return complex(result, 0), err
+		}
+		complexArgs = make([]ComplexValue, len(args))
+		for i, arg := range args {
+			complexArgs[i] = ComplexValue{Re: arg}
+		}
 	}
+	operands := make([]complex128, len(complexArgs))
+	for i, arg := range complexArgs {
+		operands[i] = arg.complex()
+	}
+	return a.CalculateComplex(operation, operands...)
+}
+
+// setMatrix stores a matrix result; 1x1 results are sent as numbers.
+func (r *TaskResult) setMatrix(m *matrix.Matrix) {
+	if m.IsScalar() {
+		r.Result = m.Data[0]
+		return
+	}
+	r.Matrix = m
 }
 
 func (a *Agent) worker(id int) {
 	for {
-		resp, err := http.Get(a.OrchestratorURL + "/internal/task")
+		req, err := http.NewRequest(http.MethodGet, a.OrchestratorURL+"/internal/task", nil)
+		if err != nil {
+			log.Printf("Worker %d: error creating task request: %v", id, err)
+			time.Sleep(2 * time.Second)
+			continue
+		}
+		if len(a.Capabilities) > 0 {
+			req.Header.Set(AGENT_CAPABILITIES_HEADER, strings.Join(a.Capabilities, ","))
+		}
+		if a.ID != "" {
+			req.Header.Set(AGENT_ID_HEADER, a.ID)
+		}
+		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			log.Printf("Worker %d: error getting task: %v", id, err)
 			time.Sleep(2 * time.Second)
@@ -120,16 +198,41 @@ func (a *Agent) worker(id int) {
 			log.Printf("Worker %d: error closing task body: %v", id, err)
 		}
 		task := taskResp.Task
-		log.Printf("Worker %d: received task %s: %f %s %f, simulating computation %d ms", id, task.ID, task.Arg1, task.Operation, task.Arg2, task.OperationTime)
+		args := []float64{task.Arg1, task.Arg2}
+		if len(task.Matrices) > 0 {
+			log.Printf("Worker %d: received task %s: %s of %d matrices, simulating computation %d ms", id, task.ID, task.Operation, len(task.Matrices), task.OperationTime)
+		} else if len(task.ComplexArgs) > 0 {
+			log.Printf("Worker %d: received task %s: %s of %v, simulating computation %d ms", id, task.ID, task.Operation, task.ComplexArgs, task.OperationTime)
+		} else if len(task.Args) > 0 {
+			args = task.Args
+			log.Printf("Worker %d: received task %s: %s of %v, simulating computation %d ms", id, task.ID, task.Operation, task.Args, task.OperationTime)
+		} else {
+			log.Printf("Worker %d: received task %s: %f %s %f, simulating computation %d ms", id, task.ID, task.Arg1, task.Operation, task.Arg2, task.OperationTime)
+		}
 		time.Sleep(time.Duration(task.OperationTime) * time.Millisecond)
-		result, err := a.Calculate(task.Operation, task.Arg1, task.Arg2)
+		resultPayload := &TaskResult{ID: task.ID}
+		var result interface{}
+		if len(task.Matrices) > 0 {
+			var m *matrix.Matrix
+			m, err = a.CalculateMatrix(task.Operation, task.Matrices...)
+			if err == nil {
+				resultPayload.setMatrix(m)
+				result = m
+			}
+		} else {
+			var z complex128
+			z, err = a.compute(task.Operation, args, task.ComplexArgs)
+			resultPayload.Result, resultPayload.Imag = real(z), imag(z)
+			result = z
+			if err == nil && !isFinite(imag(z)) {
+				err = errNotFinite
+			} else if err == nil && !isFinite(real(z)) {
+				resultPayload.Result, resultPayload.Special = 0, formatNumber(real(z))
+			}
+		}
 		if err != nil {
 			log.Printf("Worker %d: error computing task %s: %v", id, task.ID, err)
-			continue
-		}
-		resultPayload := &TaskResult{
-			ID:     task.ID,
-			Result: result,
+			resultPayload.Error = err.Error()
 		}
 		payloadBytes, err := json.Marshal(resultPayload)
 		if err != nil {
@@ -149,7 +252,7 @@ func (a *Agent) worker(id int) {
 			}
 			log.Printf("Worker %d: error response posting result for task %s: %s", id, task.ID, string(body))
 		} else {
-			log.Printf("Worker %d: successfully completed task %s with result %f", id, task.ID, result)
+			log.Printf("Worker %d: successfully completed task %s with result %v", id, task.ID, result)
 		}
 		err = respPost.Body.Close()
 		if err != nil {
@@ -31,7 +31,7 @@ func TestCalculate(t *testing.T) {
 		{"multiply", "*", 4, 3, 12, nil},
 		{"divide", "/", 10, 2, 5, nil},
 		{"divide by zero", "/", 10, 0, 0, errors.New("division by zero is not allowed")},
-		{"invalid operator", "^", 1, 2, 0, fmt.Errorf("invalid operator: ^")},
+		{"invalid operator", "%", 1, 2, 0, fmt.Errorf("invalid operator: %%")},
 		{"add negative numbers", "+", -1, -2, -3, nil},
 		{"subtract negative numbers", "-", -5, -3, -2, nil},
 		{"multiply negative numbers", "*", -4, -3, 12, nil},
@@ -130,6 +130,39 @@ func TestWorker_SuccessfulTask(t *testing.T) {
 
 }
 
+func TestWorker_ReportsCalculationError(t *testing.T) {
+	mock := &mockOrchestrator{
+		taskResponse: &TaskResponse{},
+		taskResult:   make(chan *TaskResult, 1),
+	}
+	mock.taskResponse.Task.ID = "task42"
+	mock.taskResponse.Task.Arg1 = 1
+	mock.taskResponse.Task.Arg2 = 0
+	mock.taskResponse.Task.Operation = "/"
+	mock.taskResponse.Task.OperationTime = 100
+
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	agent := NewAgent()
+	agent.OrchestratorURL = server.URL
+
+	go agent.worker(0)
+
+	select {
+	case result := <-mock.taskResult:
+		expectedResult := &TaskResult{
+			ID:    "task42",
+			Error: "division by zero is not allowed",
+		}
+		if !reflect.DeepEqual(result, expectedResult) {
+			t.Errorf("Unexpected result: %+v, expected %+v", result, expectedResult)
+		}
+	case <-time.After(4 * time.Duration(mock.taskResponse.Task.OperationTime) * time.Millisecond):
+		t.Errorf("Timeout waiting for task error")
+	}
+}
+
 func TestWorker_Handle404(t *testing.T) {
 	mock := &mockOrchestrator{
 		taskResponse: nil,
@@ -192,3 +225,16 @@ func TestWorker_HandleErrorStatusCode(t *testing.T) {
 	case <-time.After(2 * time.Duration(mock.taskResponse.Task.OperationTime) * time.Millisecond):
 	}
 }
+
+func TestAgent_CalculateFunction(t *testing.T) {
+	agent := NewAgent()
+	if result, err := agent.Calculate("sqrt", 16); err != nil || result != 4 {
+		t.Errorf("expected sqrt(16) = 4, got %v (%v)", result, err)
+	}
+	if _, err := agent.Calculate("sqrt", -1); err == nil {
+		t.Error("expected an error for sqrt(-1)")
+	}
+	if _, err := agent.Calculate("sqrt", 1, 2); err == nil {
+		t.Error("expected an error for sqrt with two arguments")
+	}
+}
@@ -0,0 +1,177 @@
+package app
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"Yandex_Calc_V2.0/internal/ops"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	AGENT_CAPABILITIES_HEADER = "X-Agent-Capabilities"
+	AGENT_ID_HEADER           = "X-Agent-ID"
+	// AGENT_TTL is how long an agent counts as live after its last task
+	// request. Agents poll every couple of seconds while idle.
+	AGENT_TTL = 30 * time.Second
+)
+
+// AgentInfo swagger model
+// @Description Агент, запрашивавший задачи
+type AgentInfo struct {
+	ID           string    `json:"id" example:"worker-host-42"`
+	Capabilities []string  `json:"capabilities"`
+	LastSeen     time.Time `json:"last_seen"`
+	TasksTaken   int64     `json:"tasks_taken" example:"12"`
+	Live         bool      `json:"live" example:"true"`
+}
+
+// UnroutableTask swagger model
+// @Description Задача, которую не может выполнить ни один живой агент
+type UnroutableTask struct {
+	ID          string   `json:"id" example:"7"`
+	Operation   string   `json:"operation" example:"sqrt"`
+	Expressions []string `json:"expressions"`
+}
+
+// AgentsResponse swagger model
+// @Description Агенты и задачи без подходящего агента
+type AgentsResponse struct {
+	Agents     []AgentInfo      `json:"agents"`
+	Unroutable []UnroutableTask `json:"unroutable"`
+}
+
+// AgentCapabilities lists the operations an agent supports on top of the
+// core operations of the registry that every agent understands.
+type AgentCapabilities map[string]bool
+
+func agentCapabilities(c *gin.Context) AgentCapabilities {
+	capabilities := make(AgentCapabilities)
+	for _, capability := range strings.Split(c.GetHeader(AGENT_CAPABILITIES_HEADER), ",") {
+		if capability = strings.TrimSpace(capability); capability != "" {
+			capabilities[capability] = true
+		}
+	}
+	return capabilities
+}
+
+func (c AgentCapabilities) canRun(task *Task) bool {
+	if len(task.ComplexArgs) > 0 && !c[COMPLEX_CAPABILITY] {
+		return false
+	}
+	if len(task.Matrices) > 0 && !c[MATRIX_CAPABILITY] {
+		return false
+	}
+	if op, ok := ops.Lookup(task.Operation); ok && op.Core {
+		return true
+	}
+	return c[task.Operation]
+}
+
+func (c AgentCapabilities) list() []string {
+	capabilities := make([]string, 0, len(c))
+	for capability := range c {
+		capabilities = append(capabilities, capability)
+	}
+	sort.Strings(capabilities)
+	return capabilities
+}
+
+func agentID(c *gin.Context) string {
+	if id := c.GetHeader(AGENT_ID_HEADER); id != "" {
+		return id
+	}
+	return c.ClientIP()
+}
+
+// touchAgent records a task request of the agent. The caller must hold
+// o.mutex.
+func (o *Orchestrator) touchAgent(id string, capabilities AgentCapabilities, now time.Time) *AgentInfo {
+	agent, ok := o.agents[id]
+	if !ok {
+		agent = &AgentInfo{ID: id}
+		o.agents[id] = agent
+	}
+	agent.Capabilities = capabilities.list()
+	agent.LastSeen = now
+	return agent
+}
+
+func (o *Orchestrator) liveAgents(now time.Time) []*AgentInfo {
+	live := make([]*AgentInfo, 0, len(o.agents))
+	for _, agent := range o.agents {
+		if now.Sub(agent.LastSeen) <= o.Config.AgentTTL {
+			live = append(live, agent)
+		}
+	}
+	return live
+}
+
+// forgetAgents drops agents that have not been seen for ten TTLs.
+func (o *Orchestrator) forgetAgents(now time.Time) {
+	for id, agent := range o.agents {
+		if now.Sub(agent.LastSeen) > 10*o.Config.AgentTTL {
+			delete(o.agents, id)
+		}
+	}
+}
+
+// unroutableTasks returns the queued tasks that none of the live agents
+// advertises a capability for, in queue order. The caller must hold o.mutex.
+func (o *Orchestrator) unroutableTasks(now time.Time) []UnroutableTask {
+	live := o.liveAgents(now)
+	capabilities := make([]AgentCapabilities, len(live))
+	for i, agent := range live {
+		capabilities[i] = make(AgentCapabilities)
+		for _, capability := range agent.Capabilities {
+			capabilities[i][capability] = true
+		}
+	}
+	unroutable := make([]UnroutableTask, 0)
+	o.taskQueue.Each(func(v interface{}) bool {
+		task, ok := v.(*Task)
+		if !ok {
+			return true
+		}
+		for _, agent := range capabilities {
+			if agent.canRun(task) {
+				return true
+			}
+		}
+		unroutable = append(unroutable, UnroutableTask{
+			ID:          task.ID,
+			Operation:   task.Operation,
+			Expressions: task.exprIDs(),
+		})
+		return true
+	})
+	return unroutable
+}
+
+// @Summary Agents and unroutable tasks
+// @Description Agents that requested tasks with their capabilities, and queued tasks that no live agent can run
+// @Tags admin
+// @Produce json
+// @Success 200 {object} AgentsResponse
+// @Router /admin/agents [get]
+func (o *Orchestrator) handleAgentsRequest(c *gin.Context) {
+	if c.Request.Method != http.MethodGet {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
+		return
+	}
+	now := time.Now()
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	agents := make([]AgentInfo, 0, len(o.agents))
+	for _, agent := range o.agents {
+		info := *agent
+		info.Live = now.Sub(agent.LastSeen) <= o.Config.AgentTTL
+		agents = append(agents, info)
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].ID < agents[j].ID
+	})
+	c.JSON(http.StatusOK, gin.H{"agents": agents, "unroutable": o.unroutableTasks(now)})
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetTask_RoutesByCapability(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.GET("/internal/task", orchestrator.handleGetTaskRequest)
+
+	submitExpression(t, orchestrator, "1", "sqrt(4)")
+	submitExpression(t, orchestrator, "2", "1+2")
+	submitExpression(t, orchestrator, "3", "ln(5)")
+	submitExpression(t, orchestrator, "4", "3*4")
+
+	fetch := func(agent, capabilities string) string {
+		req, err := http.NewRequest("GET", "/internal/task", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(AGENT_ID_HEADER, agent)
+		req.Header.Set(AGENT_CAPABILITIES_HEADER, capabilities)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusOK {
+			return ""
+		}
+		var resp TaskResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Task.Operation
+	}
+
+	expected := []struct {
+		agent, capabilities, operation string
+	}{
+		{"basic", "", "+"},
+		{"trig", "ln", "ln"},
+		{"basic", "", "*"},
+		{"basic", "", ""},
+		{"full", "sqrt,ln", "sqrt"},
+	}
+	for _, step := range expected {
+		if operation := fetch(step.agent, step.capabilities); operation != step.operation {
+			t.Errorf("agent %s: expected %q, got %q", step.agent, step.operation, operation)
+		}
+	}
+	if orchestrator.agents["basic"].TasksTaken != 2 || orchestrator.agents["trig"].Capabilities[0] != "ln" {
+		t.Errorf("unexpected agents %+v %+v", orchestrator.agents["basic"], orchestrator.agents["trig"])
+	}
+}
+
+func TestAgentsEndpoint_ReportsUnroutable(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.GET("/admin/agents", orchestrator.handleAgentsRequest)
+
+	submitExpression(t, orchestrator, "1", "sqrt(4)+ln(1)")
+	submitExpression(t, orchestrator, "2", "1+2")
+	now := time.Now()
+	orchestrator.touchAgent("basic", AgentCapabilities{}, now)
+	orchestrator.touchAgent("trig", AgentCapabilities{"ln": true}, now)
+	orchestrator.touchAgent("gone", AgentCapabilities{"sqrt": true}, now.Add(-2*orchestrator.Config.AgentTTL))
+
+	req, err := http.NewRequest("GET", "/admin/agents", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", recorder.Code)
+	}
+	var resp AgentsResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Agents) != 3 || resp.Agents[0].ID != "basic" || !resp.Agents[0].Live || resp.Agents[1].Live {
+		t.Errorf("unexpected agents %+v", resp.Agents)
+	}
+	if len(resp.Unroutable) != 1 || resp.Unroutable[0].Operation != "sqrt" || resp.Unroutable[0].Expressions[0] != "1" {
+		t.Errorf("expected only sqrt to be unroutable, got %+v", resp.Unroutable)
+	}
+
+	orchestrator.forgetAgents(now)
+	if _, ok := orchestrator.agents["gone"]; !ok {
+		t.Error("agent forgotten too early")
+	}
+	orchestrator.forgetAgents(now.Add(9 * orchestrator.Config.AgentTTL))
+	if len(orchestrator.agents) != 2 {
+		t.Errorf("expected the stale agent to be forgotten, got %d agents", len(orchestrator.agents))
+	}
+}
@@ -0,0 +1,71 @@
+package app
+
+import "Yandex_Calc_V2.0/internal/ops"
+
+const (
+	// ARGUMENT_LIST joins the arguments of a call of a variadic function,
+	// like min(1,2,3), into a balanced tree under the call node. It is never
+	// a task of its own.
+	ARGUMENT_LIST = ","
+	// AGGREGATE_CHUNK_SIZE is the default largest number of arguments of one
+	// task of a variadic function.
+	AGGREGATE_CHUNK_SIZE = 64
+)
+
+func isArgumentList(node *ASTNode) bool {
+	return isOperation(node) && node.Operator == ARGUMENT_LIST
+}
+
+func isVariadic(op string) bool {
+	fn, ok := ops.LookupFunction(op)
+	return ok && fn.Arity == ops.Variadic
+}
+
+// callArguments returns the arguments of a call of a variadic function, or
+// nil for any other node.
+func callArguments(node *ASTNode) []*ASTNode {
+	if !isCall(node) || !isVariadic(node.Operator) {
+		return nil
+	}
+	return flattenChain(node.Left, ARGUMENT_LIST, nil)
+}
+
+func newCall(op string, args []*ASTNode) *ASTNode {
+	return &ASTNode{Operator: op, Left: buildBalanced(ARGUMENT_LIST, args)}
+}
+
+// splitAggregate replaces a call with more than Config.AggregateChunkSize
+// arguments by a tree of partial aggregations over chunks of the arguments,
+// which agents compute in parallel: min of mins, sum of sums. avg becomes the
+// sum of partial sums divided by the number of arguments. Statistics that do
+// not decompose, like median, stay one task.
+func (o *Orchestrator) splitAggregate(node *ASTNode) bool {
+	size := o.Config.AggregateChunkSize
+	args := callArguments(node)
+	if size < 2 || len(args) <= size {
+		return false
+	}
+	op := node.Operator
+	partial := op
+	if op == "avg" {
+		partial = "sum"
+	} else if fn, _ := ops.LookupFunction(op); !fn.Decomposable {
+		return false
+	}
+	parts := make([]*ASTNode, 0, (len(args)+size-1)/size)
+	for from := 0; from < len(args); from += size {
+		chunk := args[from:min(from+size, len(args))]
+		if len(chunk) == 1 {
+			parts = append(parts, chunk[0])
+			continue
+		}
+		parts = append(parts, newCall(partial, chunk))
+	}
+	if op == "avg" {
+		count := &ASTNode{IsLeaf: true, Value: float64(len(args))}
+		*node = ASTNode{Operator: "/", Left: newCall(partial, parts), Right: count}
+		return true
+	}
+	*node = *newCall(op, parts)
+	return true
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseAST_Variadic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"min(3, 1, 2)", "min(3,1,2)"},
+		{"max(1+2,2*3,-4)", "max(1+2,2*3,(-4))"},
+		{"sum(1,2)*avg(4)", "sum(1,2)*avg(4)"},
+		{"median(min(1,2),max(3,4),5)", "median(min(1,2),max(3,4),5)"},
+		{"stddev(1,2)+var(1,2)", "stddev(1,2)+var(1,2)"},
+		{"prod(2,3,4)", "prod(2,3,4)"},
+	}
+	for _, test := range tests {
+		ast, err := ParseAST(test.input)
+		if err != nil {
+			t.Errorf("ParseAST(%q): unexpected error %v", test.input, err)
+			continue
+		}
+		if got := ast.String(); got != test.expected {
+			t.Errorf("ParseAST(%q).String() = %q, want %q", test.input, got, test.expected)
+		}
+	}
+	for _, input := range []string{"min()", "1,2", "max(1,)", "sqrt(1,2)"} {
+		if _, err := ParseAST(input); err == nil {
+			t.Errorf("ParseAST(%q): expected an error", input)
+		}
+	}
+}
+
+func TestScheduleTasks_Aggregate(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	expr := submitExpression(t, orchestrator, "1", "min(3, 1+1, 5)*2")
+	task := orchestrator.taskQueue.PopFront().(*Task)
+	if task.Operation != "+" {
+		t.Fatalf("Expected the argument 1+1 first, got %+v", task)
+	}
+	if orchestrator.taskQueue.Len() != 0 {
+		t.Fatalf("Expected min to wait for its arguments, got %d queued", orchestrator.taskQueue.Len())
+	}
+	if recorder := postResult(t, router, `{"id":"`+task.ID+`","result":2}`); recorder.Code != 200 {
+		t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	task = orchestrator.taskQueue.PopFront().(*Task)
+	if task.Operation != "min" || len(task.Args) != 3 || task.Args[1] != 2 || task.OperationTime != 100 {
+		t.Fatalf("Expected one min task over all arguments, got %+v", task)
+	}
+	if recorder := postResult(t, router, `{"id":"`+task.ID+`","result":2}`); recorder.Code != 200 {
+		t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	runMatrixTasks(t, orchestrator, router)
+	if expr.Status != "completed" || *expr.Result != 4 {
+		t.Errorf("Expected 4, got %+v", expr)
+	}
+}
+
+func numbers(n int) string {
+	args := make([]string, n)
+	for i := range args {
+		args[i] = strconv.Itoa(i + 1)
+	}
+	return strings.Join(args, ",")
+}
+
+func TestScheduleTasks_AggregateChunks(t *testing.T) {
+	tests := []struct {
+		expression string
+		tasks      int
+		expected   float64
+	}{
+		// 10 arguments in chunks of 3: 3 partial maxima and 10, which
+		// are split again into max(p1,p2,p3) and 10, then the final max.
+		{"max(" + numbers(10) + ")", 5, 10},
+		{"avg(" + numbers(10) + ")", 6, 5.5},
+		{"median(" + numbers(10) + ")", 1, 5.5},
+		{"stddev(" + numbers(3) + ")*3", 2, 3 * 0.816496580927726},
+	}
+	for i, test := range tests {
+		orchestrator := NewOrchestrator()
+		orchestrator.Config.AggregateChunkSize = 3
+		router := gin.Default()
+		router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+		expr := submitExpression(t, orchestrator, strconv.Itoa(i+1), test.expression)
+		if tasks := runMatrixTasks(t, orchestrator, router); tasks != test.tasks {
+			t.Errorf("%s: expected %d tasks, got %d", test.expression, test.tasks, tasks)
+		}
+		if expr.Status != "completed" || expr.Result == nil || *expr.Result-test.expected > 1e-12 || test.expected-*expr.Result > 1e-12 {
+			t.Errorf("%s: expected %v, got %+v", test.expression, test.expected, expr)
+		}
+	}
+}
+
+func TestUnitOf_Aggregate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{"max(1 m, 20 cm)", "m", ""},
+		{"var(1 s, 2 s)", "s^2", ""},
+		{"prod(2 m, 3 s)", "m*s", ""},
+		{"min(1 m, 2 s)", "", "min expects arguments of one unit, got m and s"},
+	}
+	for _, test := range tests {
+		ast, err := ParseAST(test.input)
+		if err != nil {
+			t.Fatalf("ParseAST(%q): %v", test.input, err)
+		}
+		unit, err := unitOf(ast)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("unitOf(%q): expected error %q, got %v", test.input, test.err, err)
+			}
+			continue
+		}
+		if err != nil || unit.String() != test.expected {
+			t.Errorf("unitOf(%q) = %q, %v, want %q", test.input, unit, err, test.expected)
+		}
+	}
+}
+
+func TestOptimize_FoldsAggregates(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.Config.Optimizer.FoldCostThreshold = 1000
+	ast, err := ParseAST("max(1,2,3)+1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path := orchestrator.criticalPath(ast); path.Operations != 2 {
+		t.Errorf("Expected a critical path of max and +, got %+v", path)
+	}
+	if n := countOperations(ast); n != 2 {
+		t.Errorf("Expected 2 operations, got %d", n)
+	}
+	ast, _ = orchestrator.Optimize(ast, false)
+	if !ast.IsLeaf || ast.Value != 4 {
+		t.Errorf("Expected max(1,2,3)+1 to fold to 4, got %s", ast)
+	}
+}
@@ -0,0 +1,168 @@
+package app
+
+import (
+	"math"
+)
+
+// Largest magnitude below which every integer is exactly representable
+// as a float64.
+const EXACT_INTEGER_LIMIT = 1 << 53
+
+type CriticalPath struct {
+	Operations  int `json:"operations" example:"7"`
+	EstimatedMs int `json:"estimated_ms" example:"1400"`
+}
+
+// criticalPath returns the longest chain of dependent operations in the AST,
+// which bounds the calculation time no matter how many agents are running.
+func (o *Orchestrator) criticalPath(node *ASTNode) CriticalPath {
+	if isControl(node) {
+		// The operands run one after the other and the node itself is no
+		// task; of the branches the longer one bounds the time.
+		left, right := o.criticalPath(node.Left), o.criticalPath(node.Right)
+		return CriticalPath{
+			Operations:  left.Operations + right.Operations,
+			EstimatedMs: left.EstimatedMs + right.EstimatedMs,
+		}
+	}
+	if isArgumentList(node) || isBranches(node) {
+		left, right := o.criticalPath(node.Left), o.criticalPath(node.Right)
+		if right.EstimatedMs > left.EstimatedMs || (right.EstimatedMs == left.EstimatedMs && right.Operations > left.Operations) {
+			return right
+		}
+		return left
+	}
+	if isCall(node) {
+		path := o.criticalPath(node.Left)
+		return CriticalPath{
+			Operations:  path.Operations + 1,
+			EstimatedMs: path.EstimatedMs + o.operationTime(node.Operator),
+		}
+	}
+	if !isOperation(node) {
+		return CriticalPath{}
+	}
+	left, right := o.criticalPath(node.Left), o.criticalPath(node.Right)
+	longest := left
+	if right.EstimatedMs > left.EstimatedMs || (right.EstimatedMs == left.EstimatedMs && right.Operations > left.Operations) {
+		longest = right
+	}
+	return CriticalPath{
+		Operations:  max(left.Operations, right.Operations) + 1,
+		EstimatedMs: longest.EstimatedMs + o.operationTime(node.Operator),
+	}
+}
+
+func depth(node *ASTNode) int {
+	if isArgumentList(node) {
+		return max(depth(node.Left), depth(node.Right))
+	}
+	if isCall(node) {
+		return 1 + depth(node.Left)
+	}
+	if !isOperation(node) {
+		return 0
+	}
+	return 1 + max(depth(node.Left), depth(node.Right))
+}
+
+func chainOperator(op string) string {
+	if op == "-" {
+		return "+"
+	}
+	return op
+}
+
+type chainOperand struct {
+	slot    **ASTNode
+	negated bool
+}
+
+// chainOperands collects the operands of a chain of one associative
+// operator. a-b joins a + chain when b is a literal, since a+(-b) is exact.
+func chainOperands(slot **ASTNode, op string, negated bool, operands []chainOperand) []chainOperand {
+	node := *slot
+	if isOperation(node) && chainOperator(node.Operator) == op && (node.Operator != "-" || node.Right.IsLeaf) {
+		operands = chainOperands(&node.Left, op, false, operands)
+		return chainOperands(&node.Right, op, node.Operator == "-", operands)
+	}
+	return append(operands, chainOperand{slot: slot, negated: negated})
+}
+
+func buildBalanced(op string, operands []*ASTNode) *ASTNode {
+	if len(operands) == 1 {
+		return operands[0]
+	}
+	mid := len(operands) / 2
+	return &ASTNode{
+		Operator: op,
+		Left:     buildBalanced(op, operands[:mid]),
+		Right:    buildBalanced(op, operands[mid:]),
+	}
+}
+
+// exactChain reports whether any evaluation order of the chain gives the
+// same float64 result: every operand is an integer literal and every
+// partial result stays within the exactly representable range. The bound of
+// a product skips zeros, since partial products without them can overflow
+// to Inf and Inf*0 is NaN.
+func exactChain(op string, operands []*ASTNode) bool {
+	bound := 0.0
+	if op == "*" {
+		bound = 1
+	}
+	for _, operand := range operands {
+		if !operand.IsLeaf || operand.Imag != 0 || operand.Value != math.Trunc(operand.Value) {
+			return false
+		}
+		switch {
+		case op == "+":
+			bound += math.Abs(operand.Value)
+		case operand.Value != 0:
+			bound *= math.Abs(operand.Value)
+		}
+	}
+	return bound <= EXACT_INTEGER_LIMIT
+}
+
+// balance rebuilds left-deep chains of + and * into trees of logarithmic
+// depth. Chains whose result could change are only rebalanced when
+// AllowInexactReassociation is set.
+func (opt *optimizer) balance(node *ASTNode) *ASTNode {
+	if isCall(node) {
+		node.Left = opt.balance(node.Left)
+		return node
+	}
+	if !isOperation(node) {
+		return node
+	}
+	op := chainOperator(node.Operator)
+	if (op != "+" && op != "*") || (node.Operator == "-" && !node.Right.IsLeaf) || hasMatrix(node) {
+		node.Left = opt.balance(node.Left)
+		node.Right = opt.balance(node.Right)
+		return node
+	}
+	before, beforeDepth := node.String(), depth(node)
+	chain := chainOperands(&node, op, false, nil)
+	operands := make([]*ASTNode, len(chain))
+	for i, operand := range chain {
+		*operand.slot = opt.balance(*operand.slot)
+		operands[i] = *operand.slot
+		if operand.negated {
+			operands[i] = &ASTNode{IsLeaf: true, Value: -operands[i].Value, Imag: -operands[i].Imag}
+		}
+	}
+	if !exactChain(op, operands) && !opt.config.AllowInexactReassociation {
+		return node
+	}
+	result := buildBalanced(op, operands)
+	if depth(result) >= beforeDepth {
+		return node
+	}
+	opt.report.Rewrites = append(opt.report.Rewrites, Rewrite{
+		Rule:   "reassociate",
+		Before: before,
+		After:  result.String(),
+	})
+	return result
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"testing"
+)
+
+func TestBalance(t *testing.T) {
+	tests := []struct {
+		name        string
+		expression  string
+		inexact     bool
+		strictOrder bool
+		expected    string
+	}{
+		{"Integer Sum", "1+2+3+4", false, false, "1+2+(3+4)"},
+		{"Three Operands Keep Shape", "1+2+3", false, false, "1+2+3"},
+		{"Subtraction Of Literals", "10-1-2-3", false, false, "10+(-1)+((-2)+(-3))"},
+		{"Subtraction Of Subtree", "10-(1+2)-3-4-5", true, false, "10-(1+2)+(-3)+((-4)+(-5))"},
+		{"Inexact Sum Skipped", "0.1+0.2+0.3+0.4", false, false, "0.1+0.2+0.3+0.4"},
+		{"Inexact Sum Allowed", "0.1+0.2+0.3+0.4", true, false, "0.1+0.2+(0.3+0.4)"},
+		{"Subtree Operands Need Inexact", "1*2+3*4+5*6+7*8", false, false, "1*2+3*4+5*6+7*8"},
+		{"Subtree Operands", "1*2+3*4+5*6+7*8", true, false, "1*2+3*4+(5*6+7*8)"},
+		{"Nested Chains", "(1+2+3+4)*5*6*7", false, false, "(1+2+(3+4))*5*6*7"},
+		{"Nested Chains Inexact", "(1+2+3+4)*5*6*7", true, false, "(1+2+(3+4))*5*(6*7)"},
+		{"Large Product Skipped", "99999999*99999999*99999999*2", false, false, "99999999*99999999*99999999*2"},
+		{"Large Product With Zero Skipped", "0*99999999*99999999*99999999", false, false, "0*99999999*99999999*99999999"},
+		{"Strict Order", "1+2+3+4", true, true, "1+2+3+4"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			orchestrator := NewOrchestrator()
+			orchestrator.Config.Optimizer = OptimizerConfig{
+				Enabled:                   true,
+				Reassociate:               true,
+				AllowInexactReassociation: test.inexact,
+			}
+			ast, err := ParseAST(test.expression)
+			if err != nil {
+				t.Fatalf("Failed to parse %q: %v", test.expression, err)
+			}
+			expected, _ := evaluateLocally(ast)
+
+			result, _ := orchestrator.Optimize(ast, test.strictOrder)
+
+			if result.String() != test.expected {
+				t.Errorf("Expected %s, got %s", test.expected, result.String())
+			}
+			if value, _ := evaluateLocally(result); !test.inexact && value != expected {
+				t.Errorf("Expected exact value %v, got %v", expected, value)
+			}
+		})
+	}
+}
+
+func TestBalance_LongChain(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	expression := "1"
+	for i := 2; i <= 100; i++ {
+		expression += "+1"
+	}
+	ast, err := ParseAST(expression)
+	if err != nil {
+		t.Fatalf("Failed to parse expression: %v", err)
+	}
+	if path := orchestrator.criticalPath(ast); path.Operations != 99 {
+		t.Fatalf("Expected a critical path of 99 operations, got %d", path.Operations)
+	}
+
+	result, report := orchestrator.Optimize(ast, false)
+
+	path := orchestrator.criticalPath(result)
+	if path.Operations != 7 {
+		t.Errorf("Expected a critical path of 7 operations, got %d", path.Operations)
+	}
+	if path.EstimatedMs != 7*TIME_ADDITION_MS {
+		t.Errorf("Expected %d ms, got %d", 7*TIME_ADDITION_MS, path.EstimatedMs)
+	}
+	if len(report.Rewrites) != 1 || report.Rewrites[0].Rule != "reassociate" {
+		t.Errorf("Expected one reassociate rewrite, got %+v", report.Rewrites)
+	}
+	if value, _ := evaluateLocally(result); value != 100 {
+		t.Errorf("Expected 100, got %v", value)
+	}
+}
+
+func TestCriticalPath(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	tests := []struct {
+		expression string
+		expected   CriticalPath
+	}{
+		{"5", CriticalPath{}},
+		{"1+2", CriticalPath{Operations: 1, EstimatedMs: TIME_ADDITION_MS}},
+		{"(1+2)*(3/4)", CriticalPath{Operations: 2, EstimatedMs: TIME_DIVISIONS_MS + TIME_MULTIPLICATIONS_MS}},
+		{"1-2-3", CriticalPath{Operations: 2, EstimatedMs: 2 * TIME_SUBTRACTION_MS}},
+	}
+
+	for _, test := range tests {
+		ast, err := ParseAST(test.expression)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", test.expression, err)
+		}
+		if path := orchestrator.criticalPath(ast); path != test.expected {
+			t.Errorf("for expression %q, expected %+v, got %+v", test.expression, test.expected, path)
+		}
+	}
+}
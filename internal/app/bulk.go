@@ -0,0 +1,490 @@
+package app
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	FORMAT_CSV               = "csv"
+	FORMAT_NDJSON            = "ndjson"
+	FORMAT_JSON              = "json"
+	FORMAT_PARQUET_LESS_JSON = "parquet-less-json" // alias of FORMAT_JSON
+	EXPORT_BATCH_SIZE        = 500
+	IMPORT_MAX_BYTES         = 10 << 20
+	IMPORT_MAX_LINES         = 10000
+)
+
+var exportContentTypes = map[string]string{
+	FORMAT_CSV:    "text/csv",
+	FORMAT_NDJSON: "application/x-ndjson",
+	FORMAT_JSON:   "application/json",
+}
+
+var exportColumns = []string{
+	"id", "expression", "status", "result", "special_result", "complex_result",
+	"matrix_result", "unit", "error", "created_at", "completed_at", "job_id",
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func jsonCell(v any) string {
+	encoded, _ := json.Marshal(v)
+	return string(encoded)
+}
+
+func exportRecord(expr *Expression) []string {
+	record := []string{expr.ID, expr.Expr, expr.Status, "", expr.SpecialResult, "", "", expr.Unit, expr.Error,
+		formatTime(expr.CreatedAt), formatTime(expr.CompletedAt), expr.JobID}
+	if expr.Result != nil {
+		record[3] = formatNumber(*expr.Result)
+	}
+	if expr.ComplexResult != nil {
+		record[5] = jsonCell(expr.ComplexResult)
+	}
+	if expr.MatrixResult != nil {
+		record[6] = jsonCell(expr.MatrixResult)
+	}
+	return record
+}
+
+// exportWriter writes expressions in one of the export formats.
+type exportWriter struct {
+	out    io.Writer
+	w      *bufio.Writer
+	table  *csv.Writer
+	format string
+	count  int
+}
+
+func newExportWriter(out io.Writer, format string) (*exportWriter, error) {
+	e := &exportWriter{out: out, w: bufio.NewWriter(out), format: format}
+	switch format {
+	case FORMAT_CSV:
+		e.table = csv.NewWriter(e.w)
+		return e, e.table.Write(exportColumns)
+	case FORMAT_JSON:
+		_, err := e.w.WriteString("[")
+		return e, err
+	}
+	return e, nil
+}
+
+func (e *exportWriter) write(expr *Expression) error {
+	e.count++
+	if e.table != nil {
+		return e.table.Write(exportRecord(expr))
+	}
+	body, err := json.Marshal(expr)
+	if err != nil {
+		return err
+	}
+	if e.format == FORMAT_JSON && e.count > 1 {
+		e.w.WriteByte(',')
+	}
+	if e.format == FORMAT_JSON {
+		e.w.WriteByte('\n')
+	}
+	e.w.Write(body)
+	if e.format == FORMAT_NDJSON {
+		return e.w.WriteByte('\n')
+	}
+	return nil
+}
+
+func (e *exportWriter) flush() error {
+	if e.table != nil {
+		e.table.Flush()
+		if err := e.table.Error(); err != nil {
+			return err
+		}
+	}
+	if err := e.w.Flush(); err != nil {
+		return err
+	}
+	if flusher, ok := e.out.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+func (e *exportWriter) close() error {
+	if e.format == FORMAT_JSON {
+		e.w.WriteString("\n]\n")
+	}
+	return e.flush()
+}
+
+// matching returns the IDs of the expressions the query matches, in its
+// order. The caller must hold o.mutex.
+func (q *listQuery) matching(store map[string]*Expression) []string {
+	matched := q.sorted(store)
+	ids := make([]string, len(matched))
+	for i, expr := range matched {
+		ids[i] = expr.ID
+	}
+	return ids
+}
+
+// @Summary Export expressions
+// @Description Stream the expressions matching the filters of GET /expressions as CSV, NDJSON or a JSON array. Expressions are copied from the store in batches, so the store is not locked while the client reads
+// @Tags calculations
+// @Produce plain
+// @Produce json
+// @Param format query string false "csv, ndjson or json, also called parquet-less-json (default ndjson)"
+// @Param status query string false "Comma-separated statuses"
+// @Param created_from query string false "RFC3339 lower bound of created_at (inclusive)"
+// @Param created_to query string false "RFC3339 upper bound of created_at (exclusive)"
+// @Param q query string false "Expression substring"
+// @Param sort query string false "Sort field: id, created_at or completed_at"
+// @Param order query string false "Sort order: asc or desc"
+// @Success 200 {string} string "Expressions"
+// @Failure 400 {object} Error "Invalid query parameter"
+// @Router /expressions/export [get]
+func (o *Orchestrator) handleExportRequest(c *gin.Context) {
+	if c.Request.Method != http.MethodGet {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
+		return
+	}
+	format := c.DefaultQuery("format", FORMAT_NDJSON)
+	if format == FORMAT_PARQUET_LESS_JSON {
+		format = FORMAT_JSON
+	}
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid format %q", format)})
+		return
+	}
+	query, err := parseListQuery(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	o.mutex.Lock()
+	ids := query.matching(o.expressionStore)
+	o.mutex.Unlock()
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="expressions.`+format+`"`)
+	c.Status(http.StatusOK)
+	out, err := newExportWriter(c.Writer, format)
+	batch := make([]Expression, 0, EXPORT_BATCH_SIZE)
+	for start := 0; start < len(ids) && err == nil; start += EXPORT_BATCH_SIZE {
+		batch = batch[:0]
+		o.mutex.Lock()
+		for _, id := range ids[start:min(start+EXPORT_BATCH_SIZE, len(ids))] {
+			// Expressions purged since the IDs were taken are skipped.
+			if expr, ok := o.expressionStore[id]; ok {
+				expr.syncStatus()
+				batch = append(batch, *expr)
+			}
+		}
+		o.mutex.Unlock()
+		for i := range batch {
+			if err = out.write(&batch[i]); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = out.flush()
+		}
+	}
+	if err == nil {
+		err = out.close()
+	}
+	if err != nil {
+		c.Error(err)
+	}
+}
+
+// ImportLine is one line of an import report.
+type ImportLine struct {
+	Line       int    `json:"line" example:"2"`
+	Expression string `json:"expression,omitempty" example:"2+2"`
+	ID         string `json:"id,omitempty" example:"1"`
+	Error      string `json:"error,omitempty" example:"Invalid expression: unexpected end of expression"`
+}
+
+// ImportReport records the outcome of every line of an imported file.
+type ImportReport struct {
+	ID        string
+	Owner     string
+	CreatedAt time.Time
+	Lines     []ImportLine
+	Imported  int
+	Failed    int
+}
+
+func (r *ImportReport) add(line ImportLine) {
+	if line.Error != "" {
+		r.Failed++
+	} else {
+		r.Imported++
+	}
+	r.Lines = append(r.Lines, line)
+}
+
+// readImport calls the function with the request of every line of the
+// file, or with the error of a line that cannot be read. CSV files need a
+// header with an expression column; strict_order and natural_notation
+// columns are optional. Lines of NDJSON files are ExpressionRequest objects,
+// so both formats read their export back.
+func readImport(file io.Reader, format string, line func(int, *ExpressionRequest, error)) error {
+	if format == FORMAT_NDJSON {
+		scanner := bufio.NewScanner(file)
+		for number := 1; scanner.Scan(); number++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var req ExpressionRequest
+			err := json.Unmarshal([]byte(text), &req)
+			if err == nil && req.Expression == "" {
+				err = errors.New("no expression")
+			}
+			line(number, &req, err)
+		}
+		return scanner.Err()
+	}
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("invalid CSV header: %v", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	exprColumn, ok := columns["expression"]
+	if !ok {
+		return errors.New("the CSV header has no expression column")
+	}
+	flag := func(record []string, name string) (bool, error) {
+		i, ok := columns[name]
+		if !ok || i >= len(record) || record[i] == "" {
+			return false, nil
+		}
+		return strconv.ParseBool(record[i])
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			line(parseErr.Line, nil, parseErr.Err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		number, _ := reader.FieldPos(0)
+		req := &ExpressionRequest{}
+		if exprColumn < len(record) {
+			req.Expression = record[exprColumn]
+		}
+		if req.Expression == "" {
+			err = errors.New("no expression")
+		}
+		if strict, flagErr := flag(record, "strict_order"); flagErr != nil {
+			err = fmt.Errorf("invalid strict_order: %v", flagErr)
+		} else {
+			req.StrictOrder = strict
+		}
+		if natural, flagErr := flag(record, "natural_notation"); flagErr != nil {
+			err = fmt.Errorf("invalid natural_notation: %v", flagErr)
+		} else {
+			req.NaturalNotation = natural
+		}
+		line(number, req, err)
+	}
+}
+
+// importFormat picks the format from the query, the file name or the
+// content type, in this order.
+func importFormat(c *gin.Context, header *multipart.FileHeader) string {
+	if format := c.Query("format"); format != "" {
+		return format
+	}
+	if header != nil {
+		return strings.TrimPrefix(path.Ext(header.Filename), ".")
+	}
+	if strings.HasPrefix(c.ContentType(), "text/csv") {
+		return FORMAT_CSV
+	}
+	return FORMAT_NDJSON
+}
+
+// ImportResponse swagger model
+// @Description Итог импорта выражений
+type ImportResponse struct {
+	ReportID string `json:"report_id" example:"1"`
+	Imported int    `json:"imported" example:"98"`
+	Failed   int    `json:"failed" example:"2"`
+}
+
+// @Summary Import expressions
+// @Description Queue every expression of a CSV or NDJSON file, sent as the body or as the file field of a multipart form. Lines that cannot be queued are listed in the report
+// @Tags calculations
+// @Accept plain
+// @Accept mpfd
+// @Produce json
+// @Param format query string false "csv or ndjson; by default taken from the file name or the content type"
+// @Param file formData file false "CSV or NDJSON file"
+// @Success 201 {object} ImportResponse
+// @Failure 413 {object} Error "File too large"
+// @Failure 422 {object} Error "Invalid file"
+// @Router /expressions/import [post]
+func (o *Orchestrator) handleImportRequest(c *gin.Context) {
+	if c.Request.Method != http.MethodPost {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, IMPORT_MAX_BYTES)
+	var file io.Reader = c.Request.Body
+	var header *multipart.FileHeader
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		var err error
+		if header, err = c.FormFile("file"); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid Body"})
+			return
+		}
+		opened, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid Body"})
+			return
+		}
+		defer opened.Close()
+		file = opened
+	}
+	format := importFormat(c, header)
+	if format != FORMAT_CSV && format != FORMAT_NDJSON {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("Invalid format %q", format)})
+		return
+	}
+	owner := userFromRequest(c)
+	report := &ImportReport{Owner: owner, CreatedAt: time.Now()}
+	err := readImport(file, format, func(number int, req *ExpressionRequest, err error) {
+		line := ImportLine{Line: number}
+		if req != nil {
+			line.Expression = req.Expression
+		}
+		if err == nil && len(report.Lines) >= IMPORT_MAX_LINES {
+			err = fmt.Errorf("more than %d lines", IMPORT_MAX_LINES)
+		}
+		if err != nil {
+			line.Error = "Invalid line: " + err.Error()
+			report.add(line)
+			return
+		}
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		expr, ast, expanded, err := o.newExpression(owner, req, time.Now())
+		var parseErrors ParseErrors
+		switch {
+		case errors.As(err, &parseErrors):
+			messages := make([]string, len(parseErrors))
+			for i, parseErr := range parseErrors {
+				messages[i] = fmt.Sprintf("column %d: %s", parseErr.Column, parseErr.Message)
+			}
+			line.Error = "Invalid expression: " + strings.Join(messages, "; ")
+		case err != nil:
+			line.Error = err.Error()
+		default:
+			line.ID = o.startExpression(expr, ast, expanded, req.StrictOrder)
+		}
+		report.add(line)
+	})
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File too large"})
+		return
+	case err != nil && len(report.Lines) == 0:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid file: " + err.Error()})
+		return
+	case err != nil:
+		report.add(ImportLine{Line: report.Lines[len(report.Lines)-1].Line + 1, Error: "Invalid line: " + err.Error()})
+	}
+	o.mutex.Lock()
+	o.importCounter++
+	report.ID = strconv.FormatInt(o.importCounter, 10)
+	o.importReports[report.ID] = report
+	o.mutex.Unlock()
+	c.JSON(http.StatusCreated, ImportResponse{ReportID: report.ID, Imported: report.Imported, Failed: report.Failed})
+}
+
+// @Summary Download import report
+// @Description Download the outcome of every line of an import: the ID of the queued expression or the error. With errors_only=true only the failed lines are listed. Only the user who imported the file can download the report
+// @Tags calculations
+// @Produce plain
+// @Produce json
+// @Param id path string true "Report ID"
+// @Param format query string false "csv or ndjson (default csv)"
+// @Param errors_only query bool false "List only the failed lines"
+// @Success 200 {string} string "Report"
+// @Failure 400 {object} Error "Invalid format"
+// @Failure 404 {object} Error "Report not found"
+// @Router /expressions/import/{id} [get]
+func (o *Orchestrator) handleImportReportRequest(c *gin.Context) {
+	if c.Request.Method != http.MethodGet {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
+		return
+	}
+	format := c.DefaultQuery("format", FORMAT_CSV)
+	if format != FORMAT_CSV && format != FORMAT_NDJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid format %q", format)})
+		return
+	}
+	o.mutex.Lock()
+	report, ok := o.importReports[c.Param("id")]
+	o.mutex.Unlock()
+	// Reports of other users are not found, like their functions.
+	if !ok || report.Owner != userFromRequest(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		return
+	}
+	errorsOnly := c.Query("errors_only") == "true"
+	c.Header("Content-Type", exportContentTypes[format])
+	c.Header("Content-Disposition", `attachment; filename="import-`+report.ID+`.`+format+`"`)
+	c.Status(http.StatusOK)
+	w := bufio.NewWriter(c.Writer)
+	table := csv.NewWriter(w)
+	if format == FORMAT_CSV {
+		table.Write([]string{"line", "expression", "id", "error"})
+	}
+	// A stored report no longer changes.
+	for _, line := range report.Lines {
+		if errorsOnly && line.Error == "" {
+			continue
+		}
+		if format == FORMAT_CSV {
+			table.Write([]string{strconv.Itoa(line.Line), line.Expression, line.ID, line.Error})
+			continue
+		}
+		w.WriteString(jsonCell(line) + "\n")
+	}
+	table.Flush()
+	if err := w.Flush(); err != nil {
+		c.Error(err)
+	}
+}
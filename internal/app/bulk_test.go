@@ -0,0 +1,251 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func bulkRouter(o *Orchestrator) *gin.Engine {
+	router := gin.Default()
+	router.GET("/api/v1/expressions/export", o.handleExportRequest)
+	router.POST("/api/v1/expressions/import", o.handleImportRequest)
+	router.GET("/api/v1/expressions/import/:id", o.handleImportReportRequest)
+	router.GET("/api/v1/expressions/:id", o.handleExpressionByIdRequest)
+	return router
+}
+
+func bulkRequest(router *gin.Engine, method, target, contentType string, body *bytes.Buffer) *httptest.ResponseRecorder {
+	if body == nil {
+		body = &bytes.Buffer{}
+	}
+	req := httptest.NewRequest(method, target, body)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func newExportStore() map[string]*Expression {
+	created := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	result := 4.0
+	return map[string]*Expression{
+		"1": {ID: "1", Expr: "2+2", Status: "completed", Result: &result, CreatedAt: &created, CompletedAt: &created},
+		"2": {ID: "2", Expr: "1/0", Status: "failed", Error: "division by zero is not allowed", CreatedAt: &created},
+		"3": {ID: "3", Expr: "sqrt(-4)", Status: "completed", ComplexResult: &ComplexValue{Im: 2}, CreatedAt: &created},
+	}
+}
+
+func TestHandleExportRequest(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.expressionStore = newExportStore()
+	router := bulkRouter(orchestrator)
+
+	recorder := bulkRequest(router, http.MethodGet, "/api/v1/expressions/export?format=csv", "", nil)
+	expected := "id,expression,status,result,special_result,complex_result,matrix_result,unit,error,created_at,completed_at,job_id\n" +
+		"1,2+2,completed,4,,,,,,2026-10-19T09:00:00Z,2026-10-19T09:00:00Z,\n" +
+		"2,1/0,failed,,,,,,division by zero is not allowed,2026-10-19T09:00:00Z,,\n" +
+		"3,sqrt(-4),completed,,,\"{\"\"re\"\":0,\"\"im\"\":2}\",,,,2026-10-19T09:00:00Z,,\n"
+	if recorder.Code != http.StatusOK || recorder.Body.String() != expected {
+		t.Errorf("Unexpected CSV export %d:\n%s", recorder.Code, recorder.Body.String())
+	}
+	if disposition := recorder.Header().Get("Content-Disposition"); disposition != `attachment; filename="expressions.csv"` {
+		t.Errorf("Unexpected Content-Disposition %q", disposition)
+	}
+
+	recorder = bulkRequest(router, http.MethodGet, "/api/v1/expressions/export?status=failed", "", nil)
+	expected = `{"id":"2","expression":"1/0","status":"failed","error":"division by zero is not allowed","created_at":"2026-10-19T09:00:00Z"}` + "\n"
+	if recorder.Body.String() != expected {
+		t.Errorf("Unexpected NDJSON export:\n%s", recorder.Body.String())
+	}
+
+	recorder = bulkRequest(router, http.MethodGet, "/api/v1/expressions/export?format=json&order=desc", "", nil)
+	var exprs []Expression
+	if err := json.Unmarshal(recorder.Body.Bytes(), &exprs); err != nil {
+		t.Fatalf("Invalid JSON export: %v\n%s", err, recorder.Body.String())
+	}
+	if len(exprs) != 3 || exprs[0].ID != "3" || exprs[2].ID != "1" {
+		t.Errorf("Unexpected JSON export %+v", exprs)
+	}
+
+	recorder = bulkRequest(router, http.MethodGet, "/api/v1/expressions/export?format=parquet-less-json", "", nil)
+	if err := json.Unmarshal(recorder.Body.Bytes(), &exprs); err != nil || len(exprs) != 3 {
+		t.Errorf("Expected a JSON array, got %v\n%s", err, recorder.Body.String())
+	}
+	if disposition := recorder.Header().Get("Content-Disposition"); disposition != `attachment; filename="expressions.json"` {
+		t.Errorf("Unexpected Content-Disposition %q", disposition)
+	}
+
+	orchestrator.expressionStore = map[string]*Expression{}
+	if recorder := bulkRequest(router, http.MethodGet, "/api/v1/expressions/export?format=json", "", nil); recorder.Body.String() != "[\n]\n" {
+		t.Errorf("Expected an empty array, got %q", recorder.Body.String())
+	}
+	for _, target := range []string{"/api/v1/expressions/export?format=parquet", "/api/v1/expressions/export?sort=name"} {
+		if recorder := bulkRequest(router, http.MethodGet, target, "", nil); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", target, recorder.Code)
+		}
+	}
+}
+
+func TestHandleExportRequest_Batches(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	for i := 0; i < EXPORT_BATCH_SIZE+10; i++ {
+		submitExpression(t, orchestrator, strconv.Itoa(i+1), "1+1")
+	}
+	recorder := bulkRequest(bulkRouter(orchestrator), http.MethodGet, "/api/v1/expressions/export?format=csv", "", nil)
+	if lines := strings.Count(recorder.Body.String(), "\n"); lines != EXPORT_BATCH_SIZE+11 {
+		t.Errorf("Expected %d lines, got %d", EXPORT_BATCH_SIZE+11, lines)
+	}
+}
+
+func TestHandleImportRequest_NDJSON(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := bulkRouter(orchestrator)
+	body := bytes.NewBufferString(`{"expression":"2+2"}
+
+{"expression":"2+"}
+not json
+{"expression":"2pi","natural_notation":true}
+{"id":"9","expression":"1m+1s","status":"completed"}
+{"strict_order":true}
+`)
+	recorder := bulkRequest(router, http.MethodPost, "/api/v1/expressions/import", "application/x-ndjson", body)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var response ImportResponse
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if response.Imported != 2 || response.Failed != 4 {
+		t.Errorf("Expected 2 imported and 4 failed, got %+v", response)
+	}
+
+	recorder = bulkRequest(router, http.MethodGet, "/api/v1/expressions/import/"+response.ReportID+"?errors_only=true", "", nil)
+	expected := "line,expression,id,error\n" +
+		"3,2+,,Invalid expression: column 3: unexpected end of expression\n" +
+		"4,,,Invalid line: invalid character 'o' in literal null (expecting 'u')\n" +
+		"6,1m+1s,,Incompatible units: cannot add m and s\n" +
+		"7,,,Invalid line: no expression\n"
+	if recorder.Code != http.StatusOK || recorder.Body.String() != expected {
+		t.Errorf("Unexpected report %d:\n%s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = bulkRequest(router, http.MethodGet, "/api/v1/expressions/import/"+response.ReportID+"?format=ndjson", "", nil)
+	if first := strings.SplitN(recorder.Body.String(), "\n", 2)[0]; first != `{"line":1,"expression":"2+2","id":"1"}` {
+		t.Errorf("Unexpected first report line %s", first)
+	}
+	if expr := orchestrator.expressionStore["2"]; expr == nil || expr.Expr != "2pi" || !expr.Options.Natural {
+		t.Errorf("Expected 2pi in natural notation, got %+v", expr)
+	}
+	if recorder := bulkRequest(router, http.MethodGet, "/api/v1/expressions/import/9", "", nil); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", recorder.Code)
+	}
+}
+
+func TestHandleImportRequest_CSV(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := bulkRouter(orchestrator)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, _ := form.CreateFormFile("file", "audit.csv")
+	file.Write([]byte("id,expression,strict_order\n1,1+2+3,true\n2,,\n3,\"4*(5\",\n4,2*3,maybe\n"))
+	form.Close()
+	recorder := bulkRequest(router, http.MethodPost, "/api/v1/expressions/import", form.FormDataContentType(), &body)
+	var response ImportResponse
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if recorder.Code != http.StatusCreated || response.Imported != 1 || response.Failed != 3 {
+		t.Fatalf("Expected 1 imported and 3 failed, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	recorder = bulkRequest(router, http.MethodGet, "/api/v1/expressions/import/1", "", nil)
+	expected := "line,expression,id,error\n" +
+		"2,1+2+3,1,\n" +
+		"3,,,Invalid line: no expression\n" +
+		"4,4*(5,,Invalid expression: column 5: unexpected end of expression\n" +
+		"5,2*3,,\"Invalid line: invalid strict_order: strconv.ParseBool: parsing \"\"maybe\"\": invalid syntax\"\n"
+	if recorder.Body.String() != expected {
+		t.Errorf("Unexpected report:\n%s", recorder.Body.String())
+	}
+
+	tests := []struct {
+		target      string
+		contentType string
+		body        string
+		code        int
+	}{
+		{"/api/v1/expressions/import", "text/csv", "id,expr\n1,2+2\n", http.StatusUnprocessableEntity},
+		{"/api/v1/expressions/import", "text/csv", "", http.StatusUnprocessableEntity},
+		{"/api/v1/expressions/import?format=xml", "text/csv", "expression\n1\n", http.StatusUnprocessableEntity},
+		{"/api/v1/expressions/import", "text/csv", "expression\n1\n", http.StatusCreated},
+	}
+	for _, test := range tests {
+		recorder := bulkRequest(router, http.MethodPost, test.target, test.contentType, bytes.NewBufferString(test.body))
+		if recorder.Code != test.code {
+			t.Errorf("%s %q: expected status %d, got %d: %s", test.target, test.body, test.code, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestHandleImportRequest_MalformedCSV(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := bulkRouter(orchestrator)
+
+	body := "expression\n1+1\n2\"+3\n4+4\n\"5+5\n6+6\n"
+	recorder := bulkRequest(router, http.MethodPost, "/api/v1/expressions/import", "text/csv", bytes.NewBufferString(body))
+	var response ImportResponse
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if recorder.Code != http.StatusCreated || response.Imported != 2 || response.Failed != 2 {
+		t.Fatalf("Expected 2 imported and 2 failed, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	recorder = bulkRequest(router, http.MethodGet, "/api/v1/expressions/import/1?errors_only=true", "", nil)
+	expected := "line,expression,id,error\n" +
+		"3,,,\"Invalid line: bare \"\" in non-quoted-field\"\n" +
+		"6,,,\"Invalid line: extraneous or missing \"\" in quoted-field\"\n"
+	if recorder.Body.String() != expected {
+		t.Errorf("Unexpected report:\n%s", recorder.Body.String())
+	}
+}
+
+func TestHandleImportReportRequest_Owner(t *testing.T) {
+	router := bulkRouter(NewOrchestrator())
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/expressions/import", strings.NewReader("expression\n2+2\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	req.Header.Set(USER_HEADER, "alice")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	for user, code := range map[string]int{"alice": http.StatusOK, "bob": http.StatusNotFound, "": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/expressions/import/1", nil)
+		if user != "" {
+			req.Header.Set(USER_HEADER, user)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != code {
+			t.Errorf("User %q: expected status %d, got %d", user, code, recorder.Code)
+		}
+	}
+}
+
+func TestImport_ReadsExport(t *testing.T) {
+	source := NewOrchestrator()
+	source.expressionStore = newExportStore()
+	target := NewOrchestrator()
+	for _, format := range []string{FORMAT_CSV, FORMAT_NDJSON} {
+		export := bulkRequest(bulkRouter(source), http.MethodGet, "/api/v1/expressions/export?format="+format, "", nil)
+		recorder := bulkRequest(bulkRouter(target), http.MethodPost, "/api/v1/expressions/import?format="+format, "", export.Body)
+		var response ImportResponse
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		if response.Imported != 3 || response.Failed != 0 {
+			t.Errorf("%s: expected 3 imported, got %s", format, recorder.Body.String())
+		}
+	}
+}
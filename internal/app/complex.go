@@ -0,0 +1,112 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strconv"
+
+	"Yandex_Calc_V2.0/internal/eval"
+)
+
+// COMPLEX_CAPABILITY is advertised by agents that accept complex operands.
+const COMPLEX_CAPABILITY = "complex"
+
+// VERIFY_TOLERANCE is the relative difference allowed between a result
+// computed by agents and its verification: agents round every step to
+// float64, eval works with exact rationals, and the order of operations
+// inside cmplx functions differs between the two.
+const VERIFY_TOLERANCE = 1e-9
+
+// ComplexValue swagger model
+// @Description Комплексное число
+type ComplexValue struct {
+	Re float64 `json:"re" example:"3"`
+	Im float64 `json:"im" example:"4"`
+}
+
+func newComplexValue(z complex128) ComplexValue {
+	return ComplexValue{Re: real(z), Im: imag(z)}
+}
+
+func (v ComplexValue) complex() complex128 {
+	return complex(v.Re, v.Im)
+}
+
+func (n *ASTNode) complex() complex128 {
+	return complex(n.Value, n.Imag)
+}
+
+func (n *ASTNode) setComplex(z complex128) {
+	n.Value, n.Imag = real(z), imag(z)
+	n.IsLeaf = true
+}
+
+// hasImaginary reports whether any leaf of the subtree is not real.
+func hasImaginary(node *ASTNode) bool {
+	if node == nil {
+		return false
+	}
+	if node.IsLeaf {
+		return node.Imag != 0
+	}
+	return hasImaginary(node.Left) || hasImaginary(node.Right)
+}
+
+// formatComplex renders a leaf with an imaginary part as 4i, (-4i) or (3+4i).
+func formatComplex(re, im float64) string {
+	imag := strconv.FormatFloat(math.Abs(im), 'f', -1, 64) + "i"
+	switch {
+	case re == 0 && im > 0:
+		return imag
+	case re == 0:
+		return "(-" + imag + ")"
+	case im > 0:
+		return "(" + strconv.FormatFloat(re, 'f', -1, 64) + "+" + imag + ")"
+	default:
+		return "(" + strconv.FormatFloat(re, 'f', -1, 64) + "-" + imag + ")"
+	}
+}
+
+// setResult copies the value of the reduced AST into the result fields: a
+// real value goes to Result, or to SpecialResult when it is not finite, a
+// complex one to ComplexResult and a matrix to MatrixResult.
+func (e *Expression) setResult() {
+	e.Result, e.SpecialResult, e.ComplexResult, e.MatrixResult = nil, "", nil, nil
+	if e.AST.Matrix != nil {
+		e.MatrixResult = e.AST.Matrix
+		return
+	}
+	if e.AST.Imag != 0 {
+		value := newComplexValue(e.AST.complex())
+		e.ComplexResult = &value
+		return
+	}
+	if !isFinite(e.AST.Value) {
+		e.SpecialResult = formatNumber(e.AST.Value)
+		return
+	}
+	e.Result = &e.AST.Value
+}
+
+// verifyResult recomputes the expression with eval. Expressions that leave
+// the reals on the way, like sqrt(-4)^2, are recomputed in complex
+// arithmetic.
+func verifyResult(source string, options eval.Options, node *ASTNode) error {
+	if node.Imag == 0 {
+		if tmp, err := eval.EvalWithOptions(source, options); err == nil {
+			if res := eval.BigratToFloat(tmp); math.Abs(res-node.Value) > VERIFY_TOLERANCE*math.Max(1, math.Abs(res)) {
+				return fmt.Errorf("result %v differs from verification %v", node.Value, res)
+			}
+			return nil
+		}
+	}
+	res, err := eval.EvalComplexWithOptions(source, options)
+	if err != nil {
+		return err
+	}
+	if got := node.complex(); cmplx.Abs(got-res) > VERIFY_TOLERANCE*math.Max(1, cmplx.Abs(res)) {
+		return fmt.Errorf("result %v differs from verification %v", got, res)
+	}
+	return nil
+}
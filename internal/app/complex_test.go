@@ -0,0 +1,184 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseAST_Complex(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"3+4i", "3+4i"},
+		{"i", "1i"},
+		{"-i", "(-1i)"},
+		{"2.5i*i", "2.5i*1i"},
+		{"sqrt(-4)+(1-2i)", "sqrt((-4))+(1-2i)"},
+		{"conj(3+4i)", "conj(3+4i)"},
+	}
+	for _, test := range tests {
+		ast, err := ParseAST(test.input)
+		if err != nil {
+			t.Errorf("ParseAST(%q): unexpected error %v", test.input, err)
+			continue
+		}
+		if got := ast.String(); got != test.expected {
+			t.Errorf("ParseAST(%q).String() = %q, want %q", test.input, got, test.expected)
+		}
+	}
+	if _, err := ParseAST("2in"); err == nil {
+		t.Errorf("expected 2in to be rejected")
+	}
+}
+
+func TestScheduleTasks_Complex(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.GET("/internal/task", orchestrator.handleGetTaskRequest)
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	expr := submitExpression(t, orchestrator, "1", "(3+4i)*2")
+
+	fetch := func(capabilities string) (int, TaskResponse) {
+		req, err := http.NewRequest("GET", "/internal/task", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(AGENT_CAPABILITIES_HEADER, capabilities)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		var resp TaskResponse
+		if recorder.Code == http.StatusOK {
+			if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return recorder.Code, resp
+	}
+
+	if code, _ := fetch(""); code != http.StatusNotFound {
+		t.Fatalf("Expected agents without the complex capability to get no task, got %d", code)
+	}
+	code, resp := fetch(COMPLEX_CAPABILITY)
+	if code != http.StatusOK {
+		t.Fatalf("Expected a task, got %d", code)
+	}
+	expected := []ComplexValue{{Re: 3}, {Im: 4}}
+	if resp.Task.Operation != "+" || len(resp.Task.ComplexArgs) != 2 || resp.Task.ComplexArgs[0] != expected[0] || resp.Task.ComplexArgs[1] != expected[1] {
+		t.Fatalf("Unexpected task %+v", resp.Task)
+	}
+	if recorder := postResult(t, router, `{"id":"`+resp.Task.ID+`","result":3,"imag":4}`); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	_, resp = fetch(COMPLEX_CAPABILITY)
+	expected = []ComplexValue{{Re: 3, Im: 4}, {Re: 2}}
+	if resp.Task.Operation != "*" || len(resp.Task.ComplexArgs) != 2 || resp.Task.ComplexArgs[0] != expected[0] || resp.Task.ComplexArgs[1] != expected[1] {
+		t.Fatalf("Unexpected task %+v", resp.Task)
+	}
+	if recorder := postResult(t, router, `{"id":"`+resp.Task.ID+`","result":6,"imag":8}`); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	expr.CompletedAt = nil
+	body, err := json.Marshal(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"id":"1","expression":"(3+4i)*2","status":"completed","complex_result":{"re":6,"im":8}}` {
+		t.Errorf("Unexpected expression %s", body)
+	}
+}
+
+func TestHandlePostTaskRequest_NegativeSqrt(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	expr := submitExpression(t, orchestrator, "1", "sqrt(-4)")
+	task := orchestrator.taskQueue.PopFront().(*Task)
+	if recorder := postResult(t, router, `{"id":"`+task.ID+`","result":0,"imag":2}`); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if expr.Status != "completed" || expr.ComplexResult == nil || *expr.ComplexResult != (ComplexValue{Im: 2}) {
+		t.Errorf("Expected 2i, got %+v", expr)
+	}
+}
+
+func TestScheduleTasks_RealTaskWithComplexResult(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	expr := submitExpression(t, orchestrator, "1", "sqrt(-4)*sqrt(-4)")
+	task := orchestrator.taskQueue.PopFront().(*Task)
+	if task.Operation != "sqrt" || len(task.ComplexArgs) != 0 || task.Args[0] != -4 {
+		t.Fatalf("Expected a real sqrt task, got %+v", task)
+	}
+	if orchestrator.taskQueue.Len() != 0 {
+		t.Fatalf("Expected the second sqrt to follow the first, got %d queued", orchestrator.taskQueue.Len())
+	}
+	if recorder := postResult(t, router, `{"id":"`+task.ID+`","result":0,"imag":2}`); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	task = orchestrator.taskQueue.PopFront().(*Task)
+	if task.Operation != "*" || len(task.ComplexArgs) != 2 || task.ComplexArgs[0] != (ComplexValue{Im: 2}) {
+		t.Fatalf("Expected a complex product, got %+v", task)
+	}
+	if recorder := postResult(t, router, `{"id":"`+task.ID+`","result":-4}`); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if expr.Status != "completed" || expr.Result == nil || *expr.Result != -4 || expr.ComplexResult != nil {
+		t.Errorf("Expected real result -4, got %+v", expr)
+	}
+}
+
+func TestScheduleTasks_ComplexResultVerification(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	submitExpression(t, orchestrator, "1", "2i*2")
+	task := orchestrator.taskQueue.PopFront().(*Task)
+	if recorder := postResult(t, router, `{"id":"`+task.ID+`","result":0,"imag":5}`); recorder.Code != http.StatusInternalServerError {
+		t.Errorf("Expected a wrong complex result to fail verification, got %d", recorder.Code)
+	}
+}
+
+func TestAgent_Compute(t *testing.T) {
+	agent := NewAgent()
+	tests := []struct {
+		op          string
+		args        []float64
+		complexArgs []ComplexValue
+		expected    complex128
+		wantErr     bool
+	}{
+		{"+", []float64{1, 2}, nil, 3, false},
+		{"sqrt", []float64{-1}, nil, 1i, false},
+		{"*", nil, []ComplexValue{{Re: 3, Im: 4}, {Re: 3, Im: -4}}, 25, false},
+		{"abs", nil, []ComplexValue{{Re: 3, Im: 4}}, 5, false},
+		{"/", []float64{1, 0}, nil, 0, true},
+		{"sum", nil, []ComplexValue{{Im: 1}}, 0, true},
+	}
+	for _, test := range tests {
+		result, err := agent.compute(test.op, test.args, test.complexArgs)
+		if (err != nil) != test.wantErr {
+			t.Errorf("compute(%s, %v, %v): unexpected error %v", test.op, test.args, test.complexArgs, err)
+			continue
+		}
+		if err == nil && result != test.expected {
+			t.Errorf("compute(%s, %v, %v) = %v, want %v", test.op, test.args, test.complexArgs, result, test.expected)
+		}
+	}
+
+	agent.Capabilities = nil
+	if _, err := agent.compute("sqrt", []float64{-1}, nil); err == nil {
+		t.Errorf("Expected agents without the complex capability to report sqrt(-1)")
+	}
+}
@@ -0,0 +1,92 @@
+package app
+
+import "errors"
+
+const (
+	// CONDITIONAL is the operator of c?a:b. The node holds the condition in
+	// Left and a BRANCHES node with both branches in Right.
+	CONDITIONAL = "?"
+	BRANCHES    = ":"
+	// IF is the function form of the conditional, if(c,a,b).
+	IF = "if"
+	// NOT is the logical negation !x.
+	NOT = "!"
+)
+
+var errCondition = errors.New("condition must be a real number")
+
+func newConditional(condition, then, otherwise *ASTNode) *ASTNode {
+	return &ASTNode{
+		Operator: CONDITIONAL,
+		Left:     condition,
+		Right:    &ASTNode{Operator: BRANCHES, Left: then, Right: otherwise},
+	}
+}
+
+func isConditional(node *ASTNode) bool {
+	return isOperation(node) && node.Operator == CONDITIONAL
+}
+
+func isBranches(node *ASTNode) bool {
+	return isOperation(node) && node.Operator == BRANCHES
+}
+
+// isShortCircuit reports whether the node is a && b or a || b, whose right
+// operand is only computed when the left one does not decide the result.
+func isShortCircuit(node *ASTNode) bool {
+	return isOperation(node) && (node.Operator == "&&" || node.Operator == "||")
+}
+
+// isControl reports whether the orchestrator evaluates the node itself
+// instead of sending it to an agent.
+func isControl(node *ASTNode) bool {
+	return isConditional(node) || isShortCircuit(node)
+}
+
+func truthValue(truthy bool) float64 {
+	if truthy {
+		return 1
+	}
+	return 0
+}
+
+// condition returns the truth of a computed operand of a conditional or a
+// logical operator, which must be a real number.
+func condition(node *ASTNode) (bool, error) {
+	if node.Imag != 0 || node.Matrix != nil {
+		return false, errCondition
+	}
+	return node.Value != 0, nil
+}
+
+// decide replaces a control node whose deciding operands are computed: a
+// conditional by its taken branch, a logical operator by its value. It
+// reports false while the operand it waits for is still being computed.
+func decide(node *ASTNode) (bool, error) {
+	if !node.Left.IsLeaf {
+		return false, nil
+	}
+	left, err := condition(node.Left)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case isConditional(node):
+		branch := node.Right.Right
+		if left {
+			branch = node.Right.Left
+		}
+		*node = *branch
+	case left == (node.Operator == "||"):
+		*node = ASTNode{IsLeaf: true, Value: truthValue(left)}
+	case node.Right.IsLeaf:
+		right, err := condition(node.Right)
+		if err != nil {
+			return false, err
+		}
+		*node = ASTNode{IsLeaf: true, Value: truthValue(right)}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,164 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseAST_Conditional(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 < 2", "1<2"},
+		{"1+1 >= 2*3", "1+1>=2*3"},
+		{"1 == 2 || 3 != 4 && !5", "1==2||3!=4&&!(5)"},
+		{"(1 || 0) && 1", "(1||0)&&1"},
+		{"1 > 2 ? 3 : 4", "1>2?3:4"},
+		{"1 ? 0 ? 1 : 2 : 3", "1?0?1:2:3"},
+		{"(1 ? 2 : 3) ? 4 : 5", "(1?2:3)?4:5"},
+		{"(1 ? 2 : 3) + 1", "(1?2:3)+1"},
+		{"if(1 < 2, 3, 4) * 2", "(1<2?3:4)*2"},
+		{"min(1 ? 2 : 3, 4)", "min(1?2:3,4)"},
+	}
+	for _, test := range tests {
+		if test.expected == "" {
+			continue
+		}
+		ast, err := ParseAST(test.input)
+		if err != nil {
+			t.Errorf("ParseAST(%q): unexpected error %v", test.input, err)
+			continue
+		}
+		if got := ast.String(); got != test.expected {
+			t.Errorf("ParseAST(%q).String() = %q, want %q", test.input, got, test.expected)
+		}
+		if again, err := ParseAST(test.expected); err != nil || again.String() != test.expected {
+			t.Errorf("ParseAST(%q) does not round trip: %v, %v", test.expected, again, err)
+		}
+	}
+	for _, input := range []string{"1 ?", "1 ? 2", "1 : 2", "if(1, 2)", "1 <", "!"} {
+		if _, err := ParseAST(input); err == nil {
+			t.Errorf("ParseAST(%q): expected an error", input)
+		}
+	}
+	if _, err := ParseFunctionDefinition("if(x) = x"); err == nil {
+		t.Errorf("Expected if to be reserved")
+	}
+}
+
+func TestScheduleTasks_ConditionalDispatchesTakenBranch(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	expr := submitExpression(t, orchestrator, "1", "(1.5*2 > 2.5) ? 2.5*3 : sqrt(2.25)")
+	task := orchestrator.taskQueue.PopFront().(*Task)
+	if task.Operation != "*" || orchestrator.taskQueue.Len() != 0 {
+		t.Fatalf("Expected only the condition's operand first, got %+v and %d queued", task, orchestrator.taskQueue.Len())
+	}
+	if recorder := postResult(t, router, `{"id":"`+task.ID+`","result":3}`); recorder.Code != 200 {
+		t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	task = orchestrator.taskQueue.PopFront().(*Task)
+	if task.Operation != ">" || orchestrator.taskQueue.Len() != 0 {
+		t.Fatalf("Expected the comparison before any branch, got %+v", task)
+	}
+	if recorder := postResult(t, router, `{"id":"`+task.ID+`","result":1}`); recorder.Code != 200 {
+		t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	task = orchestrator.taskQueue.PopFront().(*Task)
+	if task.Operation != "*" || task.Arg1 != 2.5 || orchestrator.taskQueue.Len() != 0 {
+		t.Fatalf("Expected only the taken branch, got %+v and %d queued", task, orchestrator.taskQueue.Len())
+	}
+	if recorder := postResult(t, router, `{"id":"`+task.ID+`","result":7.5}`); recorder.Code != 200 {
+		t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if expr.Status != "completed" || *expr.Result != 7.5 {
+		t.Errorf("Expected 7.5, got %+v", expr)
+	}
+}
+
+func TestScheduleTasks_ShortCircuit(t *testing.T) {
+	tests := []struct {
+		expression string
+		tasks      int
+		expected   float64
+	}{
+		// The right operands would divide by zero if they were computed.
+		{"(1.5 > 2) && (1/0 > 1)", 1, 0},
+		{"(1.5 < 2) || (1/0 > 1)", 1, 1},
+		{"(1.5 < 2) && (2.5 > 1)", 2, 1},
+		{"!(1.5 > 2) || 0", 2, 1},
+		{"if(2.5 > 1, 1.5*2, 1/0)", 2, 3},
+		{"if(0.5 > 1, 1/0, 1.5*2) + 1", 3, 4},
+	}
+	for i, test := range tests {
+		orchestrator := NewOrchestrator()
+		router := gin.Default()
+		router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+		expr := submitExpression(t, orchestrator, string(rune('1'+i)), test.expression)
+		if tasks := runMatrixTasks(t, orchestrator, router); tasks != test.tasks {
+			t.Errorf("%s: expected %d tasks, got %d", test.expression, test.tasks, tasks)
+		}
+		if expr.Status != "completed" || expr.Result == nil || *expr.Result != test.expected {
+			t.Errorf("%s: expected %v, got %+v", test.expression, test.expected, expr)
+		}
+	}
+}
+
+func TestScheduleTasks_ConditionMustBeReal(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	expr := submitExpression(t, orchestrator, "1", "2i ? 1 : 2")
+	if expr.Status != "failed" || expr.Error != errCondition.Error() {
+		t.Errorf("Expected a failed expression, got %+v", expr)
+	}
+}
+
+func TestUnitOf_Conditional(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{"2 m > 150 cm ? 1 s : 2 s", "s", ""},
+		{"1 ? 2 m : 3 s", "", "branches of a conditional have different units: m and s"},
+		{"1 m ? 1 : 2", "", "condition must be dimensionless, got m"},
+		{"1 m < 2 s", "", "cannot compare m and s"},
+		{"1 m && 1", "", "&& expects dimensionless operands, got m"},
+	}
+	for _, test := range tests {
+		ast, err := ParseAST(test.input)
+		if err != nil {
+			t.Fatalf("ParseAST(%q): %v", test.input, err)
+		}
+		unit, err := unitOf(ast)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("unitOf(%q): expected error %q, got %v", test.input, test.err, err)
+			}
+			continue
+		}
+		if err != nil || unit.String() != test.expected {
+			t.Errorf("unitOf(%q) = %q, %v, want %q", test.input, unit, err, test.expected)
+		}
+	}
+}
+
+func TestOptimize_FoldsConditional(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.Config.Optimizer.FoldCostThreshold = 1000
+	ast, err := ParseAST("1 < 2 ? 3 : 1/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countOperations(ast); n != 2 {
+		t.Errorf("Expected 2 operations, got %d", n)
+	}
+	ast, _ = orchestrator.Optimize(ast, false)
+	if !ast.IsLeaf || ast.Value != 3 {
+		t.Errorf("Expected the conditional to fold to 3, got %s", ast)
+	}
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"Yandex_Calc_V2.0/internal/matrix"
+)
+
+// TaskFollower is an AST node of another expression that waits for the
+// result of an identical task instead of scheduling its own.
+type TaskFollower struct {
+	ExprID string
+	Node   *ASTNode
+}
+
+type SharingStats struct {
+	CacheHits    int64 `json:"cache_hits"`
+	Deduplicated int64 `json:"deduplicated"`
+}
+
+func resultKey(op string, args ...float64) string {
+	var key strings.Builder
+	key.WriteString(op)
+	for _, arg := range args {
+		fmt.Fprintf(&key, "|%x", math.Float64bits(arg))
+	}
+	return key.String()
+}
+
+func (t *Task) waiters() []TaskFollower {
+	waiters := make([]TaskFollower, 0, len(t.Followers)+1)
+	if t.Node != nil {
+		waiters = append(waiters, TaskFollower{ExprID: t.ExprID, Node: t.Node})
+	}
+	return append(waiters, t.Followers...)
+}
+
+func (t *Task) exprIDs() []string {
+	seen := make(map[string]bool)
+	ids := make([]string, 0, len(t.Followers)+1)
+	for _, waiter := range t.waiters() {
+		if !seen[waiter.ExprID] {
+			seen[waiter.ExprID] = true
+			ids = append(ids, waiter.ExprID)
+		}
+	}
+	return ids
+}
+
+// detach removes every waiter of the expression from the task, promoting a
+// follower to the primary waiter if needed. It reports whether the task had
+// such waiters and is now left without any.
+func (t *Task) detach(exprID string) bool {
+	touched := false
+	followers := t.Followers[:0]
+	for _, follower := range t.Followers {
+		if follower.ExprID == exprID {
+			touched = true
+			continue
+		}
+		followers = append(followers, follower)
+	}
+	t.Followers = followers
+	if t.ExprID == exprID && t.Node != nil {
+		touched = true
+		t.ExprID, t.Node = "", nil
+		if len(t.Followers) > 0 {
+			t.ExprID, t.Node = t.Followers[0].ExprID, t.Followers[0].Node
+			t.Followers = t.Followers[1:]
+		}
+	}
+	return touched && t.Node == nil
+}
+
+// shareTask resolves a ready node from the result cache or attaches it to an
+// identical pending task. It reports whether the node needs no task of its own.
+func (o *Orchestrator) shareTask(expr *Expression, node *ASTNode, key string) bool {
+	if cached, ok := o.resultCache.Get(key); ok {
+		switch value := cached.(type) {
+		case complex128:
+			node.setComplex(value)
+		case *matrix.Matrix:
+			node.setMatrix(value)
+		default:
+			node.setComplex(complex(value.(float64), 0))
+		}
+		o.sharingStats.CacheHits++
+		return true
+	}
+	if !o.Config.DeduplicateTasks {
+		return false
+	}
+	task, ok := o.pendingTasks[key]
+	if !ok {
+		return false
+	}
+	task.Followers = append(task.Followers, TaskFollower{ExprID: expr.ID, Node: node})
+	node.TaskScheduled = true
+	o.sharingStats.Deduplicated++
+	return true
+}
+
+func (o *Orchestrator) forgetTask(task *Task) {
+	if task.Key != "" && o.pendingTasks[task.Key] == task {
+		delete(o.pendingTasks, task.Key)
+	}
+}
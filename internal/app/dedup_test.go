@@ -0,0 +1,134 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func submitExpression(t *testing.T, o *Orchestrator, id, text string) *Expression {
+	t.Helper()
+	ast, err := ParseAST(text)
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %v", text, err)
+	}
+	expr := &Expression{ID: id, Expr: text, Status: "pending", AST: ast}
+	o.expressionStore[id] = expr
+	o.scheduleTasksForExpression(expr)
+	return expr
+}
+
+func postResult(t *testing.T, router *gin.Engine, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req, err := http.NewRequest("POST", "/internal/task", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestScheduleTasks_DeduplicatesAcrossExpressions(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	first := submitExpression(t, orchestrator, "1", "(1.5*2.25)+1")
+	second := submitExpression(t, orchestrator, "2", "(1.5*2.25)+2")
+
+	if orchestrator.taskQueue.Len() != 1 {
+		t.Fatalf("Expected one shared task, got %d", orchestrator.taskQueue.Len())
+	}
+	task := orchestrator.taskQueue.PopFront().(*Task)
+	if len(task.Followers) != 1 || task.Followers[0].ExprID != "2" {
+		t.Fatalf("Expected expression 2 to follow the task, got %+v", task.Followers)
+	}
+
+	recorder := postResult(t, router, `{"id":"`+task.ID+`","result":3.375}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if orchestrator.taskQueue.Len() != 2 {
+		t.Fatalf("Expected a follow-up task per expression, got %d", orchestrator.taskQueue.Len())
+	}
+	for orchestrator.taskQueue.Len() > 0 {
+		next := orchestrator.taskQueue.PopFront().(*Task)
+		postResult(t, router, `{"id":"`+next.ID+`","result":`+map[string]string{"1": "4.375", "2": "5.375"}[next.ExprID]+`}`)
+	}
+	if first.Status != "completed" || *first.Result != 4.375 {
+		t.Errorf("Expected first expression to complete with 4.375, got %s %v", first.Status, first.Result)
+	}
+	if second.Status != "completed" || *second.Result != 5.375 {
+		t.Errorf("Expected second expression to complete with 5.375, got %s %v", second.Status, second.Result)
+	}
+	if len(orchestrator.pendingTasks) != 0 {
+		t.Errorf("Expected no pending shared tasks, got %d", len(orchestrator.pendingTasks))
+	}
+}
+
+func TestScheduleTasks_ResultCache(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.resultCache.Put(resultKey("*", 1.5, 2.25), 3.375)
+	orchestrator.resultCache.Put(resultKey("+", 3.375, 1), 4.375)
+
+	partial := submitExpression(t, orchestrator, "1", "(1.5*2.25)*2")
+	if orchestrator.taskQueue.Len() != 1 {
+		t.Fatalf("Expected only the uncached task, got %d", orchestrator.taskQueue.Len())
+	}
+	task := orchestrator.taskQueue.Front().(*Task)
+	if task.Arg1 != 3.375 || task.Arg2 != 2 || task.Operation != "*" {
+		t.Errorf("Unexpected task %+v", task)
+	}
+	if partial.Status != "pending" {
+		t.Errorf("Expected pending expression, got %s", partial.Status)
+	}
+
+	cached := submitExpression(t, orchestrator, "2", "(1.5*2.25)+1")
+	if err := orchestrator.completeExpression(cached); err != nil {
+		t.Errorf("Unexpected verification error: %v", err)
+	}
+	if cached.Status != "completed" || *cached.Result != 4.375 {
+		t.Errorf("Expected fully cached expression to complete with 4.375, got %s %v", cached.Status, cached.Result)
+	}
+	if orchestrator.sharingStats.CacheHits != 3 {
+		t.Errorf("Expected 3 cache hits, got %d", orchestrator.sharingStats.CacheHits)
+	}
+}
+
+func TestDropTasks_PromotesFollower(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	first := submitExpression(t, orchestrator, "1", "(2*3)+1")
+	second := submitExpression(t, orchestrator, "2", "(2*3)+2")
+	task := orchestrator.taskQueue.Front().(*Task)
+
+	orchestrator.cancelExpression(first)
+
+	if orchestrator.taskQueue.Len() != 1 {
+		t.Fatalf("Expected the shared task to stay queued, got %d", orchestrator.taskQueue.Len())
+	}
+	if task.ExprID != "2" || task.Node != second.AST.Left || len(task.Followers) != 0 {
+		t.Errorf("Expected expression 2 to become the primary waiter, got %+v", task)
+	}
+
+	orchestrator.taskQueue.PopFront()
+	postResult(t, router, `{"id":"`+task.ID+`","result":6}`)
+	if first.AST.Left.IsLeaf || first.Status != "cancelled" {
+		t.Errorf("Expected cancelled expression to be left untouched, got %s", first.Status)
+	}
+	if !second.AST.Left.IsLeaf {
+		t.Errorf("Expected the shared result to reach expression 2")
+	}
+
+	orchestrator.cancelExpression(second)
+	if orchestrator.taskQueue.Len() != 0 || len(orchestrator.taskStorage) != 0 {
+		t.Errorf("Expected all tasks to be dropped, got %d queued and %d stored", orchestrator.taskQueue.Len(), len(orchestrator.taskStorage))
+	}
+}
@@ -0,0 +1,477 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"Yandex_Calc_V2.0/internal/ops"
+	"github.com/gin-gonic/gin"
+)
+
+var errNotDifferentiable = errors.New("cannot differentiate")
+
+func number(value float64) *ASTNode {
+	return &ASTNode{IsLeaf: true, Value: value}
+}
+
+func binaryNode(op string, left, right *ASTNode) *ASTNode {
+	return &ASTNode{Operator: op, Left: left, Right: right}
+}
+
+func callNode(fn string, arg *ASTNode) *ASTNode {
+	return &ASTNode{Operator: fn, Left: arg}
+}
+
+// hasVariable reports whether a leaf of the subtree is a variable.
+func hasVariable(node *ASTNode) bool {
+	if node == nil {
+		return false
+	}
+	if node.IsLeaf {
+		return node.Variable != ""
+	}
+	return hasVariable(node.Left) || hasVariable(node.Right)
+}
+
+// derivatives of the functions of one argument u, to be multiplied by u'.
+var derivatives = map[string]func(u *ASTNode) *ASTNode{
+	"sin": func(u *ASTNode) *ASTNode { return callNode("cos", u) },
+	"cos": func(u *ASTNode) *ASTNode { return binaryNode("-", number(0), callNode("sin", u)) },
+	"tan": func(u *ASTNode) *ASTNode {
+		return binaryNode("/", number(1), binaryNode("^", callNode("cos", u), number(2)))
+	},
+	"arcsin": func(u *ASTNode) *ASTNode {
+		return binaryNode("/", number(1), callNode("sqrt", binaryNode("-", number(1), binaryNode("^", u, number(2)))))
+	},
+	"arccos": func(u *ASTNode) *ASTNode {
+		return binaryNode("/", number(-1), callNode("sqrt", binaryNode("-", number(1), binaryNode("^", u, number(2)))))
+	},
+	"arctan": func(u *ASTNode) *ASTNode {
+		return binaryNode("/", number(1), binaryNode("+", number(1), binaryNode("^", u, number(2))))
+	},
+	"ln": func(u *ASTNode) *ASTNode { return binaryNode("/", number(1), u) },
+	"sqrt": func(u *ASTNode) *ASTNode {
+		return binaryNode("/", number(1), binaryNode("*", number(2), callNode("sqrt", u)))
+	},
+	"abs": func(u *ASTNode) *ASTNode { return binaryNode("/", u, callNode("abs", u)) },
+}
+
+// derive returns the derivative of node with respect to its variable leaves.
+// The result shares subtrees with node and is not simplified.
+func derive(node *ASTNode) (*ASTNode, error) {
+	if !hasVariable(node) {
+		if node.Matrix != nil || hasImaginary(node) {
+			return nil, fmt.Errorf("%w %s", errNotDifferentiable, node)
+		}
+		return number(0), nil
+	}
+	if node.IsLeaf {
+		return number(1), nil
+	}
+	if isLogical(node) {
+		// Comparisons and logical operators are 0 or 1, constant apart
+		// from the jumps.
+		return number(0), nil
+	}
+	if isConditional(node) {
+		// The derivative of a conditional is the derivative of the branch
+		// taken.
+		then, err := derive(node.Right.Left)
+		if err != nil {
+			return nil, err
+		}
+		otherwise, err := derive(node.Right.Right)
+		if err != nil {
+			return nil, err
+		}
+		return newConditional(node.Left, then, otherwise), nil
+	}
+	if isCall(node) {
+		rule, ok := derivatives[node.Operator]
+		if !ok {
+			return nil, fmt.Errorf("%w %s", errNotDifferentiable, node.Operator)
+		}
+		du, err := derive(node.Left)
+		if err != nil {
+			return nil, err
+		}
+		return binaryNode("*", rule(node.Left), du), nil
+	}
+	u, v := node.Left, node.Right
+	if !isOperation(node) {
+		return nil, fmt.Errorf("%w %s", errNotDifferentiable, node)
+	}
+	du, err := derive(u)
+	if err != nil {
+		return nil, err
+	}
+	dv, err := derive(v)
+	if err != nil {
+		return nil, err
+	}
+	switch node.Operator {
+	case "+", "-":
+		return binaryNode(node.Operator, du, dv), nil
+	case "*":
+		return binaryNode("+", binaryNode("*", du, v), binaryNode("*", u, dv)), nil
+	case "/":
+		return binaryNode("/",
+			binaryNode("-", binaryNode("*", du, v), binaryNode("*", u, dv)),
+			binaryNode("^", v, number(2))), nil
+	case "^":
+		switch {
+		case !hasVariable(v):
+			// (u^n)' = n*u^(n-1)*u'
+			return binaryNode("*", binaryNode("*", v, binaryNode("^", u, binaryNode("-", v, number(1)))), du), nil
+		case !hasVariable(u):
+			// (a^v)' = a^v*ln(a)*v'
+			return binaryNode("*", binaryNode("*", node, callNode("ln", u)), dv), nil
+		}
+		// (u^v)' = u^v*(v'*ln(u) + v*u'/u)
+		return binaryNode("*", node, binaryNode("+",
+			binaryNode("*", dv, callNode("ln", u)),
+			binaryNode("/", binaryNode("*", v, du), u))), nil
+	}
+	return nil, fmt.Errorf("%w %s", errNotDifferentiable, node.Operator)
+}
+
+func isLogical(node *ASTNode) bool {
+	if isCall(node) {
+		return node.Operator == NOT
+	}
+	infix, ok := ops.LookupKind(node.Operator, ops.Infix)
+	return ok && infix.Precedence <= 0
+}
+
+// simplify folds constant subtrees, removes the neutral elements the rules of
+// derive leave behind, like 0*x, x*1 and x^1, combines like terms of sums and
+// multiplies powers of the same base.
+func simplify(node *ASTNode) *ASTNode {
+	if node == nil || node.IsLeaf {
+		return node
+	}
+	if isConditional(node) {
+		then, otherwise := simplify(node.Right.Left), simplify(node.Right.Right)
+		return newConditional(simplify(node.Left), then, otherwise)
+	}
+	simplified := &ASTNode{Operator: node.Operator, Left: simplify(node.Left), Right: simplify(node.Right)}
+	if !hasVariable(simplified) && !hasImaginary(simplified) && !hasMatrix(simplified) && !hasUnits(simplified) {
+		if value, err := evaluateLocally(simplified); err == nil && isFinite(value) {
+			return number(value)
+		}
+	}
+	if !isOperation(simplified) {
+		return simplified
+	}
+	u, v := simplified.Left, simplified.Right
+	switch simplified.Operator {
+	case "+", "-":
+		return combineTerms(simplified)
+	case "*":
+		switch {
+		case isConstant(u, 0) || isConstant(v, 0):
+			return number(0)
+		case isConstant(u, 1):
+			return v
+		case isConstant(v, 1):
+			return u
+		case isConstantLeaf(v) && !isConstantLeaf(u):
+			// Constants go first: x*2 is 2*x.
+			return simplify(binaryNode("*", v, u))
+		case isConstantLeaf(u) && isOperation(v) && v.Operator == "*" && isConstantLeaf(v.Left):
+			// 2*(3*x) is 6*x.
+			return simplify(binaryNode("*", number(u.Value*v.Left.Value), v.Right))
+		case sameBase(u, v):
+			// x*x is x^2 and x^2*x is x^3.
+			base, m := power(u)
+			_, n := power(v)
+			return simplify(binaryNode("^", base, number(m+n)))
+		case isOperation(u) && u.Operator == "*" && isConstantLeaf(u.Left) && sameBase(u.Right, v):
+			// (2*x)*x is 2*x^2.
+			return simplify(binaryNode("*", u.Left, binaryNode("*", u.Right, v)))
+		}
+	case "/":
+		switch {
+		case isConstant(u, 0):
+			return number(0)
+		case isConstant(v, 1):
+			return u
+		}
+	case "^":
+		switch {
+		case isConstant(v, 0):
+			return number(1)
+		case isConstant(v, 1):
+			return u
+		}
+	}
+	return simplified
+}
+
+// addend is coefficient*node; node is nil for a constant.
+type addend struct {
+	coefficient float64
+	node        *ASTNode
+}
+
+// collectTerms appends the addends of a sum to terms, adding up the
+// coefficients of like terms, and returns the sum of its constants.
+func collectTerms(node *ASTNode, sign float64, terms *[]addend) float64 {
+	if isOperation(node) && (node.Operator == "+" || node.Operator == "-") {
+		right := sign
+		if node.Operator == "-" {
+			right = -sign
+		}
+		return collectTerms(node.Left, sign, terms) + collectTerms(node.Right, right, terms)
+	}
+	if isConstantLeaf(node) {
+		return sign * node.Value
+	}
+	coefficient, node := splitCoefficient(node)
+	coefficient *= sign
+	key := node.String()
+	for i := range *terms {
+		if (*terms)[i].node.String() == key {
+			(*terms)[i].coefficient += coefficient
+			return 0
+		}
+	}
+	*terms = append(*terms, addend{coefficient, node})
+	return 0
+}
+
+// combineTerms rebuilds a sum from its combined terms, with the constant
+// last: x+1-x is 1 and x+x is 2*x.
+func combineTerms(node *ASTNode) *ASTNode {
+	var terms []addend
+	if constant := collectTerms(node, 1, &terms); constant != 0 {
+		terms = append(terms, addend{coefficient: constant})
+	}
+	var sum *ASTNode
+	for _, term := range terms {
+		magnitude := math.Abs(term.coefficient)
+		next := number(magnitude)
+		switch {
+		case term.coefficient == 0:
+			continue
+		case term.node == nil && sum == nil:
+			next = number(term.coefficient)
+		case term.node != nil && magnitude == 1:
+			next = term.node
+		case term.node != nil:
+			next = withCoefficient(magnitude, term.node)
+		}
+		switch {
+		case sum == nil && (term.coefficient > 0 || term.node == nil):
+			sum = next
+		case sum == nil:
+			sum = binaryNode("-", number(0), next)
+		case term.coefficient < 0:
+			sum = binaryNode("-", sum, next)
+		default:
+			sum = binaryNode("+", sum, next)
+		}
+	}
+	if sum == nil {
+		return number(0)
+	}
+	return sum
+}
+
+// splitCoefficient splits the constant first factor off a product: 2*x*y is
+// 2 and x*y.
+func splitCoefficient(node *ASTNode) (float64, *ASTNode) {
+	if !isOperation(node) || node.Operator != "*" {
+		return 1, node
+	}
+	if isConstantLeaf(node.Left) {
+		return node.Left.Value, node.Right
+	}
+	coefficient, rest := splitCoefficient(node.Left)
+	if coefficient == 1 {
+		return 1, node
+	}
+	return coefficient, binaryNode("*", rest, node.Right)
+}
+
+// withCoefficient is the inverse of splitCoefficient.
+func withCoefficient(coefficient float64, node *ASTNode) *ASTNode {
+	if isOperation(node) && node.Operator == "*" {
+		return binaryNode("*", withCoefficient(coefficient, node.Left), node.Right)
+	}
+	return binaryNode("*", number(coefficient), node)
+}
+
+// power splits node into a base and a constant exponent, which is 1 for
+// anything but a power.
+func power(node *ASTNode) (*ASTNode, float64) {
+	if isOperation(node) && node.Operator == "^" && isConstantLeaf(node.Right) {
+		return node.Left, node.Right.Value
+	}
+	return node, 1
+}
+
+func sameBase(u, v *ASTNode) bool {
+	ub, _ := power(u)
+	vb, _ := power(v)
+	return !isConstantLeaf(ub) && ub.String() == vb.String()
+}
+
+func isConstantLeaf(node *ASTNode) bool {
+	return node.IsLeaf && node.Variable == "" && node.Imag == 0 && node.Matrix == nil && node.Unit.Dimensionless()
+}
+
+func hasUnits(node *ASTNode) bool {
+	if node == nil {
+		return false
+	}
+	if node.IsLeaf {
+		return !node.Unit.Dimensionless()
+	}
+	return hasUnits(node.Left) || hasUnits(node.Right)
+}
+
+// substitute replaces the variable leaves with value.
+func substitute(node *ASTNode, value float64) *ASTNode {
+	if node == nil {
+		return nil
+	}
+	if node.IsLeaf && node.Variable != "" {
+		return number(value)
+	}
+	clone := *node
+	clone.Left = substitute(node.Left, value)
+	clone.Right = substitute(node.Right, value)
+	return &clone
+}
+
+// validVariable reports whether the name can be a variable, that is an
+// identifier that is not a function, a constant or the imaginary unit.
+func validVariable(name string) bool {
+	_, builtin := ops.LookupFunction(name)
+	_, constant := ops.LookupConstant(name)
+	return identifier_rx.MatchString(name) && !builtin && !constant && name != IF && name != "i"
+}
+
+// ExpressionNode swagger model
+// @Description Узел дерева выражения
+type ExpressionNode struct {
+	// Kind is number, variable, operator or call; a conditional is the
+	// operator ?: with three arguments.
+	Kind     string            `json:"kind" example:"operator"`
+	Value    *float64          `json:"value,omitempty" example:"2"`
+	Unit     string            `json:"unit,omitempty" example:"m"`
+	Name     string            `json:"name,omitempty" example:"x"`
+	Operator string            `json:"operator,omitempty" example:"*"`
+	Args     []*ExpressionNode `json:"args,omitempty"`
+}
+
+func newExpressionNode(node *ASTNode) *ExpressionNode {
+	switch {
+	case node.IsLeaf && node.Variable != "":
+		return &ExpressionNode{Kind: "variable", Name: node.Variable}
+	case node.IsLeaf:
+		value := node.Value
+		result := &ExpressionNode{Kind: "number", Value: &value}
+		if !node.Unit.Dimensionless() {
+			result.Unit = node.Unit.String()
+		}
+		return result
+	case isConditional(node):
+		return &ExpressionNode{Kind: "operator", Operator: CONDITIONAL + BRANCHES, Args: []*ExpressionNode{
+			newExpressionNode(node.Left), newExpressionNode(node.Right.Left), newExpressionNode(node.Right.Right),
+		}}
+	case isCall(node):
+		return &ExpressionNode{Kind: "call", Name: node.Operator, Args: []*ExpressionNode{newExpressionNode(node.Left)}}
+	}
+	return &ExpressionNode{Kind: "operator", Operator: node.Operator, Args: []*ExpressionNode{
+		newExpressionNode(node.Left), newExpressionNode(node.Right),
+	}}
+}
+
+// DeriveRequest swagger model
+// @Description Запрос производной
+type DeriveRequest struct {
+	Expression string `json:"expression" binding:"required" example:"x^2*sin(x)"`
+	Variable   string `json:"variable" binding:"required" example:"x"`
+	// At, when set, starts a calculation of the derivative at this point.
+	At              *float64 `json:"at,omitempty" example:"2"`
+	NaturalNotation bool     `json:"natural_notation,omitempty" example:"false"`
+}
+
+// DeriveResponse swagger model
+// @Description Производная выражения
+type DeriveResponse struct {
+	Derivative string          `json:"derivative" example:"2*x*sin(x)+x^2*cos(x)"`
+	AST        *ExpressionNode `json:"ast"`
+	ID         string          `json:"id,omitempty" example:"1"`
+}
+
+// @Summary Differentiate an expression
+// @Description Return the simplified derivative of an expression with respect to a variable, optionally calculating it at a point
+// @Tags calculations
+// @Accept json
+// @Produce json
+// @Param request body DeriveRequest true "Expression and variable"
+// @Success 200 {object} DeriveResponse "Derivative"
+// @Success 201 {object} DeriveResponse "Derivative and the ID of its calculation at the point"
+// @Failure 422 {object} ParseErrorResponse "Invalid expression, or an expression that cannot be differentiated"
+// @Router /derive [post]
+func (o *Orchestrator) handleDeriveRequest(c *gin.Context) {
+	if c.Request.Method != http.MethodPost {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
+		return
+	}
+	var req DeriveRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Expression == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid Body"})
+		return
+	}
+	if !validVariable(req.Variable) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid variable name"})
+		return
+	}
+	owner := userFromRequest(c)
+	options := o.parseOptions()
+	options.Natural = req.NaturalNotation
+	options.Variables = []string{req.Variable}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	ast, _, err := o.functions.Parse(owner, req.Expression, options)
+	if err != nil {
+		var parseErrors ParseErrors
+		errors.As(err, &parseErrors)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid expression", "errors": parseErrors})
+		return
+	}
+	derivative, err := derive(ast)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid expression: " + err.Error()})
+		return
+	}
+	derivative = simplify(derivative)
+	if _, err := unitOf(derivative); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Incompatible units: " + err.Error()})
+		return
+	}
+	response := DeriveResponse{Derivative: derivative.String(), AST: newExpressionNode(derivative)}
+	if req.At == nil {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	point := substitute(derivative, *req.At)
+	unit, _ := unitOf(point)
+	now := time.Now()
+	expr := &Expression{
+		Expr:      point.String(),
+		CreatedAt: &now,
+		Unit:      unit.String(),
+		Owner:     owner,
+		Options:   ParseOptions{SpecialValues: options.SpecialValues},
+	}
+	response.ID = o.startExpression(expr, point, false, false)
+	c.JSON(http.StatusCreated, response)
+}
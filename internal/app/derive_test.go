@@ -0,0 +1,159 @@
+package app
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"Yandex_Calc_V2.0/internal/eval"
+	"github.com/gin-gonic/gin"
+)
+
+func TestDerive(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x", "1"},
+		{"-x", "(-1)"},
+		{"-x*3", "(-3)"},
+		{"5", "0"},
+		{"3*x+2", "3"},
+		{"x^2", "2*x"},
+		{"x^3-x", "3*x^2-1"},
+		{"2*x*x", "4*x"},
+		{"x*x*x", "3*x^2"},
+		{"x/(x+1)", "1/(x+1)^2"},
+		{"x^2*x", "3*x^2"},
+		{"3*x^2-x^2+x", "4*x+1"},
+		{"x-x+sin(x)", "cos(x)"},
+		{"2*x*sin(x)-x*sin(x)", "sin(x)+x*cos(x)"},
+		{"1/x", "(-1)/x^2"},
+		{"sin(x)", "cos(x)"},
+		{"cos(2*x)", "2*(0-sin(2*x))"},
+		{"ln(x^2+1)", "1/(x^2+1)*(2*x)"},
+		{"sqrt(x)", "1/(2*sqrt(x))"},
+		{"2^x", "0.6931471805599453*2^x"},
+		{"e^x", "2.718281828459045^x"},
+		{"x^x", "x^x*(ln(x)+x/x)"},
+		{"x > 0 ? x^2 : 0-x", "x>0?2*x:(-1)"},
+		{"x > 1", "0"},
+		{"tan(pi)", "0"},
+	}
+	options := ParseOptions{Variables: []string{"x"}}
+	for _, test := range tests {
+		ast, err := ParseASTWithOptions(test.input, options)
+		if err != nil {
+			t.Fatalf("ParseASTWithOptions(%q): %v", test.input, err)
+		}
+		derivative, err := derive(ast)
+		if err != nil {
+			t.Errorf("derive(%q): unexpected error %v", test.input, err)
+			continue
+		}
+		if got := simplify(derivative).String(); got != test.expected {
+			t.Errorf("derive(%q) = %q, want %q", test.input, got, test.expected)
+		}
+	}
+}
+
+func TestDerive_Errors(t *testing.T) {
+	options := ParseOptions{Variables: []string{"x"}}
+	for _, input := range []string{"max(x, 1)", "x*i", "x!"} {
+		ast, err := ParseASTWithOptions(input, ParseOptions{Natural: true, Variables: options.Variables})
+		if err != nil {
+			t.Fatalf("ParseASTWithOptions(%q): %v", input, err)
+		}
+		if _, err := derive(ast); err == nil {
+			t.Errorf("derive(%q): expected an error", input)
+		}
+	}
+	if _, err := ParseASTWithOptions("det([[x,1],[1,x]])", options); err == nil {
+		t.Error("Expected variables in a matrix to be rejected")
+	}
+}
+
+// TestDerive_Numerically compares derivatives with difference quotients.
+func TestDerive_Numerically(t *testing.T) {
+	inputs := []string{"x^3*sin(x)", "arctan(x)/x", "sqrt(x^2+1)*ln(x)", "arcsin(x/2)+arccos(x/3)", "x^x", "abs(x-2)*e^x"}
+	options := ParseOptions{Variables: []string{"x"}}
+	const point, h = 1.3, 1e-6
+	at := func(node *ASTNode, x float64) float64 {
+		value, err := eval.EvalComplex(substitute(node, x).String())
+		if err != nil {
+			t.Fatalf("eval %s at %v: %v", node, x, err)
+		}
+		return real(value)
+	}
+	for _, input := range inputs {
+		ast, err := ParseASTWithOptions(input, options)
+		if err != nil {
+			t.Fatalf("ParseASTWithOptions(%q): %v", input, err)
+		}
+		derivative, err := derive(ast)
+		if err != nil {
+			t.Fatalf("derive(%q): %v", input, err)
+		}
+		got := at(simplify(derivative), point)
+		want := (at(ast, point+h) - at(ast, point-h)) / (2 * h)
+		if math.Abs(got-want) > 1e-5*math.Max(1, math.Abs(want)) {
+			t.Errorf("derivative of %s at %v: got %v, want %v", input, point, got, want)
+		}
+	}
+}
+
+func TestHandleDeriveRequest(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/api/v1/derive", orchestrator.handleDeriveRequest)
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		expected string
+	}{
+		{"Derivative", `{"expression":"2*y+5","variable":"y"}`, http.StatusOK, `{"derivative":"2","ast":{"kind":"number","value":2}}`},
+		{"AST", `{"expression":"3*t^2","variable":"t"}`, http.StatusOK, `{"derivative":"6*t","ast":{"kind":"operator","operator":"*","args":[{"kind":"number","value":6},{"kind":"variable","name":"t"}]}}`},
+		{"Natural", `{"expression":"3x^2","variable":"x","natural_notation":true}`, http.StatusOK, `{"derivative":"6*x","ast":{"kind":"operator","operator":"*","args":[{"kind":"number","value":6},{"kind":"variable","name":"x"}]}}`},
+		{"Unknown Identifier", `{"expression":"x+y","variable":"x"}`, http.StatusUnprocessableEntity, `{"error":"Invalid expression","errors":[{"code":"unknown_identifier","message":"unknown identifier y","offset":2,"column":3,"snippet":"x+y\n  ^"}]}`},
+		{"Not Differentiable", `{"expression":"min(x,1)","variable":"x"}`, http.StatusUnprocessableEntity, `{"error":"Invalid expression: cannot differentiate min"}`},
+		{"Invalid Variable", `{"expression":"sin(x)","variable":"sin"}`, http.StatusUnprocessableEntity, `{"error":"Invalid variable name"}`},
+		{"Missing Variable", `{"expression":"x"}`, http.StatusUnprocessableEntity, `{"error":"Invalid Body"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/derive", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			if recorder.Code != test.status || recorder.Body.String() != test.expected {
+				t.Errorf("Expected %d %s, got %d %s", test.status, test.expected, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/derive", strings.NewReader(`{"expression":"x^3","variable":"x","at":2}`))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var response DeriveResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Derivative != "3*x^2" || response.ID == "" {
+		t.Fatalf("Unexpected response %+v", response)
+	}
+	runMatrixTasks(t, orchestrator, router)
+	expr := orchestrator.expressionStore[response.ID]
+	if expr.Expr != "3*2^2" || expr.Status != "completed" || expr.Result == nil || *expr.Result != 12 {
+		t.Errorf("Expected 3*2^2 = 12, got %+v", expr)
+	}
+}
@@ -0,0 +1,286 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"Yandex_Calc_V2.0/internal/ops"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	FUNCTION_MAX_DEPTH = 32
+	FUNCTION_MAX_NODES = 10000
+)
+
+var function_definition_rx = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_]*)\s*\(([^()]*)\)\s*=(.*)$`)
+var identifier_rx = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// UserFunction swagger model
+// @Description Пользовательская функция
+type UserFunction struct {
+	Name   string   `json:"name" example:"hyp"`
+	Params []string `json:"params" example:"a,b"`
+	Body   string   `json:"body" example:"sqrt(a*a+b*b)"`
+}
+
+func (f *UserFunction) String() string {
+	return f.Name + "(" + strings.Join(f.Params, ",") + ") = " + f.Body
+}
+
+// ParseFunctionDefinition splits a definition like hyp(a,b) = sqrt(a*a+b*b)
+// into name, parameters and body. The body is checked by Define.
+func ParseFunctionDefinition(definition string) (*UserFunction, error) {
+	match := function_definition_rx.FindStringSubmatch(definition)
+	if match == nil {
+		return nil, fmt.Errorf("expected name(params) = body")
+	}
+	fn := &UserFunction{Name: match[1], Params: make([]string, 0), Body: strings.TrimSpace(match[3])}
+	if _, ok := ops.LookupFunction(fn.Name); ok || fn.Name == IF {
+		return nil, fmt.Errorf("%s is a built-in function", fn.Name)
+	}
+	if fn.Body == "" {
+		return nil, fmt.Errorf("empty function body")
+	}
+	seen := make(map[string]bool)
+	if params := strings.TrimSpace(match[2]); params != "" {
+		for _, param := range strings.Split(params, ",") {
+			param = strings.TrimSpace(param)
+			if !identifier_rx.MatchString(param) {
+				return nil, fmt.Errorf("invalid parameter name %q", param)
+			}
+			if seen[param] {
+				return nil, fmt.Errorf("duplicate parameter %s", param)
+			}
+			seen[param] = true
+			fn.Params = append(fn.Params, param)
+		}
+	}
+	return fn, nil
+}
+
+// FunctionRegistry keeps the user-defined functions of every user. Calls are
+// bound late: an expression uses the definitions that exist when it is
+// submitted. Methods are called with the orchestrator mutex held.
+type FunctionRegistry struct {
+	functions map[string]map[string]*UserFunction
+}
+
+func NewFunctionRegistry() *FunctionRegistry {
+	return &FunctionRegistry{functions: make(map[string]map[string]*UserFunction)}
+}
+
+func (r *FunctionRegistry) Get(owner, name string) (*UserFunction, bool) {
+	fn, ok := r.functions[owner][name]
+	return fn, ok
+}
+
+func (r *FunctionRegistry) List(owner string) []*UserFunction {
+	functions := make([]*UserFunction, 0, len(r.functions[owner]))
+	for _, fn := range r.functions[owner] {
+		functions = append(functions, fn)
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		return functions[i].Name < functions[j].Name
+	})
+	return functions
+}
+
+// Define adds or replaces a function. The body is expanded once with the new
+// definition in place, so syntax errors, unknown functions, wrong arity and
+// recursion are rejected before anything is stored.
+func (r *FunctionRegistry) Define(owner string, fn *UserFunction) error {
+	if r.functions[owner] == nil {
+		r.functions[owner] = make(map[string]*UserFunction)
+	}
+	previous, existed := r.functions[owner][fn.Name]
+	r.functions[owner][fn.Name] = fn
+	args := make([]*ASTNode, len(fn.Params))
+	for i := range args {
+		args[i] = &ASTNode{IsLeaf: true, Value: 1}
+	}
+	// Special values are checked against the options of the expression
+	// that calls the function.
+	e := &expansion{registry: r, owner: owner, options: ParseOptions{SpecialValues: true}}
+	if _, err := e.call(fn.Name, args); err != nil {
+		if existed {
+			r.functions[owner][fn.Name] = previous
+		} else {
+			delete(r.functions[owner], fn.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *FunctionRegistry) Delete(owner, name string) bool {
+	if _, ok := r.functions[owner][name]; !ok {
+		return false
+	}
+	delete(r.functions[owner], name)
+	return true
+}
+
+// Parse parses an expression of the owner, expanding calls of user-defined
+// functions into AST subtrees. expanded reports whether there were any.
+func (r *FunctionRegistry) Parse(owner, expression string, options ParseOptions) (node *ASTNode, expanded bool, err error) {
+	e := &expansion{registry: r, owner: owner, options: options}
+	node, err = e.parse(expression, nil)
+	return node, e.calls > 0, err
+}
+
+type expansion struct {
+	registry *FunctionRegistry
+	owner    string
+	options  ParseOptions
+	stack    []string
+	calls    int
+}
+
+func (e *expansion) parse(input string, params map[string]*ASTNode) (*ASTNode, error) {
+	p := newParser(input)
+	p.options = e.options
+	if params != nil {
+		// Bodies are checked at definition in the default notation and
+		// see only their parameters.
+		p.options.Natural, p.options.Variables = false, nil
+	}
+	p.params = params
+	p.call = e.call
+	return p.parse()
+}
+
+func (e *expansion) call(name string, args []*ASTNode) (*ASTNode, error) {
+	fn, ok := e.registry.Get(e.owner, name)
+	if !ok {
+		return nil, fmt.Errorf("%w %s", errUnknownFunction, name)
+	}
+	if len(args) != len(fn.Params) {
+		return nil, fmt.Errorf("function %s expects %d arguments, got %d", name, len(fn.Params), len(args))
+	}
+	for _, caller := range e.stack {
+		if caller == name {
+			return nil, fmt.Errorf("recursive call: %s calls %s", strings.Join(e.stack, " calls "), name)
+		}
+	}
+	if len(e.stack) >= FUNCTION_MAX_DEPTH {
+		return nil, fmt.Errorf("function calls nested deeper than %d", FUNCTION_MAX_DEPTH)
+	}
+	params := make(map[string]*ASTNode, len(args))
+	for i, param := range fn.Params {
+		params[param] = args[i]
+	}
+	e.stack = append(e.stack, name)
+	defer func() { e.stack = e.stack[:len(e.stack)-1] }()
+	e.calls++
+	node, err := e.parse(fn.Body, params)
+	if err != nil {
+		return nil, err
+	}
+	if countNodes(node) > FUNCTION_MAX_NODES {
+		return nil, fmt.Errorf("expansion of %s exceeds %d nodes", name, FUNCTION_MAX_NODES)
+	}
+	return node, nil
+}
+
+func countNodes(node *ASTNode) int {
+	if node == nil {
+		return 0
+	}
+	return 1 + countNodes(node.Left) + countNodes(node.Right)
+}
+
+// FunctionRequest swagger model
+// @Description Определение функции
+type FunctionRequest struct {
+	Definition string `json:"definition" binding:"required" example:"hyp(a,b) = sqrt(a*a+b*b)"`
+}
+
+// FunctionResponse swagger model
+// @Description Пользовательская функция
+type FunctionResponse struct {
+	Function UserFunction `json:"function"`
+}
+
+// FunctionsResponse swagger model
+// @Description Список пользовательских функций
+type FunctionsResponse struct {
+	Functions []UserFunction `json:"functions"`
+}
+
+// @Summary Define a function
+// @Description Define or replace a named function usable in expressions of the same user
+// @Tags functions
+// @Accept json
+// @Produce json
+// @Param definition body FunctionRequest true "Function definition"
+// @Success 201 {object} FunctionResponse
+// @Failure 422 {object} Error "Invalid function definition"
+// @Router /functions [post]
+func (o *Orchestrator) handleDefineFunctionRequest(c *gin.Context) {
+	if c.Request.Method != http.MethodPost {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
+		return
+	}
+	var req FunctionRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Definition == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid Body"})
+		return
+	}
+	fn, err := ParseFunctionDefinition(req.Definition)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid function: " + err.Error()})
+		return
+	}
+	owner := userFromRequest(c)
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if err := o.functions.Define(owner, fn); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid function: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"function": fn})
+}
+
+// @Summary List functions
+// @Description Get the functions defined by the user
+// @Tags functions
+// @Produce json
+// @Success 200 {object} FunctionsResponse
+// @Router /functions [get]
+func (o *Orchestrator) handleFunctionsRequest(c *gin.Context) {
+	if c.Request.Method != http.MethodGet {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
+		return
+	}
+	owner := userFromRequest(c)
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	c.JSON(http.StatusOK, gin.H{"functions": o.functions.List(owner)})
+}
+
+// @Summary Delete a function
+// @Description Remove a function of the user; expressions already submitted are not affected
+// @Tags functions
+// @Produce json
+// @Param name path string true "Function name"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} Error "Function not found"
+// @Router /functions/{name} [delete]
+func (o *Orchestrator) handleDeleteFunctionRequest(c *gin.Context) {
+	if c.Request.Method != http.MethodDelete {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
+		return
+	}
+	owner := userFromRequest(c)
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if !o.functions.Delete(owner, c.Param("name")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Function not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
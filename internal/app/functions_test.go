@@ -0,0 +1,182 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseFunctionDefinition(t *testing.T) {
+	fn, err := ParseFunctionDefinition("hyp(a, b) = sqrt(a*a+b*b)")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fn.Name != "hyp" || strings.Join(fn.Params, ",") != "a,b" || fn.Body != "sqrt(a*a+b*b)" {
+		t.Errorf("unexpected function %+v", fn)
+	}
+	for _, definition := range []string{"hyp(a,b)", "sqrt(x) = x", "f(a,a) = a", "f(1) = 1", "f(x) = ", "= 1"} {
+		if _, err := ParseFunctionDefinition(definition); err == nil {
+			t.Errorf("expected an error for definition %q", definition)
+		}
+	}
+}
+
+func TestFunctionRegistry_Expand(t *testing.T) {
+	registry := NewFunctionRegistry()
+	define := func(owner, definition string) error {
+		fn, err := ParseFunctionDefinition(definition)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", definition, err)
+		}
+		return registry.Define(owner, fn)
+	}
+	if err := define("alice", "sq(x) = x*x"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := define("alice", "hyp(a,b) = sqrt(sq(a)+sq(b))"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	node, expanded, err := registry.Parse("alice", "hyp(3,4)*2", ParseOptions{})
+	if err != nil || !expanded {
+		t.Fatalf("unexpected result: %v %v", expanded, err)
+	}
+	if node.String() != "sqrt(3*3+4*4)*2" {
+		t.Errorf("unexpected expansion %s", node.String())
+	}
+	if _, _, err := registry.Parse("bob", "hyp(3,4)", ParseOptions{}); err == nil {
+		t.Error("expected functions to be private to their owner")
+	}
+	if _, _, err := registry.Parse("alice", "hyp(3)", ParseOptions{}); err == nil {
+		t.Error("expected an arity error")
+	}
+	if _, expanded, err := registry.Parse("alice", "sqrt(4)+1", ParseOptions{}); err != nil || expanded {
+		t.Errorf("expected built-in call without expansion, got %v %v", expanded, err)
+	}
+
+	tests := []struct {
+		definition string
+		err        string
+	}{
+		{"loop(x) = loop(x-1)", "recursive call: loop calls loop"},
+		{"sq(x) = hyp(x,x)", "recursive call: sq calls hyp calls sq"},
+		{"f(x) = g(x)", "unknown function g"},
+		{"f(x) = x+y", "unknown identifier y"},
+	}
+	for _, tt := range tests {
+		err := define("alice", tt.definition)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("definition %q: expected error containing %q, got %v", tt.definition, tt.err, err)
+		}
+	}
+	if fn, _ := registry.Get("alice", "sq"); fn.Body != "x*x" {
+		t.Errorf("rejected redefinition replaced sq with %q", fn.Body)
+	}
+	if _, ok := registry.Get("alice", "loop"); ok {
+		t.Error("rejected definition was stored")
+	}
+
+	if err := define("alice", "d0(x) = x+x"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 20; i++ {
+		err := define("alice", "d"+strconv.Itoa(i)+"(x) = d"+strconv.Itoa(i-1)+"(x)+d"+strconv.Itoa(i-1)+"(x)")
+		if i < 12 && err != nil {
+			t.Fatalf("unexpected error for d%d: %v", i, err)
+		}
+		if i >= 12 {
+			if err == nil || !strings.Contains(err.Error(), "exceeds") {
+				t.Fatalf("expected size limit for d%d, got %v", i, err)
+			}
+			break
+		}
+	}
+}
+
+func TestFunctionsEndpoints(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/api/v1/functions", orchestrator.handleDefineFunctionRequest)
+	router.GET("/api/v1/functions", orchestrator.handleFunctionsRequest)
+	router.DELETE("/api/v1/functions/:name", orchestrator.handleDeleteFunctionRequest)
+	router.POST("/api/v1/calculate", orchestrator.handleCalculateRequest)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(USER_HEADER, "alice")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		expectedCode int
+		expectedBody string
+	}{
+		{"Define", "POST", "/api/v1/functions", `{"definition":"hyp(a,b) = sqrt(a*a+b*b)"}`, http.StatusCreated, `{"function":{"name":"hyp","params":["a","b"],"body":"sqrt(a*a+b*b)"}}`},
+		{"Invalid", "POST", "/api/v1/functions", `{"definition":"hyp(a,b)"}`, http.StatusUnprocessableEntity, `{"error":"Invalid function: expected name(params) = body"}`},
+		{"Recursive", "POST", "/api/v1/functions", `{"definition":"f(x) = f(x)"}`, http.StatusUnprocessableEntity, `{"error":"Invalid function: recursive call: f calls f"}`},
+		{"List", "GET", "/api/v1/functions", ``, http.StatusOK, `{"functions":[{"name":"hyp","params":["a","b"],"body":"sqrt(a*a+b*b)"}]}`},
+		{"Calculate", "POST", "/api/v1/calculate", `{"expression":"hyp(3,4)+1"}`, http.StatusCreated, `{"id":"1"}`},
+		{"Delete", "DELETE", "/api/v1/functions/hyp", ``, http.StatusOK, `{"status":"deleted"}`},
+		{"Delete Missing", "DELETE", "/api/v1/functions/hyp", ``, http.StatusNotFound, `{"error":"Function not found"}`},
+		{"Calculate Deleted", "POST", "/api/v1/calculate", `{"expression":"hyp(3,4)+1"}`, http.StatusUnprocessableEntity, `{"error":"Invalid expression","errors":[{"code":"unknown_function","message":"unknown function hyp","offset":0,"column":1,"snippet":"hyp(3,4)+1\n^"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := do(tt.method, tt.path, tt.body)
+			if recorder.Code != tt.expectedCode || recorder.Body.String() != tt.expectedBody {
+				t.Errorf("expected %d %s, got %d %s", tt.expectedCode, tt.expectedBody, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+
+	expr := orchestrator.expressionStore["1"]
+	if expr.Expanded != "sqrt(3*3+4*4)+1" {
+		t.Errorf("unexpected expanded expression %q", expr.Expanded)
+	}
+	task := orchestrator.taskQueue.PopFront().(*Task)
+	if task.Operation != "*" || task.Arg1 != 3 {
+		t.Errorf("expected 3*3 to be scheduled first, got %+v", task)
+	}
+}
+
+func TestScheduleTasks_FunctionCall(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.GET("/internal/task", orchestrator.handleGetTaskRequest)
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	expr := submitExpression(t, orchestrator, "1", "sqrt(16)")
+	fetch := func(capabilities string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/internal/task", nil)
+		req.Header.Set(AGENT_CAPABILITIES_HEADER, capabilities)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+	if recorder := fetch(""); recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected legacy agent to get no task, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	recorder := fetch("sqrt")
+	expected := `{"task":{"id":"1","arg1":0,"arg2":0,"args":[16],"operation":"sqrt","operation_time":222}}`
+	if recorder.Body.String() != expected {
+		t.Fatalf("expected %s, got %s", expected, recorder.Body.String())
+	}
+	postResult(t, router, `{"id":"1","result":4}`)
+	if expr.Status != "completed" || *expr.Result != 4 {
+		t.Errorf("expected expression to complete with 4, got %s %v", expr.Status, expr.Result)
+	}
+}
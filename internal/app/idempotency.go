@@ -0,0 +1,196 @@
+package app
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	IDEMPOTENCY_HEADER = "Idempotency-Key"
+	IDEMPOTENCY_WINDOW = 24 * time.Hour
+)
+
+type IdempotencyRecord struct {
+	Owner     string    `json:"owner"`
+	Key       string    `json:"key"`
+	BodyHash  string    `json:"body_hash"`
+	ExprID    string    `json:"expr_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IdempotencyStore keeps the expression IDs issued for Idempotency-Key
+// headers. Implementations are called with the orchestrator mutex held.
+type IdempotencyStore interface {
+	Get(owner, key string) (*IdempotencyRecord, bool)
+	Put(record *IdempotencyRecord) error
+	Expire(before time.Time) int
+	All() []*IdempotencyRecord
+}
+
+func idempotencyID(owner, key string) string {
+	return owner + "\x00" + key
+}
+
+func hashRequest(req *ExpressionRequest) string {
+	body, _ := json.Marshal(req)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+type MemoryIdempotencyStore struct {
+	records map[string]*IdempotencyRecord
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: make(map[string]*IdempotencyRecord)}
+}
+
+func (s *MemoryIdempotencyStore) Get(owner, key string) (*IdempotencyRecord, bool) {
+	record, ok := s.records[idempotencyID(owner, key)]
+	return record, ok
+}
+
+func (s *MemoryIdempotencyStore) Put(record *IdempotencyRecord) error {
+	s.records[idempotencyID(record.Owner, record.Key)] = record
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Expire(before time.Time) int {
+	expired := 0
+	for id, record := range s.records {
+		if record.CreatedAt.Before(before) {
+			delete(s.records, id)
+			expired++
+		}
+	}
+	return expired
+}
+
+func (s *MemoryIdempotencyStore) All() []*IdempotencyRecord {
+	records := make([]*IdempotencyRecord, 0, len(s.records))
+	for _, record := range s.records {
+		records = append(records, record)
+	}
+	return records
+}
+
+// FileIdempotencyStore is a MemoryIdempotencyStore that appends every new
+// record to a log file, one JSON object per line, so issued keys survive an
+// orchestrator restart. A later line for the same key wins; Expire rewrites
+// the log without the expired records.
+type FileIdempotencyStore struct {
+	*MemoryIdempotencyStore
+	path string
+	log  *os.File
+}
+
+func NewFileIdempotencyStore(path string) (*FileIdempotencyStore, error) {
+	store := &FileIdempotencyStore{
+		MemoryIdempotencyStore: NewMemoryIdempotencyStore(),
+		path:                   path,
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	for {
+		var record IdempotencyRecord
+		err := decoder.Decode(&record)
+		// A crash can leave the last line half-written.
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return store, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		store.MemoryIdempotencyStore.Put(&record)
+	}
+}
+
+func (s *FileIdempotencyStore) Put(record *IdempotencyRecord) error {
+	s.MemoryIdempotencyStore.Put(record)
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if s.log == nil {
+		s.log, err = os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = s.log.Write(append(line, '\n'))
+	return err
+}
+
+func (s *FileIdempotencyStore) Expire(before time.Time) int {
+	expired := s.MemoryIdempotencyStore.Expire(before)
+	if expired > 0 {
+		if err := s.compact(); err != nil {
+			log.Printf("Failed to compact idempotency log: %v", err)
+		}
+	}
+	return expired
+}
+
+// compact replaces the log with the records that are still kept.
+func (s *FileIdempotencyStore) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(w)
+	for _, record := range s.All() {
+		if err := encoder.Encode(record); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	// The open log is the replaced file now.
+	if s.log != nil {
+		s.log.Close()
+		s.log = nil
+	}
+	return nil
+}
+
+// SetIdempotencyStore replaces the key store and moves the expression
+// counter past every ID the store has already handed out.
+func (o *Orchestrator) SetIdempotencyStore(store IdempotencyStore) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.idempotency = store
+	for _, record := range store.All() {
+		if id, err := strconv.ParseInt(record.ExprID, 10, 64); err == nil && id > o.expressionCounter {
+			o.expressionCounter = id
+		}
+	}
+}
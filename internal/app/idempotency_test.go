@@ -0,0 +1,151 @@
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandleCalculateRequest_IdempotencyKey(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/api/v1/calculate", orchestrator.handleCalculateRequest)
+
+	tests := []struct {
+		name           string
+		key            string
+		user           string
+		inputBody      string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"First Request", "retry-1", "", `{"expression": "1 + 2"}`, http.StatusCreated, `{"id":"1"}`},
+		{"Retry", "retry-1", "", `{"expression":"1 + 2"}`, http.StatusCreated, `{"id":"1"}`},
+		{"Different Body", "retry-1", "", `{"expression": "2 + 2"}`, http.StatusConflict, `{"error":"Idempotency key reused with a different body"}`},
+		{"Other User", "retry-1", "bob", `{"expression": "1 + 2"}`, http.StatusCreated, `{"id":"2"}`},
+		{"No Key", "", "", `{"expression": "1 + 2"}`, http.StatusCreated, `{"id":"3"}`},
+		{"Invalid Expression", "retry-2", "", `{"expression": "1 + "}`, http.StatusUnprocessableEntity, `{"error":"Invalid expression","errors":[{"code":"unexpected_end","message":"unexpected end of expression","offset":4,"column":5,"expected":["number","identifier","(","[","-","+","!"],"snippet":"1 + \n    ^"}]}`},
+		{"Fixed Expression", "retry-2", "", `{"expression": "1 + 3"}`, http.StatusCreated, `{"id":"4"}`},
+		{"Reused Key With Invalid Expression", "retry-2", "", `{"expression": "1 + "}`, http.StatusConflict, `{"error":"Idempotency key reused with a different body"}`},
+		{"Reused Key With Malformed Body", "retry-2", "", `{"expression": `, http.StatusConflict, `{"error":"Idempotency key reused with a different body"}`},
+		{"Malformed Body", "retry-3", "", `{"expression": `, http.StatusUnprocessableEntity, `{"error":"Invalid Body"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/api/v1/calculate", bytes.NewBufferString(test.inputBody))
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if test.key != "" {
+				req.Header.Set(IDEMPOTENCY_HEADER, test.key)
+			}
+			if test.user != "" {
+				req.Header.Set(USER_HEADER, test.user)
+			}
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != test.expectedStatus {
+				t.Errorf("Expected status %d, got %d", test.expectedStatus, recorder.Code)
+			}
+			if recorder.Body.String() != test.expectedBody {
+				t.Errorf("Expected body %s, got %s", test.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+
+	if len(orchestrator.expressionStore) != 4 {
+		t.Errorf("Expected 4 expressions, got %d", len(orchestrator.expressionStore))
+	}
+}
+
+func TestHandleCalculateRequest_IdempotencyWindow(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/api/v1/calculate", orchestrator.handleCalculateRequest)
+
+	orchestrator.idempotency.Put(&IdempotencyRecord{
+		Owner:     DEFAULT_USER,
+		Key:       "old",
+		BodyHash:  hashRequest(&ExpressionRequest{Expression: "1 + 2"}),
+		ExprID:    "42",
+		CreatedAt: time.Now().Add(-2 * IDEMPOTENCY_WINDOW),
+	})
+
+	req, err := http.NewRequest("POST", "/api/v1/calculate", bytes.NewBufferString(`{"expression": "1 + 2"}`))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IDEMPOTENCY_HEADER, "old")
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	expectedBody := `{"id":"1"}`
+	if recorder.Code != http.StatusCreated || recorder.Body.String() != expectedBody {
+		t.Errorf("Expected 201 %s for an expired key, got %d %s", expectedBody, recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestFileIdempotencyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	now := time.Now()
+
+	store, err := NewFileIdempotencyStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	records := []*IdempotencyRecord{
+		{Owner: "alice", Key: "a", BodyHash: "h1", ExprID: "7", CreatedAt: now},
+		{Owner: "alice", Key: "b", BodyHash: "h2", ExprID: "3", CreatedAt: now.Add(-time.Hour)},
+	}
+	for _, record := range records {
+		if err := store.Put(record); err != nil {
+			t.Fatalf("Failed to put record: %v", err)
+		}
+	}
+	if data, _ := os.ReadFile(path); bytes.Count(data, []byte("\n")) != 2 {
+		t.Errorf("Expected a line per record, got %q", data)
+	}
+	if expired := store.Expire(now.Add(-time.Minute)); expired != 1 {
+		t.Errorf("Expected 1 expired record, got %d", expired)
+	}
+	if err := store.Put(&IdempotencyRecord{Owner: "bob", Key: "a", ExprID: "5", CreatedAt: now}); err != nil {
+		t.Fatalf("Failed to put record after compaction: %v", err)
+	}
+	// A write cut short by a crash.
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	file.WriteString(`{"owner":"bob","key":"b"`)
+	file.Close()
+
+	reopened, err := NewFileIdempotencyStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	record, ok := reopened.Get("alice", "a")
+	if !ok || record.ExprID != "7" || record.BodyHash != "h1" {
+		t.Errorf("Expected record a to survive a restart, got %+v", record)
+	}
+	if _, ok := reopened.Get("alice", "b"); ok {
+		t.Errorf("Expected expired record b to be gone")
+	}
+	if record, ok := reopened.Get("bob", "a"); !ok || record.ExprID != "5" {
+		t.Errorf("Expected the record put after compaction, got %+v", record)
+	}
+
+	orchestrator := NewOrchestrator()
+	orchestrator.SetIdempotencyStore(reopened)
+	if orchestrator.expressionCounter != 7 {
+		t.Errorf("Expected expression counter 7, got %d", orchestrator.expressionCounter)
+	}
+}
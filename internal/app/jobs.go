@@ -0,0 +1,508 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	JOB_SOLVE            = "solve"
+	JOB_INTEGRATE        = "integrate"
+	JOB_MAX_SAMPLES      = 10000
+	SOLVE_TOLERANCE      = 1e-9
+	SOLVE_SECTIONS       = 4
+	SOLVE_MAX_ROUNDS     = 200
+	JOB_SAMPLE_NOT_REAL  = "is not a real number"
+	JOB_SAMPLE_CANCELLED = "sample cancelled"
+)
+
+var job_rx = regexp.MustCompile(`^\s*(solve|integrate)\s*\((.*)\)\s*$`)
+
+var (
+	errSameSigns        = errors.New("f(a) and f(b) must have opposite signs")
+	errDiscontinuity    = errors.New("no root (discontinuity)")
+	errInfiniteIntegral = errors.New("the integral is not finite")
+)
+
+// Job is a calculation on top of expressions: every sample f(x) it needs is
+// started as an ordinary expression with JobID set, and the job reduces the
+// results once the samples of a round are finished.
+type Job struct {
+	ID          string      `json:"id"`
+	Kind        string      `json:"kind"`
+	Expr        string      `json:"expression"`
+	Status      string      `json:"status"`
+	Progress    JobProgress `json:"progress"`
+	Result      *float64    `json:"result,omitempty"`
+	Error       string      `json:"error,omitempty"`
+	CreatedAt   *time.Time  `json:"created_at,omitempty"`
+	CompletedAt *time.Time  `json:"completed_at,omitempty"`
+	Owner       string      `json:"-"`
+
+	function  *ASTNode
+	variable  string
+	a, b      float64
+	n         int
+	tolerance float64
+	// points are the arguments of the current round and values the results
+	// of their samples; samples are the IDs of the sample expressions.
+	points   []float64
+	values   []float64
+	samples  []string
+	pending  int
+	starting bool
+	// lo and hi bracket the root with the values flo and fhi.
+	lo, hi, flo, fhi float64
+	// grid are the variables of a sweep, cells its results and next the
+	// index of the next point to start.
+	grid   []SweepVariable
+	cells  []sweepCell
+	next   int
+	format string
+}
+
+// JobProgress swagger model
+// @Description Ход выполнения задания: число вычисленных и всех точек
+type JobProgress struct {
+	Done    int     `json:"done" example:"51"`
+	Total   int     `json:"total" example:"101"`
+	Percent float64 `json:"percent" example:"50.5"`
+}
+
+func (j *Job) finished() bool {
+	return j.Status == "completed" || j.Status == "failed" || j.Status == "cancelled"
+}
+
+func (j *Job) setTotal(total int) {
+	j.Progress.Total = total
+	j.Progress.Percent = 0
+	if total > 0 {
+		j.Progress.Percent = math.Round(1000*float64(j.Progress.Done)/float64(total)) / 10
+	}
+}
+
+// splitArguments splits the arguments of a job call at the commas outside
+// parentheses and brackets.
+func splitArguments(text string) []string {
+	var args []string
+	depth, start := 0, 0
+	for i, r := range text {
+		switch r {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(text[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(args, strings.TrimSpace(text[start:]))
+}
+
+// newJob parses solve(f, x, a, b) or integrate(f, x, a, b, n).
+func (o *Orchestrator) newJob(owner, text string, options ParseOptions) (*Job, error) {
+	match := job_rx.FindStringSubmatch(text)
+	if match == nil {
+		return nil, errors.New("expected solve(f, x, a, b) or integrate(f, x, a, b, n)")
+	}
+	job := &Job{Kind: match[1], Expr: strings.TrimSpace(text), Owner: owner, tolerance: SOLVE_TOLERANCE}
+	args := splitArguments(match[2])
+	if arity := map[string]int{JOB_SOLVE: 4, JOB_INTEGRATE: 5}[job.Kind]; len(args) != arity {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", job.Kind, arity, len(args))
+	}
+	job.variable = args[1]
+	if !validVariable(job.variable) {
+		return nil, fmt.Errorf("invalid variable name %q", job.variable)
+	}
+	bounds := []*float64{&job.a, &job.b}
+	for i, arg := range args[2:4] {
+		value, err := o.constantArgument(owner, arg, options)
+		if err != nil {
+			return nil, err
+		}
+		*bounds[i] = value
+	}
+	if job.a >= job.b {
+		return nil, errors.New("a must be less than b")
+	}
+	if job.Kind == JOB_INTEGRATE {
+		n, err := strconv.Atoi(args[4])
+		if err != nil || n <= 0 || n%2 != 0 || n >= JOB_MAX_SAMPLES {
+			return nil, fmt.Errorf("n must be a positive even number below %d", JOB_MAX_SAMPLES)
+		}
+		job.n = n
+	}
+	options.Variables = []string{job.variable}
+	function, _, err := o.functions.Parse(owner, args[0], options)
+	if err != nil {
+		return nil, err
+	}
+	if hasUnits(function) {
+		return nil, errors.New("units are not supported in jobs")
+	}
+	job.function = function
+	return job, nil
+}
+
+func (o *Orchestrator) constantArgument(owner, text string, options ParseOptions) (float64, error) {
+	ast, _, err := o.functions.Parse(owner, text, options)
+	if err != nil {
+		return 0, err
+	}
+	if hasUnits(ast) || hasImaginary(ast) || hasMatrix(ast) {
+		return 0, fmt.Errorf("bound %s is not a real number", text)
+	}
+	value, err := evaluateLocally(ast)
+	if err == nil && !isFinite(value) {
+		err = errNotFinite
+	}
+	if err != nil {
+		return 0, fmt.Errorf("bound %s: %v", text, err)
+	}
+	return value, nil
+}
+
+// startJob stores the job and starts the samples of its first round.
+func (o *Orchestrator) startJob(job *Job) string {
+	o.jobCounter++
+	job.ID = strconv.FormatInt(o.jobCounter, 10)
+	job.Status = "pending"
+	o.jobStore[job.ID] = job
+	switch job.Kind {
+	case JOB_INTEGRATE:
+		job.setTotal(job.n + 1)
+		points := make([]float64, job.n+1)
+		for i := range points {
+			points[i] = job.a + (job.b-job.a)*float64(i)/float64(job.n)
+		}
+		o.startSamples(job, points)
+	case JOB_SOLVE:
+		rounds := math.Ceil(math.Log((job.b-job.a)/job.tolerance) / math.Log(SOLVE_SECTIONS))
+		job.setTotal(2 + int(min(max(rounds, 0), SOLVE_MAX_ROUNDS))*(SOLVE_SECTIONS-1))
+		o.startSamples(job, []float64{job.a, job.b})
+	}
+	return job.ID
+}
+
+// startSamples starts one expression per point. Samples can finish while
+// they are being started, so the job is advanced only after the last one.
+func (o *Orchestrator) startSamples(job *Job, points []float64) {
+	job.points, job.values, job.samples = points, make([]float64, len(points)), nil
+	job.pending, job.starting = len(points), true
+	for i, x := range points {
+		if job.finished() {
+			break
+		}
+		point := substitute(job.function, x)
+		expr := &Expression{
+			Expr:      point.String(),
+			CreatedAt: job.CreatedAt,
+			Owner:     job.Owner,
+			Options:   ParseOptions{SpecialValues: o.Config.SpecialValues},
+			JobID:     job.ID,
+			sample:    i,
+		}
+		job.samples = append(job.samples, o.startExpression(expr, point, false, false))
+	}
+	job.starting = false
+	if job.pending == 0 && !job.finished() {
+		o.advanceJob(job)
+	}
+}
+
+// finishSample records the result of a finished sample expression.
+func (o *Orchestrator) finishSample(expr *Expression) {
+	job, ok := o.jobStore[expr.JobID]
+	if !ok || expr.recorded {
+		return
+	}
+	expr.recorded = true
+	if job.Kind == JOB_SWEEP {
+		o.finishSweepSample(job, expr)
+		return
+	}
+	if job.finished() {
+		return
+	}
+	x := formatNumber(job.points[expr.sample])
+	switch {
+	case expr.Status == "cancelled":
+		o.failJob(job, JOB_SAMPLE_CANCELLED)
+		return
+	case expr.Status != "completed":
+		o.failJob(job, fmt.Sprintf("%s=%s: %s", job.variable, x, expr.Error))
+		return
+	case expr.Result == nil:
+		o.failJob(job, fmt.Sprintf("%s=%s: f %s", job.variable, x, JOB_SAMPLE_NOT_REAL))
+		return
+	}
+	job.Status = "in_progress"
+	job.values[expr.sample] = *expr.Result
+	job.Progress.Done++
+	job.setTotal(job.Progress.Total)
+	job.pending--
+	if job.pending == 0 && !job.starting {
+		o.advanceJob(job)
+	}
+}
+
+// advanceJob runs once all the samples of a round are known: it either
+// finishes the job or starts the next round.
+func (o *Orchestrator) advanceJob(job *Job) {
+	switch job.Kind {
+	case JOB_INTEGRATE:
+		result := simpson(job.values, (job.b-job.a)/float64(job.n))
+		if !isFinite(result) {
+			// JSON has no infinities.
+			o.failJob(job, errInfiniteIntegral.Error())
+			return
+		}
+		o.completeJob(job, result)
+	case JOB_SOLVE:
+		o.advanceSolve(job)
+	}
+}
+
+// simpson applies the composite Simpson rule to the values at an even number
+// of steps of width h.
+func simpson(values []float64, h float64) float64 {
+	sum := values[0] + values[len(values)-1]
+	for i := 1; i < len(values)-1; i++ {
+		sum += float64(2+2*(i%2)) * values[i]
+	}
+	return sum * h / 3
+}
+
+// advanceSolve narrows the bracket [lo, hi] to the first section whose ends
+// have opposite signs. Every round evaluates SOLVE_SECTIONS-1 inner points in
+// parallel, which is bisection for two sections. Near a root |f| shrinks
+// with the bracket; near a pole, where f changes sign as well, it grows.
+func (o *Orchestrator) advanceSolve(job *Job) {
+	points, values := job.points, job.values
+	previous := math.Inf(1)
+	if len(points) == 2 {
+		job.lo, job.hi, job.flo, job.fhi = points[0], points[1], values[0], values[1]
+		if !opposite(job.flo, job.fhi) {
+			o.failJob(job, errSameSigns.Error())
+			return
+		}
+	} else {
+		previous = max(math.Abs(job.flo), math.Abs(job.fhi))
+		points = append(append([]float64{job.lo}, points...), job.hi)
+		values = append(append([]float64{job.flo}, values...), job.fhi)
+		for i := 1; i < len(points); i++ {
+			if opposite(values[i-1], values[i]) {
+				job.lo, job.hi, job.flo, job.fhi = points[i-1], points[i], values[i-1], values[i]
+				break
+			}
+		}
+	}
+	switch {
+	case job.flo == 0:
+		o.completeJob(job, job.lo)
+	case job.fhi == 0:
+		o.completeJob(job, job.hi)
+	case job.hi-job.lo <= job.tolerance || job.Progress.Done >= job.Progress.Total:
+		if max(math.Abs(job.flo), math.Abs(job.fhi)) > previous {
+			o.failJob(job, errDiscontinuity.Error())
+			return
+		}
+		o.completeJob(job, (job.lo+job.hi)/2)
+	default:
+		inner := make([]float64, SOLVE_SECTIONS-1)
+		for i := range inner {
+			inner[i] = job.lo + (job.hi-job.lo)*float64(i+1)/SOLVE_SECTIONS
+		}
+		o.startSamples(job, inner)
+	}
+}
+
+// opposite reports whether a root lies between points with the values x and y.
+func opposite(x, y float64) bool {
+	return x == 0 || y == 0 || (x < 0) != (y < 0)
+}
+
+func (o *Orchestrator) completeJob(job *Job, result float64) {
+	now := time.Now()
+	job.Status = "completed"
+	job.Result = &result
+	job.Progress.Done = job.Progress.Total
+	job.setTotal(job.Progress.Total)
+	job.CompletedAt = &now
+}
+
+// failJob finishes the job with an error and cancels the samples still
+// being calculated.
+func (o *Orchestrator) failJob(job *Job, reason string) {
+	o.stopJob(job, "failed")
+	job.Error = reason
+}
+
+func (o *Orchestrator) stopJob(job *Job, status string) {
+	now := time.Now()
+	job.Status = status
+	job.CompletedAt = &now
+	for _, id := range job.samples {
+		if expr, ok := o.expressionStore[id]; ok && (expr.Status == "pending" || expr.Status == "in_progress") {
+			o.cancelExpression(expr)
+		}
+	}
+}
+
+// JobRequest swagger model
+// @Description Задание поиска корня или численного интегрирования
+type JobRequest struct {
+	Expression string `json:"expression" binding:"required" example:"integrate(sin(x), x, 0, pi, 100)"`
+	// Tolerance is the width of the bracket at which solve stops.
+	Tolerance       float64 `json:"tolerance,omitempty" example:"1e-9"`
+	NaturalNotation bool    `json:"natural_notation,omitempty" example:"false"`
+}
+
+// JobResponse swagger model
+// @Description Задание с ходом выполнения
+type JobResponse struct {
+	ID          string      `json:"id" example:"1"`
+	Kind        string      `json:"kind" example:"integrate"`
+	Expression  string      `json:"expression" example:"integrate(sin(x), x, 0, pi, 100)"`
+	Status      string      `json:"status" example:"in_progress"`
+	Progress    JobProgress `json:"progress"`
+	Result      *float64    `json:"result,omitempty" example:"2"`
+	Error       string      `json:"error,omitempty"`
+	CreatedAt   *time.Time  `json:"created_at,omitempty"`
+	CompletedAt *time.Time  `json:"completed_at,omitempty"`
+}
+
+// @Summary Start a job
+// @Description Start solve(f, x, a, b), a root of f on [a, b] found by bisection, or integrate(f, x, a, b, n), the integral of f over [a, b] by the Simpson rule with n steps. Every value of f is calculated as an ordinary expression with job_id set
+// @Tags jobs
+// @Accept json
+// @Produce json
+// @Param job body JobRequest true "Job"
+// @Success 201 {object} ExpressionResponse "Job ID"
+// @Failure 422 {object} ParseErrorResponse "Invalid job"
+// @Router /jobs [post]
+func (o *Orchestrator) handleJobRequest(c *gin.Context) {
+	if c.Request.Method != http.MethodPost {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
+		return
+	}
+	var req JobRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Expression == "" || req.Tolerance < 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid Body"})
+		return
+	}
+	now := time.Now()
+	owner := userFromRequest(c)
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	options := o.parseOptions()
+	options.Natural = req.NaturalNotation
+	job, err := o.newJob(owner, req.Expression, options)
+	if err != nil {
+		var parseErrors ParseErrors
+		if errors.As(err, &parseErrors) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid expression", "errors": parseErrors})
+			return
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid job: " + err.Error()})
+		return
+	}
+	if req.Tolerance > 0 {
+		job.tolerance = req.Tolerance
+	}
+	job.CreatedAt = &now
+	c.JSON(http.StatusCreated, gin.H{"id": o.startJob(job)})
+}
+
+// userJob returns the job of the id path parameter. Jobs of other users are
+// not found, like their functions and import reports.
+func (o *Orchestrator) userJob(c *gin.Context) (*Job, bool) {
+	job, ok := o.jobStore[c.Param("id")]
+	return job, ok && job.Owner == userFromRequest(c)
+}
+
+// @Summary Get jobs
+// @Description Retrieve the jobs of the user with their progress
+// @Tags jobs
+// @Produce json
+// @Success 200 {array} JobResponse
+// @Router /jobs [get]
+func (o *Orchestrator) handleJobsRequest(c *gin.Context) {
+	if c.Request.Method != http.MethodGet {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
+		return
+	}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	owner := userFromRequest(c)
+	jobs := make([]*Job, 0, len(o.jobStore))
+	for i := int64(1); i <= o.jobCounter; i++ {
+		if job, ok := o.jobStore[strconv.FormatInt(i, 10)]; ok && job.Owner == owner {
+			jobs = append(jobs, job)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+// @Summary Get job by ID
+// @Description Retrieve the status, progress and result of a job
+// @Tags jobs
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} JobResponse
+// @Failure 404 {object} Error "Job not found"
+// @Router /jobs/{id} [get]
+func (o *Orchestrator) handleJobByIdRequest(c *gin.Context) {
+	if c.Request.Method != http.MethodGet {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
+		return
+	}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	job, ok := o.userJob(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
+
+// @Summary Cancel job
+// @Description Cancel a job and the samples still being calculated
+// @Tags jobs
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} SuccessResponse "Job cancelled"
+// @Failure 404 {object} Error "Job not found"
+// @Failure 409 {object} Error "Job already finished"
+// @Router /jobs/{id} [delete]
+func (o *Orchestrator) handleDeleteJobRequest(c *gin.Context) {
+	if c.Request.Method != http.MethodDelete {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
+		return
+	}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	job, ok := o.userJob(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	if job.finished() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Job already " + job.Status})
+		return
+	}
+	o.stopJob(job, "cancelled")
+	c.JSON(http.StatusOK, gin.H{"status": "cancelled"})
+}
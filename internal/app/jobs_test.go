@@ -0,0 +1,306 @@
+package app
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func submitJob(t *testing.T, o *Orchestrator, text string) *Job {
+	t.Helper()
+	job, err := o.newJob(DEFAULT_USER, text, o.parseOptions())
+	if err != nil {
+		t.Fatalf("newJob(%q): %v", text, err)
+	}
+	o.startJob(job)
+	return job
+}
+
+func jobRouter(o *Orchestrator) *gin.Engine {
+	router := gin.Default()
+	router.POST("/internal/task", o.handlePostTaskRequest)
+	router.POST("/api/v1/jobs", o.handleJobRequest)
+	router.GET("/api/v1/jobs", o.handleJobsRequest)
+	router.GET("/api/v1/jobs/:id", o.handleJobByIdRequest)
+	router.DELETE("/api/v1/jobs/:id", o.handleDeleteJobRequest)
+	return router
+}
+
+func TestJob_Integrate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"integrate(x^2, x, 0, 3, 10)", 9},
+		{"integrate(sin(x), x, 0, pi, 100)", 2},
+		{"integrate(2, t, -1, 1, 2)", 4},
+	}
+	for _, test := range tests {
+		orchestrator := NewOrchestrator()
+		orchestrator.Config.Optimizer.Enabled = false
+		router := jobRouter(orchestrator)
+		job := submitJob(t, orchestrator, test.input)
+		runMatrixTasks(t, orchestrator, router)
+		if job.Status != "completed" || job.Result == nil || math.Abs(*job.Result-test.expected) > 1e-6 {
+			t.Errorf("%s: expected %v, got %+v", test.input, test.expected, job)
+			continue
+		}
+		if job.Progress.Done != job.Progress.Total || job.Progress.Percent != 100 {
+			t.Errorf("%s: expected full progress, got %+v", test.input, job.Progress)
+		}
+	}
+}
+
+func TestJob_IntegrateProgress(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.Config.Optimizer.Enabled = false
+	job := submitJob(t, orchestrator, "integrate(x*x, x, 1, 2, 4)")
+	if job.Status != "pending" || job.Progress.Total != 5 || len(job.samples) != 5 {
+		t.Fatalf("Expected 5 pending samples, got %+v", job)
+	}
+	if expr := orchestrator.expressionStore[job.samples[1]]; expr.JobID != job.ID || expr.Expr != "1.25*1.25" {
+		t.Errorf("Unexpected sample %+v", expr)
+	}
+	router := jobRouter(orchestrator)
+	task := orchestrator.taskQueue.PopFront().(*Task)
+	postResult(t, router, `{"id":"`+task.ID+`","result":1}`)
+	if job.Status != "in_progress" || job.Progress.Done != 1 || job.Progress.Percent != 20 {
+		t.Errorf("Expected 1 of 5 samples, got %+v", job)
+	}
+}
+
+func TestJob_Solve(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"solve(x^2-2, x, 0, 2)", math.Sqrt2},
+		{"solve(cos(x), x, 0, 3)", math.Pi / 2},
+		{"solve(x-1, x, 1, 5)", 1},
+	}
+	for _, test := range tests {
+		orchestrator := NewOrchestrator()
+		orchestrator.Config.Optimizer.Enabled = false
+		router := jobRouter(orchestrator)
+		job := submitJob(t, orchestrator, test.input)
+		runMatrixTasks(t, orchestrator, router)
+		if job.Status != "completed" || job.Result == nil || math.Abs(*job.Result-test.expected) > 1e-8 {
+			t.Errorf("%s: expected %v, got %+v", test.input, test.expected, job)
+		}
+	}
+}
+
+func TestJob_SolveSameSigns(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	job := submitJob(t, orchestrator, "solve(x^2+1, x, -1, 1)")
+	runMatrixTasks(t, orchestrator, jobRouter(orchestrator))
+	if job.Status != "failed" || job.Error != errSameSigns.Error() {
+		t.Errorf("Expected a failed job, got %+v", job)
+	}
+}
+
+func TestJob_SolveDiscontinuity(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.Config.Optimizer.Enabled = false
+	job := submitJob(t, orchestrator, "solve(1/x, x, -1, 2)")
+	runMatrixTasks(t, orchestrator, jobRouter(orchestrator))
+	if job.Status != "failed" || job.Error != errDiscontinuity.Error() {
+		t.Errorf("Expected a failed job, got %+v", job)
+	}
+}
+
+func TestJob_IntegrateNotFinite(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.Config.Optimizer.Enabled = false
+	router := jobRouter(orchestrator)
+	job := submitJob(t, orchestrator, "integrate(x, x, 0, 1e300, 2)")
+	runMatrixTasks(t, orchestrator, router)
+	if job.Status != "failed" || job.Error != errInfiniteIntegral.Error() || job.Result != nil {
+		t.Errorf("Expected a failed job, got %+v", job)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/jobs", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK || !json.Valid(recorder.Body.Bytes()) {
+		t.Errorf("Expected a job list, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestJob_FailedSampleCancelsOthers(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.Config.Optimizer.Enabled = false
+	router := jobRouter(orchestrator)
+	job := submitJob(t, orchestrator, "integrate(1/x, x, 0, 1, 2)")
+	task := orchestrator.taskQueue.PopFront().(*Task)
+	postResult(t, router, `{"id":"`+task.ID+`","error":"division by zero"}`)
+	if job.Status != "failed" || job.Error != "x=0: division by zero" {
+		t.Errorf("Expected a failed job, got %+v", job)
+	}
+	for _, id := range job.samples[1:] {
+		if expr := orchestrator.expressionStore[id]; expr.Status != "cancelled" {
+			t.Errorf("Expected sample %s cancelled, got %s", id, expr.Status)
+		}
+	}
+	if orchestrator.taskQueue.Len() != 0 {
+		t.Errorf("Expected no tasks, got %d", orchestrator.taskQueue.Len())
+	}
+}
+
+func TestNewJob_Errors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+	}{
+		{"x^2", "expected solve(f, x, a, b) or integrate(f, x, a, b, n)"},
+		{"solve(x, x, 0)", "solve takes 4 arguments, got 3"},
+		{"solve(x, sin, 0, 1)", `invalid variable name "sin"`},
+		{"solve(x, x, 1, 0)", "a must be less than b"},
+		{"integrate(x, x, 0, 1, 3)", "n must be a positive even number below 10000"},
+		{"integrate(x, x, 0, 1, 0)", "n must be a positive even number below 10000"},
+		{"integrate(x*1m, x, 0, 1, 2)", "units are not supported in jobs"},
+		{"solve(x, x, 0, 2i)", "bound 2i is not a real number"},
+	}
+	orchestrator := NewOrchestrator()
+	for _, test := range tests {
+		_, err := orchestrator.newJob(DEFAULT_USER, test.input, orchestrator.parseOptions())
+		if err == nil || err.Error() != test.message {
+			t.Errorf("newJob(%q): expected %q, got %v", test.input, test.message, err)
+		}
+	}
+	if _, err := orchestrator.newJob(DEFAULT_USER, "solve(x+y, x, 0, 1)", orchestrator.parseOptions()); err == nil {
+		t.Error("Expected a parse error for an unknown variable")
+	}
+	if args := splitArguments("max(x, 1), x, [1, 2], 3"); len(args) != 4 || args[0] != "max(x, 1)" || args[2] != "[1, 2]" {
+		t.Errorf("Unexpected arguments %q", args)
+	}
+}
+
+func TestHandleJobRequest(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := jobRouter(orchestrator)
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"expression":"solve(x-1, x, 0, 3)","tolerance":1e-6}`, http.StatusCreated},
+		{`{"expression":"solve(x-, x, 0, 3)"}`, http.StatusUnprocessableEntity},
+		{`{"expression":"solve(x, x, 3, 0)"}`, http.StatusUnprocessableEntity},
+		{`{"expression":"solve(x, x, 0, 3)","tolerance":-1}`, http.StatusUnprocessableEntity},
+		{`{}`, http.StatusUnprocessableEntity},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/jobs", strings.NewReader(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != test.code {
+			t.Errorf("%s: expected status %d, got %d: %s", test.body, test.code, recorder.Code, recorder.Body.String())
+		}
+	}
+	if job := orchestrator.jobStore["1"]; job == nil || job.tolerance != 1e-6 {
+		t.Fatalf("Expected job 1 with tolerance 1e-6, got %+v", job)
+	}
+
+	runMatrixTasks(t, orchestrator, router)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/jobs/1", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	var response struct {
+		Job JobResponse `json:"job"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Job.Status != "completed" || response.Job.Kind != JOB_SOLVE || response.Job.Result == nil || math.Abs(*response.Job.Result-1) > 1e-6 {
+		t.Errorf("Unexpected job %s", recorder.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/jobs/2", nil)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", recorder.Code)
+	}
+}
+
+func TestHandleJobRequests_OtherUser(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := jobRouter(orchestrator)
+	job := submitJob(t, orchestrator, "integrate(x*x, x, 0, 1, 2)")
+
+	tests := []struct {
+		method   string
+		target   string
+		user     string
+		code     int
+		expected string
+	}{
+		{http.MethodGet, "/api/v1/jobs", "bob", http.StatusOK, `{"jobs":[]}`},
+		{http.MethodGet, "/api/v1/jobs/1", "bob", http.StatusNotFound, `{"error":"Job not found"}`},
+		{http.MethodDelete, "/api/v1/jobs/1", "bob", http.StatusNotFound, `{"error":"Job not found"}`},
+		{http.MethodGet, "/api/v1/jobs/1", "", http.StatusOK, `"id":"1"`},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.target, nil)
+		if test.user != "" {
+			req.Header.Set(USER_HEADER, test.user)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != test.code || !strings.Contains(recorder.Body.String(), test.expected) {
+			t.Errorf("%s %s as %q: expected %d %s, got %d %s", test.method, test.target, test.user, test.code, test.expected, recorder.Code, recorder.Body.String())
+		}
+	}
+	if job.finished() {
+		t.Errorf("Expected the job to keep running, got %s", job.Status)
+	}
+}
+
+func TestHandleDeleteJobRequest(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.Config.Optimizer.Enabled = false
+	router := jobRouter(orchestrator)
+	job := submitJob(t, orchestrator, "integrate(x*x, x, 0, 1, 2)")
+
+	for _, code := range []int{http.StatusOK, http.StatusConflict} {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/jobs/"+job.ID, nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != code {
+			t.Errorf("Expected status %d, got %d", code, recorder.Code)
+		}
+	}
+	if job.Status != "cancelled" || orchestrator.taskQueue.Len() != 0 {
+		t.Errorf("Expected a cancelled job without tasks, got %+v", job)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/jobs", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if !strings.Contains(recorder.Body.String(), `"status":"cancelled"`) {
+		t.Errorf("Unexpected jobs %s", recorder.Body.String())
+	}
+}
+
+func TestEnforceRetention_Jobs(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	job := submitJob(t, orchestrator, "solve(x, x, 0, 1)")
+	if job.Status != "completed" {
+		t.Fatalf("Expected the constant samples to complete at once, got %+v", job)
+	}
+	orchestrator.enforceRetention(time.Now())
+	if _, ok := orchestrator.jobStore[job.ID]; !ok {
+		t.Error("Expected a fresh job to be kept")
+	}
+	orchestrator.enforceRetention(job.CompletedAt.Add(RETENTION_MAX_AGE + time.Second))
+	if _, ok := orchestrator.jobStore[job.ID]; ok {
+		t.Error("Expected an old job to be purged")
+	}
+}
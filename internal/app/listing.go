@@ -0,0 +1,184 @@
+package app
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	LIST_DEFAULT_LIMIT = 100
+	LIST_MAX_LIMIT     = 1000
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+type listQuery struct {
+	Limit       int
+	Statuses    map[string]bool
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Contains    string
+	SortBy      string
+	Desc        bool
+	after       *listCursor
+}
+
+type listCursor struct {
+	key int64
+	id  int64
+}
+
+func parseListQuery(values url.Values) (*listQuery, error) {
+	q := &listQuery{Limit: LIST_DEFAULT_LIMIT, SortBy: "id"}
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid limit %q", raw)
+		}
+		q.Limit = min(limit, LIST_MAX_LIMIT)
+	}
+	if raw := values.Get("status"); raw != "" {
+		q.Statuses = make(map[string]bool)
+		for _, status := range strings.Split(raw, ",") {
+			q.Statuses[strings.TrimSpace(status)] = true
+		}
+	}
+	for param, dst := range map[string]**time.Time{"created_from": &q.CreatedFrom, "created_to": &q.CreatedTo} {
+		if raw := values.Get(param); raw != "" {
+			at, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q", param, raw)
+			}
+			*dst = &at
+		}
+	}
+	q.Contains = values.Get("q")
+	if raw := values.Get("sort"); raw != "" {
+		if raw != "id" && raw != "created_at" && raw != "completed_at" {
+			return nil, fmt.Errorf("invalid sort %q", raw)
+		}
+		q.SortBy = raw
+	}
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return nil, fmt.Errorf("invalid order %q", values.Get("order"))
+	}
+	if raw := values.Get("cursor"); raw != "" {
+		cursor, err := q.decodeCursor(raw)
+		if err != nil {
+			return nil, err
+		}
+		q.after = cursor
+	}
+	return q, nil
+}
+
+func (q *listQuery) matches(expr *Expression) bool {
+	if q.Statuses != nil && !q.Statuses[expr.Status] {
+		return false
+	}
+	if q.CreatedFrom != nil && (expr.CreatedAt == nil || expr.CreatedAt.Before(*q.CreatedFrom)) {
+		return false
+	}
+	if q.CreatedTo != nil && (expr.CreatedAt == nil || !expr.CreatedAt.Before(*q.CreatedTo)) {
+		return false
+	}
+	return q.Contains == "" || strings.Contains(expr.Expr, q.Contains)
+}
+
+func (q *listQuery) position(expr *Expression) listCursor {
+	id, _ := strconv.ParseInt(expr.ID, 10, 64)
+	pos := listCursor{key: id, id: id}
+	switch q.SortBy {
+	case "created_at":
+		pos.key = 0
+		if expr.CreatedAt != nil {
+			pos.key = expr.CreatedAt.UnixNano()
+		}
+	case "completed_at":
+		pos.key = math.MaxInt64
+		if expr.CompletedAt != nil {
+			pos.key = expr.CompletedAt.UnixNano()
+		}
+	}
+	return pos
+}
+
+func (q *listQuery) before(a, b listCursor) bool {
+	if q.Desc {
+		a, b = b, a
+	}
+	if a.key != b.key {
+		return a.key < b.key
+	}
+	return a.id < b.id
+}
+
+func (q *listQuery) encodeCursor(c listCursor) string {
+	raw := fmt.Sprintf("%s:%t:%d:%d", q.SortBy, q.Desc, c.key, c.id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func (q *listQuery) decodeCursor(raw string) (*listCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	parts := strings.Split(string(decoded), ":")
+	if len(parts) != 4 || parts[0] != q.SortBy || parts[1] != strconv.FormatBool(q.Desc) {
+		return nil, errInvalidCursor
+	}
+	key, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	id, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	return &listCursor{key: key, id: id}, nil
+}
+
+// sorted returns the expressions the query matches, in its order.
+func (q *listQuery) sorted(store map[string]*Expression) []*Expression {
+	matched := make([]*Expression, 0)
+	for _, expr := range store {
+		expr.syncStatus()
+		if q.matches(expr) {
+			matched = append(matched, expr)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return q.before(q.position(matched[i]), q.position(matched[j]))
+	})
+	return matched
+}
+
+// apply filters and sorts the expressions and returns one page of them
+// together with the total number of matches and the cursor of the next page.
+func (q *listQuery) apply(store map[string]*Expression) ([]*Expression, int, string) {
+	matched := q.sorted(store)
+	start := 0
+	if q.after != nil {
+		start = sort.Search(len(matched), func(i int) bool {
+			return q.before(*q.after, q.position(matched[i]))
+		})
+	}
+	end := min(start+q.Limit, len(matched))
+	page := matched[start:end]
+	next := ""
+	if end < len(matched) {
+		next = q.encodeCursor(q.position(page[len(page)-1]))
+	}
+	return page, len(matched), next
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newListingStore() map[string]*Expression {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := make(map[string]*Expression)
+	exprs := []string{"1+1", "2*3", "10/5", "1+2*3", "7-4", "(1+1)*2"}
+	for i, text := range exprs {
+		id := strconv.Itoa(i + 1)
+		created := base.Add(time.Duration(len(exprs)-i) * time.Minute)
+		expr := &Expression{ID: id, Expr: text, Status: "pending", CreatedAt: &created}
+		if i%2 == 0 {
+			completed := base.Add(time.Duration(i) * time.Hour)
+			expr.Status = "completed"
+			expr.CompletedAt = &completed
+		}
+		store[id] = expr
+	}
+	return store
+}
+
+func ids(exprs []*Expression) []string {
+	result := make([]string, 0, len(exprs))
+	for _, expr := range exprs {
+		result = append(result, expr.ID)
+	}
+	return result
+}
+
+func TestListQuery_Apply(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+		total    int
+	}{
+		{"Default Order", "", []string{"1", "2", "3", "4", "5", "6"}, 6},
+		{"Status Filter", "status=completed", []string{"1", "3", "5"}, 3},
+		{"Several Statuses", "status=completed,pending", []string{"1", "2", "3", "4", "5", "6"}, 6},
+		{"Substring Filter", "q=1%2B", []string{"1", "4", "6"}, 3},
+		{"Created Range", "created_from=2025-01-01T00:02:00Z&created_to=2025-01-01T00:04:00Z", []string{"4", "5"}, 2},
+		{"Sort By Created", "sort=created_at", []string{"6", "5", "4", "3", "2", "1"}, 6},
+		{"Sort By Completed Desc", "sort=completed_at&order=desc", []string{"6", "4", "2", "5", "3", "1"}, 6},
+		{"Limit", "limit=2", []string{"1", "2"}, 6},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(test.query)
+			query, err := parseListQuery(values)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			page, total, _ := query.apply(newListingStore())
+			if !reflect.DeepEqual(ids(page), test.expected) {
+				t.Errorf("Expected %v, got %v", test.expected, ids(page))
+			}
+			if total != test.total {
+				t.Errorf("Expected total %d, got %d", test.total, total)
+			}
+		})
+	}
+}
+
+func TestListQuery_Cursor(t *testing.T) {
+	store := newListingStore()
+	for _, sortBy := range []string{"id", "created_at", "completed_at"} {
+		for _, order := range []string{"asc", "desc"} {
+			values := url.Values{"sort": {sortBy}, "order": {order}}
+			query, _ := parseListQuery(values)
+			all, _, _ := query.apply(store)
+
+			var collected []string
+			cursor := ""
+			for pages := 0; pages < 10; pages++ {
+				values.Set("limit", "4")
+				if cursor != "" {
+					values.Set("cursor", cursor)
+				}
+				query, err := parseListQuery(values)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				page, _, next := query.apply(store)
+				collected = append(collected, ids(page)...)
+				if next == "" {
+					break
+				}
+				cursor = next
+			}
+			if !reflect.DeepEqual(collected, ids(all)) {
+				t.Errorf("sort=%s order=%s: expected %v, got %v", sortBy, order, ids(all), collected)
+			}
+		}
+	}
+}
+
+func TestHandleExpressionsRequest_Pagination(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.expressionStore = newListingStore()
+	router := gin.Default()
+	router.GET("/api/v1/expressions", orchestrator.handleExpressionsRequest)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{"Valid Page", "limit=4&sort=created_at&order=desc", http.StatusOK},
+		{"Invalid Limit", "limit=-1", http.StatusBadRequest},
+		{"Invalid Sort", "sort=result", http.StatusBadRequest},
+		{"Invalid Order", "order=random", http.StatusBadRequest},
+		{"Invalid Time", "created_from=yesterday", http.StatusBadRequest},
+		{"Invalid Cursor", "cursor=garbage", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/api/v1/expressions?"+test.query, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != test.expectedStatus {
+				t.Errorf("Expected status %d, got %d", test.expectedStatus, recorder.Code)
+			}
+		})
+	}
+
+	req, _ := http.NewRequest("GET", "/api/v1/expressions?limit=4", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	var page ExpressionsPageResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &page); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(page.Expressions) != 4 || page.Total != 6 || page.NextCursor == "" {
+		t.Errorf("Unexpected page: %d expressions, total %d, next cursor %q", len(page.Expressions), page.Total, page.NextCursor)
+	}
+	if page.Expressions[0].CreatedAt == nil {
+		t.Errorf("Expected created_at in the response")
+	}
+}
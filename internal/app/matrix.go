@@ -0,0 +1,293 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"Yandex_Calc_V2.0/internal/matrix"
+	"Yandex_Calc_V2.0/internal/ops"
+)
+
+const (
+	// MATRIX_CAPABILITY is advertised by agents that accept matrix operands.
+	MATRIX_CAPABILITY = "matrix"
+	// MATRIX_BLOCK_SIZE is the default largest number of multiply-adds of
+	// one matrix multiplication task.
+	MATRIX_BLOCK_SIZE = 1 << 16
+	// MATRIX_OPS_PER_COST is the number of element operations that take the
+	// operation time of the operator once.
+	MATRIX_OPS_PER_COST = 1000
+	// MATRIX_STACK joins the row blocks of a split multiplication. The
+	// orchestrator applies it itself; it never reaches agents.
+	MATRIX_STACK = "vstack"
+)
+
+// leafMatrix returns the value of a leaf as a matrix; numbers are 1x1.
+func leafMatrix(node *ASTNode) *matrix.Matrix {
+	if node.Matrix != nil {
+		return node.Matrix
+	}
+	return matrix.Scalar(node.Value)
+}
+
+// setMatrix turns the node into a leaf holding m. 1x1 results become numbers.
+func (n *ASTNode) setMatrix(m *matrix.Matrix) {
+	n.IsLeaf = true
+	n.Imag = 0
+	if m.IsScalar() {
+		n.Value, n.Matrix = m.Data[0], nil
+		return
+	}
+	n.Value, n.Matrix = 0, m
+}
+
+func hasMatrix(node *ASTNode) bool {
+	if node == nil {
+		return false
+	}
+	if node.IsLeaf {
+		return node.Matrix != nil
+	}
+	return hasMatrix(node.Left) || hasMatrix(node.Right)
+}
+
+// matrixKey identifies a matrix task by a digest of its operands, since the
+// operands themselves can be too large for a cache key.
+func matrixKey(op string, operands []*matrix.Matrix) string {
+	digest := sha256.New()
+	for _, operand := range operands {
+		_ = binary.Write(digest, binary.LittleEndian, int64(operand.Rows))
+		_ = binary.Write(digest, binary.LittleEndian, int64(operand.Cols))
+		_ = binary.Write(digest, binary.LittleEndian, operand.Data)
+	}
+	return fmt.Sprintf("%s/%s|%x", op, MATRIX_CAPABILITY, digest.Sum(nil))
+}
+
+// matrixWork estimates the number of element operations of a matrix task.
+func matrixWork(op string, operands []*matrix.Matrix) int {
+	a := operands[0]
+	switch {
+	case op == "*" && len(operands) == 2 && !a.IsScalar() && !operands[1].IsScalar():
+		return a.Rows * a.Cols * operands[1].Cols
+	case op == "det" || op == "inv":
+		return a.Rows * a.Rows * a.Rows
+	}
+	work := 0
+	for _, operand := range operands {
+		work = max(work, len(operand.Data))
+	}
+	return work
+}
+
+// matrixOperationTime scales the operation time with the size of the task.
+func (o *Orchestrator) matrixOperationTime(op string, operands []*matrix.Matrix) int {
+	units := (matrixWork(op, operands) + MATRIX_OPS_PER_COST - 1) / MATRIX_OPS_PER_COST
+	return o.operationTime(op) * max(units, 1)
+}
+
+// splitProduct replaces a multiplication of two matrices with more than
+// Config.MatrixBlockSize multiply-adds by products of row blocks of the left
+// operand with the right one, joined by MATRIX_STACK nodes. The blocks are
+// independent tasks that agents compute in parallel.
+func (o *Orchestrator) splitProduct(node *ASTNode) bool {
+	if o.Config.MatrixBlockSize <= 0 || node.Operator != "*" || node.Left.Matrix == nil || node.Right.Matrix == nil {
+		return false
+	}
+	a, b := node.Left.Matrix, node.Right.Matrix
+	if a.Cols != b.Rows || a.Rows < 2 || a.Rows*a.Cols*b.Cols <= o.Config.MatrixBlockSize {
+		return false
+	}
+	rows := max(o.Config.MatrixBlockSize/(a.Cols*b.Cols), 1)
+	blocks := make([]*ASTNode, 0, (a.Rows+rows-1)/rows)
+	for from := 0; from < a.Rows; from += rows {
+		block := &ASTNode{Operator: "*", Left: &ASTNode{}, Right: &ASTNode{}}
+		block.Left.setMatrix(a.Slice(from, min(from+rows, a.Rows)))
+		block.Right.setMatrix(b)
+		blocks = append(blocks, block)
+	}
+	*node = *buildBalanced(MATRIX_STACK, blocks)
+	return true
+}
+
+// stackBlocks joins two computed row blocks in place.
+func stackBlocks(node *ASTNode) error {
+	stacked, err := matrix.Stack(leafMatrix(node.Left), leafMatrix(node.Right))
+	if err != nil {
+		return err
+	}
+	node.setMatrix(stacked)
+	node.Left, node.Right = nil, nil
+	return nil
+}
+
+// evaluateMatrix computes the expression locally, treating numbers as 1x1
+// matrices. It verifies results of expressions with matrices, which eval
+// does not parse.
+func evaluateMatrix(node *ASTNode) (*matrix.Matrix, error) {
+	if node.IsLeaf {
+		if node.Imag != 0 {
+			return nil, fmt.Errorf("complex matrices are not supported")
+		}
+		return leafMatrix(node), nil
+	}
+	if isControl(node) {
+		left, err := evaluateMatrix(node.Left)
+		if err != nil {
+			return nil, err
+		}
+		if !left.IsScalar() {
+			return nil, errCondition
+		}
+		x := left.Data[0]
+		switch {
+		case isConditional(node) && x != 0:
+			return evaluateMatrix(node.Right.Left)
+		case isConditional(node):
+			return evaluateMatrix(node.Right.Right)
+		case (x != 0) == (node.Operator == "||"):
+			return matrix.Scalar(truthValue(x != 0)), nil
+		}
+		right, err := evaluateMatrix(node.Right)
+		if err != nil {
+			return nil, err
+		}
+		if !right.IsScalar() {
+			return nil, errCondition
+		}
+		return matrix.Scalar(truthValue(right.Data[0] != 0)), nil
+	}
+	if args := callArguments(node); args != nil {
+		operands := make([]*matrix.Matrix, len(args))
+		for i, arg := range args {
+			operand, err := evaluateMatrix(arg)
+			if err != nil {
+				return nil, err
+			}
+			operands[i] = operand
+		}
+		return ops.ApplyMatrix(node.Operator, operands...)
+	}
+	left, err := evaluateMatrix(node.Left)
+	if err != nil {
+		return nil, err
+	}
+	if isCall(node) {
+		return ops.ApplyMatrix(node.Operator, left)
+	}
+	right, err := evaluateMatrix(node.Right)
+	if err != nil {
+		return nil, err
+	}
+	if node.Operator == MATRIX_STACK {
+		return matrix.Stack(left, right)
+	}
+	return ops.ApplyMatrix(node.Operator, left, right)
+}
+
+// matrixOnly reports whether the operation has no real implementation, like
+// det, so that even numbers are sent to it as 1x1 matrices.
+func matrixOnly(op string) bool {
+	operation, ok := ops.Lookup(op)
+	return ok && operation.Apply == nil
+}
+
+// usesMatrices reports whether the expression has matrix literals or
+// matrix-only functions.
+func usesMatrices(node *ASTNode) bool {
+	if node == nil {
+		return false
+	}
+	if node.IsLeaf {
+		return node.Matrix != nil
+	}
+	return matrixOnly(node.Operator) || usesMatrices(node.Left) || usesMatrices(node.Right)
+}
+
+func verifyMatrixResult(ast, node *ASTNode) error {
+	expected, err := evaluateMatrix(ast)
+	if err != nil {
+		return err
+	}
+	if got := leafMatrix(node); !matrix.Equal(got, expected, 0) {
+		return fmt.Errorf("result %v differs from verification %v", got, expected)
+	}
+	return nil
+}
+
+// parseMatrix parses [1,2] as a column vector and [[1,2],[3,4]] as a matrix
+// given by rows. Elements are numbers.
+func (p *parser) parseMatrix() (*ASTNode, error) {
+	start := p.pos
+	p.get()
+	var rows [][]float64
+	p.skipSpaces()
+	if p.peek() == '[' {
+		for {
+			p.skipSpaces()
+			if p.peek() != '[' {
+				return nil, p.unexpected([]string{"["})
+			}
+			p.get()
+			row, err := p.parseElements()
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+			p.skipSpaces()
+			if p.peek() != ',' {
+				break
+			}
+			p.get()
+		}
+		if p.peek() != ']' {
+			return nil, p.unexpected([]string{",", "]"})
+		}
+		p.get()
+	} else {
+		column, err := p.parseElements()
+		if err != nil {
+			return nil, err
+		}
+		for _, x := range column {
+			rows = append(rows, []float64{x})
+		}
+	}
+	m, err := matrix.FromRows(rows)
+	if err != nil {
+		return nil, p.fail(start, PARSE_INVALID_MATRIX, nil, "invalid matrix: %v", err)
+	}
+	node := &ASTNode{}
+	node.setMatrix(m)
+	return node, nil
+}
+
+// parseElements parses numbers up to and including the closing bracket.
+func (p *parser) parseElements() ([]float64, error) {
+	var elements []float64
+	for {
+		p.skipSpaces()
+		start := p.pos
+		node, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if !node.IsLeaf || node.Matrix != nil || node.Imag != 0 || node.Variable != "" {
+			return nil, p.fail(start, PARSE_INVALID_MATRIX, nil, "matrix element is not a real number")
+		}
+		if !node.Unit.Dimensionless() {
+			return nil, p.fail(start, PARSE_INVALID_MATRIX, nil, "matrix element has a unit")
+		}
+		elements = append(elements, node.Value)
+		switch p.peek() {
+		case ',':
+			p.get()
+			continue
+		case ']':
+			p.get()
+			return elements, nil
+		default:
+			return nil, p.unexpected([]string{"operator", ",", "]"})
+		}
+	}
+}
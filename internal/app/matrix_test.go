@@ -0,0 +1,183 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"Yandex_Calc_V2.0/internal/matrix"
+	"Yandex_Calc_V2.0/internal/ops"
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseAST_Matrix(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[[1,2],[3,4]]*[5,6]", "[[1,2],[3,4]]*[5,6]"},
+		{"[[1,2]]", "[[1,2]]"},
+		{"-[1,-2.5]", "[-1,2.5]"},
+		{"[[7]]+1", "7+1"},
+		{"dot([1,2],[3,4])*2", "dot([1,2],[3,4])*2"},
+		{"det(inv([[1,2],[3,4]]))", "det(inv([[1,2],[3,4]]))"},
+		{"transpose([1,2])", "transpose([1,2])"},
+	}
+	for _, test := range tests {
+		ast, err := ParseAST(test.input)
+		if err != nil {
+			t.Errorf("ParseAST(%q): unexpected error %v", test.input, err)
+			continue
+		}
+		if got := ast.String(); got != test.expected {
+			t.Errorf("ParseAST(%q).String() = %q, want %q", test.input, got, test.expected)
+		}
+	}
+
+	invalid := []string{"[[1,2],[3]]", "[1+2,3]", "[1,2", "[]", "[[1,2]", "dot([1,2])", "[1,[2,3]]"}
+	for _, input := range invalid {
+		if _, err := ParseAST(input); err == nil {
+			t.Errorf("ParseAST(%q): expected an error", input)
+		}
+	}
+}
+
+// runMatrixTasks plays an agent with every capability until the queue is
+// empty.
+func runMatrixTasks(t *testing.T, o *Orchestrator, router *gin.Engine) int {
+	t.Helper()
+	agent := NewAgent()
+	tasks := 0
+	for o.taskQueue.Len() > 0 {
+		task := o.taskQueue.PopFront().(*Task)
+		result := &TaskResult{ID: task.ID}
+		if len(task.Matrices) > 0 {
+			m, err := agent.CalculateMatrix(task.Operation, task.Matrices...)
+			if err != nil {
+				t.Fatalf("task %s %s: %v", task.ID, task.Operation, err)
+			}
+			result.setMatrix(m)
+		} else {
+			args := []float64{task.Arg1, task.Arg2}
+			if len(task.Args) > 0 {
+				args = task.Args
+			}
+			z, err := agent.compute(task.Operation, args, nil)
+			if err != nil {
+				t.Fatalf("task %s %s: %v", task.ID, task.Operation, err)
+			}
+			result.Result = real(z)
+		}
+		body, err := json.Marshal(result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if recorder := postResult(t, router, string(body)); recorder.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+		}
+		tasks++
+	}
+	return tasks
+}
+
+func TestScheduleTasks_MatrixProduct(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.GET("/internal/task", orchestrator.handleGetTaskRequest)
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	expr := submitExpression(t, orchestrator, "1", "[[1,2],[3,4]]*[5,6]")
+
+	fetch := func(capabilities string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/internal/task", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(AGENT_CAPABILITIES_HEADER, capabilities)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+	if recorder := fetch(""); recorder.Code != http.StatusNotFound {
+		t.Fatalf("Expected agents without the matrix capability to get no task, got %d", recorder.Code)
+	}
+	recorder := fetch(MATRIX_CAPABILITY)
+	expected := `{"task":{"id":"1","arg1":0,"arg2":0,"matrices":[{"rows":2,"cols":2,"data":[1,2,3,4]},{"rows":2,"cols":1,"data":[5,6]}],"operation":"*","operation_time":228}}`
+	if recorder.Body.String() != expected {
+		t.Fatalf("Expected %s, got %s", expected, recorder.Body.String())
+	}
+	if recorder := postResult(t, router, `{"id":"1","matrix":{"rows":2,"cols":1,"data":[17,39]}}`); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if expr.Status != "completed" || expr.Result != nil || !matrix.Equal(expr.MatrixResult, &matrix.Matrix{Rows: 2, Cols: 1, Data: []float64{17, 39}}, 0) {
+		t.Errorf("Unexpected expression %+v", expr)
+	}
+}
+
+func TestScheduleTasks_MatrixScalarResult(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	expr := submitExpression(t, orchestrator, "1", "det([[4,7],[2,6]])+dot([1,2],[3,4])+det(5)")
+	if tasks := runMatrixTasks(t, orchestrator, router); tasks != 5 {
+		t.Errorf("Expected 5 tasks, got %d", tasks)
+	}
+	if expr.Status != "completed" || expr.Result == nil || *expr.Result != 26 || expr.MatrixResult != nil {
+		t.Errorf("Expected result 26, got %+v", expr)
+	}
+}
+
+func TestScheduleTasks_MatrixBlocks(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.Config.MatrixBlockSize = 8
+	router := gin.Default()
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	expr := submitExpression(t, orchestrator, "1", "[[1,2],[3,4],[5,6],[7,8],[9,10]]*[[1,0],[0,1]]*2")
+	if orchestrator.taskQueue.Len() != 3 {
+		t.Fatalf("Expected the product to be split into 3 blocks, got %d tasks", orchestrator.taskQueue.Len())
+	}
+	orchestrator.taskQueue.Each(func(v interface{}) bool {
+		task := v.(*Task)
+		if task.Operation != "*" || task.Matrices[0].Rows > 2 {
+			t.Errorf("Unexpected block task %+v", task)
+		}
+		return true
+	})
+	if tasks := runMatrixTasks(t, orchestrator, router); tasks != 4 {
+		t.Errorf("Expected 3 blocks and a scaling task, got %d tasks", tasks)
+	}
+	want := &matrix.Matrix{Rows: 5, Cols: 2, Data: []float64{2, 4, 6, 8, 10, 12, 14, 16, 18, 20}}
+	if expr.Status != "completed" || !matrix.Equal(expr.MatrixResult, want, 0) {
+		t.Errorf("Unexpected expression %+v %v", expr, expr.MatrixResult)
+	}
+}
+
+func TestScheduleTasks_MatrixErrors(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	expr := submitExpression(t, orchestrator, "1", "[1,2]*i")
+	if expr.Status != "failed" || expr.Error != "complex matrices are not supported" {
+		t.Errorf("Expected complex matrices to fail, got %+v", expr)
+	}
+
+	expr = submitExpression(t, orchestrator, "2", "[1,2]+0")
+	task := orchestrator.taskQueue.PopFront().(*Task)
+	if task.Operation != "+" || len(task.Matrices) != 2 {
+		t.Fatalf("Expected [1,2]+0 to be left for an agent, got %+v", task)
+	}
+	_, err := ops.ApplyMatrix(task.Operation, task.Matrices...)
+	if err == nil {
+		t.Fatal("Expected adding a number to a vector to fail")
+	}
+	if recorder := postResult(t, router, `{"id":"`+task.ID+`","error":"`+err.Error()+`"}`); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", recorder.Code)
+	}
+	if expr.Status != "failed" || expr.Error != "cannot add 2x1 and 1x1 matrices" {
+		t.Errorf("Unexpected expression %+v", expr)
+	}
+}
@@ -0,0 +1,274 @@
+package app
+
+import "Yandex_Calc_V2.0/internal/ops"
+
+const FOLD_COST_THRESHOLD_MS = 0
+
+// OptimizerConfig selects the rewrite rules applied to an AST between
+// parsing and scheduling.
+type OptimizerConfig struct {
+	Enabled bool
+	// Identities removes neutral operands: x*1, 1*x, x/1, x+0, 0+x, x-0,
+	// and collapses 0*x and x*0 to 0 when x cannot fail.
+	Identities bool
+	// FoldCostThreshold is the largest summed operation time (ms) of a
+	// subtree that the orchestrator evaluates itself instead of sending
+	// its operations to agents. Zero disables folding.
+	FoldCostThreshold int
+	// Reassociate turns chains of + or * into balanced trees so that more
+	// operations are ready at the same time, see balance.go.
+	Reassociate bool
+	// AllowInexactReassociation also rebalances chains whose result may
+	// differ in the last bits because float addition and multiplication
+	// are not associative.
+	AllowInexactReassociation bool
+}
+
+func SetDefaultOptimizerConfig() OptimizerConfig {
+	return OptimizerConfig{
+		Enabled:           true,
+		Identities:        true,
+		FoldCostThreshold: FOLD_COST_THRESHOLD_MS,
+		Reassociate:       true,
+	}
+}
+
+type Rewrite struct {
+	Rule   string `json:"rule" example:"identity"`
+	Before string `json:"before" example:"(2+3)*1"`
+	After  string `json:"after" example:"2+3"`
+}
+
+type OptimizationReport struct {
+	Rewrites        []Rewrite `json:"rewrites"`
+	OperationsSaved int       `json:"operations_saved"`
+}
+
+type optimizer struct {
+	config OptimizerConfig
+	cost   func(op string) int
+	report *OptimizationReport
+}
+
+// Optimize rewrites the AST according to the configuration and returns the
+// new root together with a report of the applied rewrites. strictOrder keeps
+// the evaluation order written by the client.
+func (o *Orchestrator) Optimize(node *ASTNode, strictOrder bool) (*ASTNode, *OptimizationReport) {
+	report := &OptimizationReport{Rewrites: make([]Rewrite, 0)}
+	if !o.Config.Optimizer.Enabled || node == nil {
+		return node, report
+	}
+	opt := &optimizer{config: o.Config.Optimizer, cost: o.operationTime, report: report}
+	if strictOrder {
+		opt.config.Reassociate = false
+	}
+	before := countOperations(node)
+	if opt.config.Identities {
+		node = opt.identities(node)
+	}
+	if opt.config.FoldCostThreshold > 0 {
+		node = opt.fold(node)
+	}
+	if opt.config.Reassociate {
+		node = opt.balance(node)
+	}
+	report.OperationsSaved = before - countOperations(node)
+	return node, report
+}
+
+func (opt *optimizer) record(rule string, before, after *ASTNode) {
+	opt.report.Rewrites = append(opt.report.Rewrites, Rewrite{
+		Rule:   rule,
+		Before: before.String(),
+		After:  after.String(),
+	})
+}
+
+func isOperation(node *ASTNode) bool {
+	return node != nil && !node.IsLeaf && node.Left != nil && node.Right != nil
+}
+
+// isCall reports whether the node applies a built-in function to Left.
+func isCall(node *ASTNode) bool {
+	return node != nil && !node.IsLeaf && node.Left != nil && node.Right == nil
+}
+
+func isConstant(node *ASTNode, value float64) bool {
+	return node != nil && node.IsLeaf && node.Variable == "" && node.Value == value && node.Imag == 0 && node.Matrix == nil
+}
+
+func countOperations(node *ASTNode) int {
+	if isArgumentList(node) || isControl(node) || isBranches(node) {
+		return countOperations(node.Left) + countOperations(node.Right)
+	}
+	if isCall(node) {
+		return 1 + countOperations(node.Left)
+	}
+	if !isOperation(node) {
+		return 0
+	}
+	return 1 + countOperations(node.Left) + countOperations(node.Right)
+}
+
+// canFail reports whether evaluating the subtree may give an error or a
+// special value: division by zero, a function or power without a finite
+// result, matrices of the wrong shape, an inf or nan leaf or an overflow,
+// which 0*x must not turn into 0.
+func canFail(node *ASTNode) bool {
+	if isCall(node) {
+		return true
+	}
+	if !isOperation(node) {
+		return node != nil && (node.Matrix != nil || hasSpecialValues(node))
+	}
+	if _, ok := ops.LookupKind(node.Operator, ops.Function); ok {
+		return true
+	}
+	if node.Operator == "/" || node.Operator == "^" || canFail(node.Left) || canFail(node.Right) {
+		return true
+	}
+	if node.Operator == "+" || node.Operator == "-" || node.Operator == "*" {
+		// Finite operands can still overflow to ±Inf.
+		if hasImaginary(node) {
+			return true
+		}
+		value, err := evaluateLocally(node)
+		return err != nil || !isFinite(value)
+	}
+	return false
+}
+
+func (opt *optimizer) identities(node *ASTNode) *ASTNode {
+	if isCall(node) {
+		node.Left = opt.identities(node.Left)
+		return node
+	}
+	if !isOperation(node) {
+		return node
+	}
+	node.Left = opt.identities(node.Left)
+	node.Right = opt.identities(node.Right)
+	if hasMatrix(node.Left) || hasMatrix(node.Right) {
+		// A+0 fails and 0*A is a matrix; neither may be simplified.
+		return node
+	}
+	var result *ASTNode
+	switch node.Operator {
+	case "+":
+		if isConstant(node.Left, 0) {
+			result = node.Right
+		} else if isConstant(node.Right, 0) {
+			result = node.Left
+		}
+	case "-":
+		if isConstant(node.Right, 0) {
+			result = node.Left
+		}
+	case "*":
+		if isConstant(node.Left, 1) {
+			result = node.Right
+		} else if isConstant(node.Right, 1) {
+			result = node.Left
+		} else if isConstant(node.Left, 0) && !canFail(node.Right) {
+			result = &ASTNode{IsLeaf: true, Value: 0}
+		} else if isConstant(node.Right, 0) && !canFail(node.Left) {
+			result = &ASTNode{IsLeaf: true, Value: 0}
+		}
+	case "/":
+		if isConstant(node.Right, 1) {
+			result = node.Left
+		}
+	}
+	if result == nil {
+		return node
+	}
+	opt.record("identity", node, result)
+	return result
+}
+
+func (opt *optimizer) subtreeCost(node *ASTNode) int {
+	if isArgumentList(node) || isControl(node) {
+		return opt.subtreeCost(node.Left) + opt.subtreeCost(node.Right)
+	}
+	if isBranches(node) {
+		return max(opt.subtreeCost(node.Left), opt.subtreeCost(node.Right))
+	}
+	if isCall(node) {
+		return opt.cost(node.Operator) + opt.subtreeCost(node.Left)
+	}
+	if !isOperation(node) {
+		return 0
+	}
+	return opt.cost(node.Operator) + opt.subtreeCost(node.Left) + opt.subtreeCost(node.Right)
+}
+
+func evaluateLocally(node *ASTNode) (float64, error) {
+	if isControl(node) {
+		x, err := evaluateLocally(node.Left)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case isConditional(node) && x != 0:
+			return evaluateLocally(node.Right.Left)
+		case isConditional(node):
+			return evaluateLocally(node.Right.Right)
+		case (x != 0) == (node.Operator == "||"):
+			return truthValue(x != 0), nil
+		}
+		y, err := evaluateLocally(node.Right)
+		return truthValue(y != 0), err
+	}
+	if args := callArguments(node); args != nil {
+		values := make([]float64, len(args))
+		for i, arg := range args {
+			x, err := evaluateLocally(arg)
+			if err != nil {
+				return 0, err
+			}
+			values[i] = x
+		}
+		return ops.Apply(node.Operator, values...)
+	}
+	if isCall(node) {
+		x, err := evaluateLocally(node.Left)
+		if err != nil {
+			return 0, err
+		}
+		return ops.Apply(node.Operator, x)
+	}
+	if !isOperation(node) {
+		return node.Value, nil
+	}
+	x, err := evaluateLocally(node.Left)
+	if err != nil {
+		return 0, err
+	}
+	y, err := evaluateLocally(node.Right)
+	if err != nil {
+		return 0, err
+	}
+	return ops.Apply(node.Operator, x, y)
+}
+
+// fold evaluates the largest subtrees whose cost fits under the threshold.
+// Subtrees that fail locally (division by zero) are left for the agents so
+// that the error is reported the usual way, and so are complex and matrix
+// subtrees.
+func (opt *optimizer) fold(node *ASTNode) *ASTNode {
+	if !isOperation(node) && !isCall(node) {
+		return node
+	}
+	if opt.subtreeCost(node) <= opt.config.FoldCostThreshold && !hasImaginary(node) && !hasMatrix(node) {
+		if value, err := evaluateLocally(node); err == nil {
+			result := &ASTNode{IsLeaf: true, Value: value}
+			opt.record("constant-fold", node, result)
+			return result
+		}
+	}
+	node.Left = opt.fold(node.Left)
+	if node.Right != nil {
+		node.Right = opt.fold(node.Right)
+	}
+	return node
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     OptimizerConfig
+		expression string
+		expected   string
+		rules      []string
+		saved      int
+	}{
+		{
+			name:       "Multiplicative Identity",
+			config:     OptimizerConfig{Enabled: true, Identities: true},
+			expression: "(2+3)*1",
+			expected:   "2+3",
+			rules:      []string{"identity"},
+			saved:      1,
+		},
+		{
+			name:       "Additive Identities",
+			config:     OptimizerConfig{Enabled: true, Identities: true},
+			expression: "0+(4-0)/1",
+			expected:   "4",
+			rules:      []string{"identity", "identity", "identity"},
+			saved:      3,
+		},
+		{
+			name:       "Zero Product",
+			config:     OptimizerConfig{Enabled: true, Identities: true},
+			expression: "0*(2+3*4)+5",
+			expected:   "5",
+			rules:      []string{"identity", "identity"},
+			saved:      4,
+		},
+		{
+			name:       "Zero Product Keeps Division",
+			config:     OptimizerConfig{Enabled: true, Identities: true},
+			expression: "(1/0)*0",
+			expected:   "1/0*0",
+			saved:      0,
+		},
+		{
+			name:       "Zero Product Keeps Overflow",
+			config:     OptimizerConfig{Enabled: true, Identities: true},
+			expression: "0*(1e308*10)",
+			expected:   "0*(1e+308*10)",
+			saved:      0,
+		},
+		{
+			name:       "Fold Under Threshold",
+			config:     OptimizerConfig{Enabled: true, FoldCostThreshold: 400},
+			expression: "(1+2)*(3+4+5)",
+			expected:   "3*12",
+			rules:      []string{"constant-fold", "constant-fold"},
+			saved:      3,
+		},
+		{
+			name:       "Fold Skips Division By Zero",
+			config:     OptimizerConfig{Enabled: true, FoldCostThreshold: 1000},
+			expression: "(2+2)/0",
+			expected:   "4/0",
+			rules:      []string{"constant-fold"},
+			saved:      1,
+		},
+		{
+			name:       "Reassociate",
+			config:     OptimizerConfig{Enabled: true, Reassociate: true},
+			expression: "1+2+3+4+5+6+7+8",
+			expected:   "1+2+(3+4)+(5+6+(7+8))",
+			rules:      []string{"reassociate"},
+			saved:      0,
+		},
+		{
+			name:       "Disabled",
+			config:     OptimizerConfig{Enabled: false, Identities: true, Reassociate: true},
+			expression: "1*2+0",
+			expected:   "1*2+0",
+			saved:      0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			orchestrator := NewOrchestrator()
+			orchestrator.Config.Optimizer = test.config
+			ast, err := ParseAST(test.expression)
+			if err != nil {
+				t.Fatalf("Failed to parse %q: %v", test.expression, err)
+			}
+
+			result, report := orchestrator.Optimize(ast, false)
+
+			if result.String() != test.expected {
+				t.Errorf("Expected %s, got %s", test.expected, result.String())
+			}
+			if len(report.Rewrites) != len(test.rules) {
+				t.Fatalf("Expected %d rewrites, got %+v", len(test.rules), report.Rewrites)
+			}
+			for i, rule := range test.rules {
+				if report.Rewrites[i].Rule != rule {
+					t.Errorf("Expected rewrite %d to be %s, got %s", i, rule, report.Rewrites[i].Rule)
+				}
+			}
+			if report.OperationsSaved != test.saved {
+				t.Errorf("Expected %d saved operations, got %d", test.saved, report.OperationsSaved)
+			}
+		})
+	}
+}
+
+func TestHandleCalculateRequest_ReportsOptimizations(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/api/v1/calculate", orchestrator.handleCalculateRequest)
+	router.GET("/api/v1/expressions/:id", orchestrator.handleExpressionByIdRequest)
+
+	req, err := http.NewRequest("POST", "/api/v1/calculate", bytes.NewBufferString(`{"expression": "(2+3)*1"}`))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if orchestrator.taskQueue.Len() != 1 {
+		t.Errorf("Expected a single task after optimization, got %d", orchestrator.taskQueue.Len())
+	}
+
+	req, err = http.NewRequest("GET", "/api/v1/expressions/1", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	expected := `"optimizations":{"rewrites":[{"rule":"identity","before":"(2+3)*1","after":"2+3"}],"operations_saved":1}`
+	if !strings.Contains(recorder.Body.String(), expected) {
+		t.Errorf("Expected %s in %s", expected, recorder.Body.String())
+	}
+}
@@ -2,7 +2,11 @@ package app
 
 import (
 	"Yandex_Calc_V2.0/internal/eval"
+	"Yandex_Calc_V2.0/internal/lru"
+	"Yandex_Calc_V2.0/internal/matrix"
+	"Yandex_Calc_V2.0/internal/ops"
 	"Yandex_Calc_V2.0/internal/queue"
+	"errors"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"log"
 	"net/http"
@@ -22,6 +26,9 @@ const (
 	TIME_SUBTRACTION_MS     = 152
 	TIME_MULTIPLICATIONS_MS = 228
 	TIME_DIVISIONS_MS       = 300
+	RESULT_CACHE_SIZE       = 4096
+	DEFAULT_USER            = "anonymous"
+	USER_HEADER             = "X-User-ID"
 )
 
 // Error swagger model
@@ -31,21 +38,69 @@ type Error struct {
 }
 
 type Task struct {
-	ID            string   `json:"id"`
-	ExprID        string   `json:"-"`
-	Arg1          float64  `json:"arg1"`
-	Arg2          float64  `json:"arg2"`
-	Operation     string   `json:"operation"`
-	OperationTime int      `json:"operation_time"`
-	Node          *ASTNode `json:"-"`
+	ID            string           `json:"id"`
+	ExprID        string           `json:"-"`
+	Arg1          float64          `json:"arg1"`
+	Arg2          float64          `json:"arg2"`
+	Args          []float64        `json:"args,omitempty"`
+	ComplexArgs   []ComplexValue   `json:"complex_args,omitempty"`
+	Matrices      []*matrix.Matrix `json:"matrices,omitempty"`
+	Operation     string           `json:"operation"`
+	OperationTime int              `json:"operation_time"`
+	Node          *ASTNode         `json:"-"`
+	Followers     []TaskFollower   `json:"-"`
+	Key           string           `json:"-"`
+	Cancelled     bool             `json:"-"`
 }
 
 type Expression struct {
-	ID     string   `json:"id"`
-	Expr   string   `json:"expression"`
-	Status string   `json:"status"`
-	Result *float64 `json:"result,omitempty"`
-	AST    *ASTNode `json:"-"`
+	ID            string              `json:"id"`
+	Expr          string              `json:"expression"`
+	Status        string              `json:"status"`
+	Result        *float64            `json:"result,omitempty"`
+	SpecialResult string              `json:"special_result,omitempty"`
+	ComplexResult *ComplexValue       `json:"complex_result,omitempty"`
+	MatrixResult  *matrix.Matrix      `json:"matrix_result,omitempty"`
+	Unit          string              `json:"unit,omitempty"`
+	Error         string              `json:"error,omitempty"`
+	CreatedAt     *time.Time          `json:"created_at,omitempty"`
+	CompletedAt   *time.Time          `json:"completed_at,omitempty"`
+	Optimizations *OptimizationReport `json:"optimizations,omitempty"`
+	CriticalPath  *CriticalPath       `json:"critical_path,omitempty"`
+	Owner         string              `json:"-"`
+	AST           *ASTNode            `json:"-"`
+	// Expanded is the expression with user-defined functions expanded, used
+	// for verification when Expr contains calls eval does not know.
+	Expanded string `json:"-"`
+	// Options are the options Expr was parsed with.
+	Options ParseOptions `json:"-"`
+	// JobID is set on the samples of a job; sample is the index of the
+	// sample's point in the job's round and recorded tells that the job has
+	// seen the sample finish.
+	JobID    string `json:"job_id,omitempty"`
+	sample   int
+	recorded bool
+}
+
+func (e *Expression) syncStatus() {
+	if e.Status == "cancelled" || e.Status == "failed" {
+		return
+	}
+	if e.AST != nil && e.AST.IsLeaf {
+		e.Status = "completed"
+		e.setResult()
+	}
+}
+
+func isFinished(e *Expression) bool {
+	return e.Status == "completed" || e.Status == "failed" || e.Status == "cancelled"
+}
+
+func (e *Expression) finishedAt() *time.Time {
+	if e.CompletedAt != nil {
+		return e.CompletedAt
+	}
+	return e.CreatedAt
 }
 
 type OrchestratorConfig struct {
@@ -54,6 +109,28 @@ type OrchestratorConfig struct {
 	TimeForSubtraction    int
 	TimeForMultiplication int
 	TimeForDivision       int
+	Retention             RetentionPolicy
+	IdempotencyWindow     time.Duration
+	DeduplicateTasks      bool
+	ResultCacheSize       int
+	Optimizer             OptimizerConfig
+	ReductionTasks        bool
+	MinReductionArity     int
+	AgentTTL              time.Duration
+	// MatrixBlockSize is the largest number of multiply-adds of one matrix
+	// multiplication task. Larger products are split into row blocks; zero
+	// disables splitting.
+	MatrixBlockSize int
+	// AggregateChunkSize is the largest number of arguments of one task of
+	// a variadic function such as min. Longer argument lists are split into
+	// partial aggregations; zero disables splitting.
+	AggregateChunkSize int
+	// SpecialValues allows the literals inf and nan and results that are
+	// not finite, like 1e308*10; otherwise such results fail the expression.
+	SpecialValues bool
+	// SweepMaxInFlight is the largest number of points of all sweeps being
+	// calculated at a time; zero disables the limit.
+	SweepMaxInFlight int
 }
 
 func SetDefaultOrchestratorConfig() *OrchestratorConfig {
@@ -63,6 +140,18 @@ func SetDefaultOrchestratorConfig() *OrchestratorConfig {
 		TimeForSubtraction:    TIME_SUBTRACTION_MS,
 		TimeForMultiplication: TIME_MULTIPLICATIONS_MS,
 		TimeForDivision:       TIME_DIVISIONS_MS,
+		Retention:             SetDefaultRetentionPolicy(),
+		IdempotencyWindow:     IDEMPOTENCY_WINDOW,
+		DeduplicateTasks:      true,
+		ResultCacheSize:       RESULT_CACHE_SIZE,
+		Optimizer:             SetDefaultOptimizerConfig(),
+		ReductionTasks:        false,
+		MinReductionArity:     MIN_REDUCTION_ARITY,
+		AgentTTL:              AGENT_TTL,
+		MatrixBlockSize:       MATRIX_BLOCK_SIZE,
+		AggregateChunkSize:    AGGREGATE_CHUNK_SIZE,
+		SpecialValues:         false,
+		SweepMaxInFlight:      SWEEP_MAX_IN_FLIGHT,
 	}
 }
 
@@ -74,21 +163,47 @@ type Orchestrator struct {
 	mutex             sync.Mutex
 	expressionCounter int64
 	taskCounter       int64
+	janitorStats      JanitorStats
+	idempotency       IdempotencyStore
+	pendingTasks      map[string]*Task
+	resultCache       *lru.Cache
+	sharingStats      SharingStats
+	functions         *FunctionRegistry
+	agents            map[string]*AgentInfo
+	jobStore          map[string]*Job
+	jobCounter        int64
+	sweepQueue        []*Job
+	sweepInFlight     int
+	pumping           bool
+	importReports     map[string]*ImportReport
+	importCounter     int64
 }
 
 func NewOrchestrator() *Orchestrator {
+	config := SetDefaultOrchestratorConfig()
 	return &Orchestrator{
-		Config:          SetDefaultOrchestratorConfig(),
+		Config:          config,
 		expressionStore: make(map[string]*Expression),
 		taskStorage:     make(map[string]*Task),
 		taskQueue:       *queue.New(),
+		idempotency:     NewMemoryIdempotencyStore(),
+		pendingTasks:    make(map[string]*Task),
+		resultCache:     lru.New(config.ResultCacheSize),
+		functions:       NewFunctionRegistry(),
+		agents:          make(map[string]*AgentInfo),
+		jobStore:        make(map[string]*Job),
+		importReports:   make(map[string]*ImportReport),
 	}
 }
 
 // ExpressionRequest swagger model
 // @Description Математическое выражение для расчёта
 type ExpressionRequest struct {
-	Expression string `json:"expression" binding:"required" example:"2+3*4-5/2"`
+	Expression  string `json:"expression" binding:"required" example:"2+3*4-5/2"`
+	StrictOrder bool   `json:"strict_order,omitempty" example:"false"`
+	// NaturalNotation allows implicit multiplication (2pi, 3(4+5)) and the
+	// postfix factorial 5!.
+	NaturalNotation bool `json:"natural_notation,omitempty" example:"false"`
 }
 
 // @Summary Schedule mathematical expression calculation
@@ -97,8 +212,11 @@ type ExpressionRequest struct {
 // @Accept json
 // @Produce json
 // @Param expression body ExpressionRequest true "Mathematical expression to calculate"
+// @Param Idempotency-Key header string false "Retry key: the same key and body return the original calculation ID"
 // @Success 201 {object} ExpressionResponse "Calculation ID"
 // @Failure 400 {object} Error "Invalid request body"
+// @Failure 409 {object} Error "Idempotency key reused with a different body"
+// @Failure 422 {object} ParseErrorResponse "Invalid expression with the parse errors, or incompatible units"
 // @Failure 500 {object} Error "Internal server error"
 // @Router /calculate [post]
 func (o *Orchestrator) handleCalculateRequest(c *gin.Context) {
@@ -107,61 +225,163 @@ func (o *Orchestrator) handleCalculateRequest(c *gin.Context) {
 		return
 	}
 	var req ExpressionRequest
-	if err := c.ShouldBindJSON(&req); err != nil || req.Expression == "" {
+	valid := c.ShouldBindJSON(&req) == nil && req.Expression != ""
+	now := time.Now()
+	owner := userFromRequest(c)
+	key := c.GetHeader(IDEMPOTENCY_HEADER)
+	bodyHash := hashRequest(&req)
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	// A reused key is checked first: any other body, even an invalid one,
+	// conflicts with it.
+	if key != "" {
+		if record, ok := o.idempotency.Get(owner, key); ok && now.Sub(record.CreatedAt) <= o.Config.IdempotencyWindow {
+			if !valid || record.BodyHash != bodyHash {
+				c.JSON(http.StatusConflict, gin.H{"error": "Idempotency key reused with a different body"})
+				return
+			}
+			c.Header("Idempotent-Replayed", "true")
+			c.JSON(http.StatusCreated, gin.H{"id": record.ExprID})
+			return
+		}
+	}
+	if !valid {
 		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid Body"})
 		return
 	}
-	ast, err := ParseAST(req.Expression)
+	expr, ast, expanded, err := o.newExpression(owner, &req, now)
 	if err != nil {
-		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid expression"})
+		var parseErrors ParseErrors
+		if errors.As(err, &parseErrors) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid expression", "errors": parseErrors})
+			return
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
 		return
 	}
-	o.mutex.Lock()
-	o.expressionCounter++
-	exprID := strconv.FormatInt(o.expressionCounter, 10)
+	exprID := o.startExpression(expr, ast, expanded, req.StrictOrder)
+	if key != "" {
+		err := o.idempotency.Put(&IdempotencyRecord{
+			Owner:     owner,
+			Key:       key,
+			BodyHash:  bodyHash,
+			ExprID:    exprID,
+			CreatedAt: now,
+		})
+		if err != nil {
+			log.Printf("Failed to store idempotency key: %v", err)
+		}
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": exprID})
+}
+
+// newExpression parses the request into an expression that is ready to be
+// started. The error is ParseErrors or a units error.
+func (o *Orchestrator) newExpression(owner string, req *ExpressionRequest, now time.Time) (*Expression, *ASTNode, bool, error) {
+	options := o.parseOptions()
+	options.Natural = req.NaturalNotation
+	ast, expanded, err := o.functions.Parse(owner, req.Expression, options)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	unit, err := unitOf(ast)
+	if err != nil {
+		return nil, nil, false, errors.New("Incompatible units: " + err.Error())
+	}
 	expr := &Expression{
-		ID:     exprID,
-		Expr:   req.Expression,
-		Status: "pending",
-		AST:    ast,
+		Expr:      req.Expression,
+		CreatedAt: &now,
+		Unit:      unit.String(),
+		Owner:     owner,
+		Options:   options,
+	}
+	return expr, ast, expanded, nil
+}
+
+// startExpression optimizes the parsed expression, stores it under a new ID
+// and schedules its tasks. expanded tells that the AST has calls of
+// user-defined functions expanded.
+func (o *Orchestrator) startExpression(expr *Expression, ast *ASTNode, expanded, strictOrder bool) string {
+	source := ast.String()
+	ast, report := o.Optimize(ast, strictOrder)
+	path := o.criticalPath(ast)
+	o.expressionCounter++
+	expr.ID = strconv.FormatInt(o.expressionCounter, 10)
+	expr.Status = "pending"
+	expr.AST = ast
+	if expanded {
+		expr.Expanded = source
 	}
-	o.expressionStore[exprID] = expr
+	if len(report.Rewrites) > 0 {
+		expr.Optimizations = report
+	}
+	if path.Operations > 0 {
+		expr.CriticalPath = &path
+	}
+	o.expressionStore[expr.ID] = expr
 	o.scheduleTasksForExpression(expr)
-	o.mutex.Unlock()
-	c.JSON(http.StatusCreated, gin.H{"id": exprID})
+	if err := o.completeExpression(expr); err != nil {
+		log.Printf("Expression %s: %v", expr.ID, err)
+	}
+	return expr.ID
 }
 
 // ExpressionsResponse swagger model
 // @Description Ответ с идентификатором задачи
 type ExpressionsResponse struct {
-	ID         string   `json:"id" example:"1"`
-	Expression string   `json:"expression" example:"2+3*4-5/2"`
-	Status     string   `json:"status" example:"completed"`
-	Result     *float64 `json:"result,omitempty" example:"11.5"`
+	ID            string         `json:"id" example:"1"`
+	Expression    string         `json:"expression" example:"2+3*4-5/2"`
+	Status        string         `json:"status" example:"completed"`
+	Result        *float64       `json:"result,omitempty" example:"11.5"`
+	SpecialResult string         `json:"special_result,omitempty" example:"inf"`
+	ComplexResult *ComplexValue  `json:"complex_result,omitempty"`
+	MatrixResult  *matrix.Matrix `json:"matrix_result,omitempty"`
+	Unit          string         `json:"unit,omitempty" example:"kg*m/s^2"`
+	CreatedAt     *time.Time     `json:"created_at,omitempty"`
+	CompletedAt   *time.Time     `json:"completed_at,omitempty"`
 }
 
-// @Summary Get all calculated expressions
-// @Description Retrieve list of all expressions with their current status
+// ExpressionsPageResponse swagger model
+// @Description Страница списка выражений
+type ExpressionsPageResponse struct {
+	Expressions []ExpressionsResponse `json:"expressions"`
+	NextCursor  string                `json:"next_cursor,omitempty" example:"aWQ6ZmFsc2U6MTAwOjEwMA"`
+	Total       int                   `json:"total" example:"250"`
+}
+
+// @Summary Get calculated expressions
+// @Description Retrieve a page of expressions filtered by status, creation time and expression text
 // @Tags calculations
 // @Produce json
-// @Success 200 {array} ExpressionsResponse
+// @Param limit query int false "Page size (default 100, max 1000)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param status query string false "Comma-separated statuses"
+// @Param created_from query string false "RFC3339 lower bound of created_at (inclusive)"
+// @Param created_to query string false "RFC3339 upper bound of created_at (exclusive)"
+// @Param q query string false "Expression substring"
+// @Param sort query string false "Sort field: id, created_at or completed_at"
+// @Param order query string false "Sort order: asc or desc"
+// @Success 200 {object} ExpressionsPageResponse
+// @Failure 400 {object} Error "Invalid query parameter"
 // @Router /expressions [get]
 func (o *Orchestrator) handleExpressionsRequest(c *gin.Context) {
 	if c.Request.Method != http.MethodGet {
 		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
 		return
 	}
+	query, err := parseListQuery(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	o.mutex.Lock()
 	defer o.mutex.Unlock()
-	exprs := make([]*Expression, 0, len(o.expressionStore))
-	for _, expr := range o.expressionStore {
-		if expr.AST != nil && expr.AST.IsLeaf {
-			expr.Status = "completed"
-			expr.Result = &expr.AST.Value
-		}
-		exprs = append(exprs, expr)
+	exprs, total, next := query.apply(o.expressionStore)
+	resp := gin.H{"expressions": exprs, "total": total}
+	if next != "" {
+		resp["next_cursor"] = next
 	}
-	c.JSON(http.StatusOK, gin.H{"expressions": exprs})
+	c.JSON(http.StatusOK, resp)
 }
 
 // ExpressionResponse swagger model
@@ -191,17 +411,128 @@ func (o *Orchestrator) handleExpressionByIdRequest(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Expression not found"})
 		return
 	}
-	if expr.AST != nil && expr.AST.IsLeaf {
-		expr.Status = "completed"
-		expr.Result = &expr.AST.Value
-	}
+	expr.syncStatus()
 	c.JSON(http.StatusOK, gin.H{"expression": expr})
 }
 
+// @Summary Cancel or purge expression
+// @Description Cancel an in-flight expression and drop its queued tasks. With purge=true the expression is also removed from the store
+// @Tags calculations
+// @Produce json
+// @Param id path string true "Expression ID"
+// @Param purge query bool false "Remove the expression from the store"
+// @Success 200 {object} SuccessResponse "Expression cancelled or purged"
+// @Failure 404 {object} Error "Expression not found"
+// @Failure 409 {object} Error "Expression already completed"
+// @Router /expressions/{id} [delete]
+func (o *Orchestrator) handleDeleteExpressionRequest(c *gin.Context) {
+	if c.Request.Method != http.MethodDelete {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
+		return
+	}
+	id := c.Param("id")
+	purge := c.Query("purge") == "true"
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	expr, ok := o.expressionStore[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Expression not found"})
+		return
+	}
+	expr.syncStatus()
+	if isFinished(expr) && !purge {
+		c.JSON(http.StatusConflict, gin.H{"error": "Expression already " + expr.Status})
+		return
+	}
+	if expr.Status == "pending" || expr.Status == "in_progress" {
+		o.cancelExpression(expr)
+	}
+	if purge {
+		delete(o.expressionStore, id)
+		c.JSON(http.StatusOK, gin.H{"status": "purged"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "cancelled"})
+}
+
+// PurgeResponse swagger model
+// @Description Количество удалённых выражений
+type PurgeResponse struct {
+	Purged int `json:"purged" example:"3"`
+}
+
+// @Summary Purge finished expressions
+// @Description Remove all completed, failed and cancelled expressions from the store
+// @Tags calculations
+// @Produce json
+// @Success 200 {object} PurgeResponse
+// @Router /expressions [delete]
+func (o *Orchestrator) handlePurgeExpressionsRequest(c *gin.Context) {
+	if c.Request.Method != http.MethodDelete {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
+		return
+	}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	purged := 0
+	for id, expr := range o.expressionStore {
+		expr.syncStatus()
+		if isFinished(expr) {
+			delete(o.expressionStore, id)
+			purged++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
+
+func (o *Orchestrator) cancelExpression(expr *Expression) {
+	expr.Status = "cancelled"
+	expr.Result, expr.SpecialResult, expr.ComplexResult, expr.MatrixResult = nil, "", nil, nil
+	o.dropTasks(expr)
+	o.finishSample(expr)
+}
+
+func (o *Orchestrator) failExpression(expr *Expression, reason string) {
+	now := time.Now()
+	expr.Status = "failed"
+	expr.Error = reason
+	expr.Result, expr.SpecialResult, expr.ComplexResult, expr.MatrixResult = nil, "", nil, nil
+	expr.CompletedAt = &now
+	o.dropTasks(expr)
+	o.finishSample(expr)
+}
+
+func (o *Orchestrator) dropTasks(expr *Expression) {
+	o.taskQueue.RemoveIf(func(v interface{}) bool {
+		task, ok := v.(*Task)
+		if !ok || !task.detach(expr.ID) {
+			return false
+		}
+		o.forgetTask(task)
+		delete(o.taskStorage, task.ID)
+		return true
+	})
+	for _, task := range o.taskStorage {
+		if task.detach(expr.ID) {
+			o.forgetTask(task)
+			task.Cancelled = true
+		}
+	}
+}
+
+func userFromRequest(c *gin.Context) string {
+	if user := c.GetHeader(USER_HEADER); user != "" {
+		return user
+	}
+	return DEFAULT_USER
+}
+
 // @Summary Fetch next available task
-// @Description Get the next task from the calculation queue (internal use)
+// @Description Get the next task from the calculation queue that the agent can run (internal use)
 // @Tags internal
 // @Produce json
+// @Param X-Agent-Capabilities header string false "Comma-separated extra operations the agent supports, e.g. sum,prod"
+// @Param X-Agent-ID header string false "Agent identifier, defaults to the client IP"
 // @Success 200 {object} TaskResponse
 // @Failure 404 {object} Error "No tasks available"
 // @Router /internal/task [get]
@@ -210,15 +541,20 @@ func (o *Orchestrator) handleGetTaskRequest(c *gin.Context) {
 		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
 		return
 	}
+	capabilities := agentCapabilities(c)
 	o.mutex.Lock()
 	defer o.mutex.Unlock()
+	agent := o.touchAgent(agentID(c), capabilities, time.Now())
 	if o.taskQueue.Len() == 0 {
 		c.JSON(http.StatusNotFound, gin.H{"error": "No task available"})
 		return
 	}
-	taskInterface := o.taskQueue.PopFront()
+	taskInterface := o.taskQueue.RemoveFirst(func(v interface{}) bool {
+		task, ok := v.(*Task)
+		return !ok || capabilities.canRun(task)
+	})
 	if taskInterface == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error: task is nil"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "No task available"})
 		return
 	}
 	task, ok := taskInterface.(*Task)
@@ -226,8 +562,11 @@ func (o *Orchestrator) handleGetTaskRequest(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error: invalid task type"})
 		return
 	}
-	if expr, exists := o.expressionStore[task.ExprID]; exists {
-		expr.Status = "in_progress"
+	agent.TasksTaken++
+	for _, exprID := range task.exprIDs() {
+		if expr, exists := o.expressionStore[exprID]; exists {
+			expr.Status = "in_progress"
+		}
 	}
 	c.JSON(http.StatusOK, gin.H{"task": task})
 }
@@ -258,6 +597,17 @@ func (o *Orchestrator) handlePostTaskRequest(c *gin.Context) {
 		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid Body"})
 		return
 	}
+	// The body is validated before the task is removed, so the agent can
+	// retry a rejected result.
+	result := complex(req.Result, req.Imag)
+	if req.Special != "" {
+		value, ok := parseSpecial(req.Special)
+		if !ok {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid Body"})
+			return
+		}
+		result = complex(value, req.Imag)
+	}
 	o.mutex.Lock()
 	defer o.mutex.Unlock()
 	task, ok := o.taskStorage[req.ID]
@@ -265,86 +615,310 @@ func (o *Orchestrator) handlePostTaskRequest(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
 		return
 	}
-
-	task.Node.Value = req.Result
-	task.Node.IsLeaf = true
+	if task.Cancelled {
+		delete(o.taskStorage, req.ID)
+		c.JSON(http.StatusGone, gin.H{"error": "Expression cancelled"})
+		return
+	}
 
 	delete(o.taskStorage, req.ID)
-	if expr, exists := o.expressionStore[task.ExprID]; exists {
-		o.scheduleTasksForExpression(expr)
-		if expr.AST.IsLeaf {
-			expr.Status = "completed"
-			tmp, err := eval.Eval(expr.Expr)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Result computation incorrect"})
+	o.forgetTask(task)
+	if req.Error != "" {
+		for _, exprID := range task.exprIDs() {
+			if expr, exists := o.expressionStore[exprID]; exists {
+				o.failExpression(expr, req.Error)
 			}
-			res := eval.BigratToFloat(tmp)
-			if res != expr.AST.Value {
-				expr.Result = &expr.AST.Value
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Result computation incorrect"})
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "error accepted"})
+		return
+	}
+	if task.Key != "" {
+		switch {
+		case req.Matrix != nil:
+			o.resultCache.Put(task.Key, req.Matrix)
+		case req.Imag != 0:
+			o.resultCache.Put(task.Key, result)
+		default:
+			o.resultCache.Put(task.Key, real(result))
+		}
+	}
+
+	var verifyErr error
+	for _, waiter := range task.waiters() {
+		expr, exists := o.expressionStore[waiter.ExprID]
+		if req.Matrix != nil {
+			waiter.Node.setMatrix(req.Matrix)
+		} else if err := o.checkValue(result); err != nil {
+			if exists && !isFinished(expr) {
+				o.failExpression(expr, err.Error())
 			}
+			continue
+		} else {
+			waiter.Node.setComplex(result)
+		}
+		if !exists || isFinished(expr) {
+			continue
+		}
+		o.scheduleTasksForExpression(expr)
+		if err := o.completeExpression(expr); err != nil {
+			verifyErr = err
 		}
 	}
+	if verifyErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Result computation incorrect"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"status": "result accepted"})
 }
 
+// completeExpression marks the expression completed once its AST has been
+// reduced to a single value and verifies the result against eval.
+func (o *Orchestrator) completeExpression(expr *Expression) error {
+	if expr.AST == nil || !expr.AST.IsLeaf || isFinished(expr) {
+		return nil
+	}
+	if err := o.checkValue(expr.AST.complex()); err != nil && expr.AST.Matrix == nil {
+		o.failExpression(expr, err.Error())
+		return nil
+	}
+	now := time.Now()
+	expr.Status = "completed"
+	expr.setResult()
+	expr.CompletedAt = &now
+	defer o.finishSample(expr)
+	source, options := expr.Expr, expr.Options
+	if expr.Expanded != "" {
+		// The expansion is rendered by String in the default notation.
+		source, options.Natural = expr.Expanded, false
+	}
+	ast, err := ParseASTWithOptions(source, options)
+	if err == nil && usesMatrices(ast) {
+		return verifyMatrixResult(ast, expr.AST)
+	}
+	if hasSpecialValues(expr.AST) || (err == nil && hasSpecialValues(ast)) {
+		// eval computes in exact rationals, which have no special values.
+		return nil
+	}
+	return verifyResult(source, eval.Options{Natural: options.Natural}, expr.AST)
+}
+
 func (o *Orchestrator) scheduleTasksForExpression(expr *Expression) {
 	var traverse func(node *ASTNode)
 	traverse = func(node *ASTNode) {
-		if node == nil || node.IsLeaf {
+		if node == nil || node.IsLeaf || isFinished(expr) {
+			return
+		}
+		if isControl(node) {
+			// Only the operands that decide the result are computed: the
+			// branches of a conditional wait for the condition and the right
+			// operand of && and || for the left one.
+			traverse(node.Left)
+			decided, err := decide(node)
+			if err == nil && !decided && isShortCircuit(node) && node.Left.IsLeaf {
+				traverse(node.Right)
+				decided, err = decide(node)
+			}
+			if err != nil {
+				o.failExpression(expr, err.Error())
+			} else if decided {
+				traverse(node)
+			}
+			return
+		}
+		if args := callArguments(node); args != nil {
+			if o.splitAggregate(node) {
+				traverse(node)
+				return
+			}
+			ready := true
+			for _, arg := range args {
+				traverse(arg)
+				ready = ready && arg.IsLeaf
+			}
+			if ready && !node.TaskScheduled {
+				o.scheduleTask(expr, node, node.Operator, args)
+			}
 			return
 		}
+		if operands := o.reductionOperands(node); operands != nil {
+			ready, real := true, true
+			for _, operand := range operands {
+				traverse(operand)
+				ready = ready && operand.IsLeaf
+				real = real && operand.Imag == 0 && operand.Matrix == nil
+			}
+			// Reductions are real only; complex and matrix chains fall
+			// back to binary tasks.
+			if real {
+				if ready && !node.TaskScheduled {
+					o.scheduleTask(expr, node, reductionOperation(node.Operator), operands)
+				}
+				return
+			}
+		}
 		traverse(node.Left)
 		traverse(node.Right)
+		if isCall(node) && node.Left.IsLeaf && !node.TaskScheduled {
+			o.scheduleTask(expr, node, node.Operator, []*ASTNode{node.Left})
+			return
+		}
 		if node.Left != nil && node.Right != nil && node.Left.IsLeaf && node.Right.IsLeaf {
-			if !node.TaskScheduled {
-				o.taskCounter++
-				taskID := strconv.FormatInt(o.taskCounter, 10)
-				var opTime int
-				switch node.Operator {
-				case "+":
-					opTime = o.Config.TimeForAddition
-				case "-":
-					opTime = o.Config.TimeForSubtraction
-				case "*":
-					opTime = o.Config.TimeForMultiplication
-				case "/":
-					opTime = o.Config.TimeForDivision
-				default:
-					opTime = 222
-				}
-				task := &Task{
-					ID:            taskID,
-					ExprID:        expr.ID,
-					Arg1:          node.Left.Value,
-					Arg2:          node.Right.Value,
-					Operation:     node.Operator,
-					OperationTime: opTime,
-					Node:          node,
+			if node.Operator == MATRIX_STACK {
+				if err := stackBlocks(node); err != nil {
+					o.failExpression(expr, err.Error())
 				}
-				node.TaskScheduled = true
-				o.taskStorage[taskID] = task
-				o.taskQueue.PushBack(task)
+				return
+			}
+			if o.splitProduct(node) {
+				traverse(node)
+				return
+			}
+			if !node.TaskScheduled {
+				o.scheduleTask(expr, node, node.Operator, []*ASTNode{node.Left, node.Right})
 			}
 		}
 	}
 	traverse(expr.AST)
 }
 
-func (o *Orchestrator) StartServer() error {
+// scheduleTask queues the operation on the operand leaves. Operands with an
+// imaginary part are sent as complex_args, which only agents with the complex
+// capability take; operands of an operation with a matrix are all sent as
+// matrices for agents with the matrix capability.
+func (o *Orchestrator) scheduleTask(expr *Expression, node *ASTNode, op string, operands []*ASTNode) {
+	args := make([]float64, len(operands))
+	var complexArgs []ComplexValue
+	var matrices []*matrix.Matrix
+	if matrixOnly(op) {
+		matrices = make([]*matrix.Matrix, len(operands))
+	}
+	for i, operand := range operands {
+		args[i] = operand.Value
+		if operand.Imag != 0 && complexArgs == nil {
+			complexArgs = make([]ComplexValue, len(operands))
+		}
+		if operand.Matrix != nil && matrices == nil {
+			matrices = make([]*matrix.Matrix, len(operands))
+		}
+	}
+	if complexArgs != nil && matrices != nil {
+		o.failExpression(expr, "complex matrices are not supported")
+		return
+	}
+	key := resultKey(op, args...)
+	if matrices != nil {
+		for i, operand := range operands {
+			matrices[i] = leafMatrix(operand)
+		}
+		key = matrixKey(op, matrices)
+	}
+	if complexArgs != nil {
+		parts := make([]float64, 0, 2*len(operands))
+		for i, operand := range operands {
+			complexArgs[i] = newComplexValue(operand.complex())
+			parts = append(parts, operand.Value, operand.Imag)
+		}
+		key = resultKey(op+"/"+COMPLEX_CAPABILITY, parts...)
+	}
+	if matrices == nil && complexArgs == nil && !allFinite(args) {
+		o.computeLocally(expr, node, op, args)
+		return
+	}
+	if o.shareTask(expr, node, key) {
+		return
+	}
+	o.taskCounter++
+	taskID := strconv.FormatInt(o.taskCounter, 10)
+	task := &Task{
+		ID:            taskID,
+		ExprID:        expr.ID,
+		Operation:     op,
+		OperationTime: o.operationTime(op),
+		Node:          node,
+		Key:           key,
+	}
+	if matrices != nil {
+		task.Matrices = matrices
+		task.OperationTime = o.matrixOperationTime(op, matrices)
+	} else if complexArgs != nil {
+		task.ComplexArgs = complexArgs
+	} else if isReduction(op) || isVariadic(op) {
+		task.Args = args
+		task.OperationTime *= max(len(args)-1, 1)
+	} else if len(args) != 2 {
+		task.Args = args
+	} else {
+		task.Arg1, task.Arg2 = args[0], args[1]
+	}
+	node.TaskScheduled = true
+	o.taskStorage[taskID] = task
+	o.taskQueue.PushBack(task)
+	if o.Config.DeduplicateTasks {
+		o.pendingTasks[key] = task
+	}
+}
+
+// operationTime returns the simulated time of one application of the
+// operation. The configured times override the registry costs of the four
+// arithmetic operators; a reduction costs as much per step as the operator
+// it folds.
+func (o *Orchestrator) operationTime(op string) int {
+	if reduction, ok := ops.LookupKind(op, ops.Reduction); ok {
+		op = reduction.Reduction
+	}
+	switch op {
+	case "+":
+		return o.Config.TimeForAddition
+	case "-":
+		return o.Config.TimeForSubtraction
+	case "*":
+		return o.Config.TimeForMultiplication
+	case "/":
+		return o.Config.TimeForDivision
+	}
+	if operation, ok := ops.Lookup(op); ok {
+		return operation.Cost
+	}
+	return ops.DEFAULT_COST_MS
+}
+
+// Router returns the HTTP handlers of the orchestrator.
+func (o *Orchestrator) Router() *gin.Engine {
 	r := gin.Default()
 
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
 
 	r.POST("/api/v1/calculate", o.handleCalculateRequest)
+	r.POST("/api/v1/derive", o.handleDeriveRequest)
+	r.POST("/api/v1/jobs", o.handleJobRequest)
+	r.GET("/api/v1/jobs", o.handleJobsRequest)
+	r.GET("/api/v1/jobs/:id", o.handleJobByIdRequest)
+	r.DELETE("/api/v1/jobs/:id", o.handleDeleteJobRequest)
+	r.POST("/api/v1/sweep", o.handleSweepRequest)
+	r.GET("/api/v1/sweep/:id", o.handleSweepResultsRequest)
 	r.GET("/api/v1/expressions", o.handleExpressionsRequest)
+	r.GET("/api/v1/expressions/export", o.handleExportRequest)
+	r.POST("/api/v1/expressions/import", o.handleImportRequest)
+	r.GET("/api/v1/expressions/import/:id", o.handleImportReportRequest)
 	r.GET("/api/v1/expressions/:id", o.handleExpressionByIdRequest)
+	r.DELETE("/api/v1/expressions", o.handlePurgeExpressionsRequest)
+	r.DELETE("/api/v1/expressions/:id", o.handleDeleteExpressionRequest)
+	r.POST("/api/v1/functions", o.handleDefineFunctionRequest)
+	r.GET("/api/v1/functions", o.handleFunctionsRequest)
+	r.DELETE("/api/v1/functions/:name", o.handleDeleteFunctionRequest)
 	r.GET("/internal/task", o.handleGetTaskRequest)
 	r.POST("/internal/task", o.handlePostTaskRequest)
+	r.GET("/admin/stats", o.handleStatsRequest)
+	r.GET("/admin/agents", o.handleAgentsRequest)
 
 	r.NoRoute(func(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Not Found"})
 	})
+	return r
+}
+
+func (o *Orchestrator) StartServer() error {
+	r := o.Router()
 
 	go func() {
 		for {
@@ -357,5 +931,7 @@ func (o *Orchestrator) StartServer() error {
 		}
 	}()
 
+	go o.runJanitor()
+
 	return r.Run(":" + o.Config.WorkingPort)
 }
@@ -2,6 +2,8 @@ package app
 
 import (
 	"bytes"
+	"encoding/json"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
@@ -36,7 +38,7 @@ func TestHandleCalculateRequest(t *testing.T) {
 			name:           "Invalid Expression",
 			inputBody:      `{"expression": "1 + "}`,
 			expectedStatus: http.StatusUnprocessableEntity,
-			expectedBody:   `{"error":"Invalid expression"}`,
+			expectedBody:   `{"error":"Invalid expression","errors":[{"code":"unexpected_end","message":"unexpected end of expression","offset":4,"column":5,"expected":["number","identifier","(","[","-","+","!"],"snippet":"1 + \n    ^"}]}`,
 		},
 		{
 			name:           "Empty Body",
@@ -97,7 +99,7 @@ func TestHandleExpressionsRequest(t *testing.T) {
 		t.Errorf("Expected status 200, got %d", recorder.Code)
 	}
 
-	expectedBody := `{"expressions":[{"id":"1","expression":"1 + 2","status":"completed","result":3}]}`
+	expectedBody := `{"expressions":[{"id":"1","expression":"1 + 2","status":"completed","result":3}],"total":1}`
 
 	if recorder.Body.String() != expectedBody {
 		t.Errorf("Expected body %s, got %s", expectedBody, recorder.Body.String())
@@ -277,3 +279,203 @@ func TestHandlePostTaskRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleDeleteExpressionRequest(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.DELETE("/api/v1/expressions/:id", orchestrator.handleDeleteExpressionRequest)
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	ast, err := ParseAST("(1+2)*(3+4)")
+	if err != nil {
+		t.Fatalf("Failed to parse expression: %v", err)
+	}
+	orchestrator.mutex.Lock()
+	running := &Expression{ID: "1", Expr: "(1+2)*(3+4)", Status: "pending", AST: ast}
+	orchestrator.expressionStore["1"] = running
+	orchestrator.scheduleTasksForExpression(running)
+	inFlight := orchestrator.taskQueue.PopFront().(*Task)
+	orchestrator.expressionStore["2"] = &Expression{ID: "2", Expr: "1 + 2", Status: "pending", AST: &ASTNode{IsLeaf: true, Value: 3}}
+	orchestrator.mutex.Unlock()
+
+	tests := []struct {
+		name           string
+		target         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Cancel Running Expression",
+			target:         "/api/v1/expressions/1",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"cancelled"}`,
+		},
+		{
+			name:           "Cancel Completed Expression",
+			target:         "/api/v1/expressions/2",
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"error":"Expression already completed"}`,
+		},
+		{
+			name:           "Purge Completed Expression",
+			target:         "/api/v1/expressions/2?purge=true",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"purged"}`,
+		},
+		{
+			name:           "Unknown Expression",
+			target:         "/api/v1/expressions/999",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"Expression not found"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("DELETE", test.target, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != test.expectedStatus {
+				t.Errorf("Expected status %d, got %d", test.expectedStatus, recorder.Code)
+			}
+
+			if recorder.Body.String() != test.expectedBody {
+				t.Errorf("Expected body %s, got %s", test.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+
+	if orchestrator.taskQueue.Len() != 0 {
+		t.Errorf("Expected empty task queue after cancellation, got %d tasks", orchestrator.taskQueue.Len())
+	}
+	if running.Status != "cancelled" {
+		t.Errorf("Expected status cancelled, got %s", running.Status)
+	}
+	if _, ok := orchestrator.expressionStore["2"]; ok {
+		t.Errorf("Expected purged expression to be removed from the store")
+	}
+
+	req, err := http.NewRequest("POST", "/internal/task", strings.NewReader(`{"id":"`+inFlight.ID+`","result":3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	expectedBody := `{"error":"Expression cancelled"}`
+	if recorder.Code != http.StatusGone || recorder.Body.String() != expectedBody {
+		t.Errorf("Expected late result to be rejected with %d %s, got %d %s", http.StatusGone, expectedBody, recorder.Code, recorder.Body.String())
+	}
+	if len(orchestrator.taskStorage) != 0 {
+		t.Errorf("Expected empty task storage, got %d tasks", len(orchestrator.taskStorage))
+	}
+}
+
+func TestHandlePurgeExpressionsRequest(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.DELETE("/api/v1/expressions", orchestrator.handlePurgeExpressionsRequest)
+
+	orchestrator.mutex.Lock()
+	orchestrator.expressionStore["1"] = &Expression{ID: "1", Expr: "1 + 2", Status: "pending", AST: &ASTNode{IsLeaf: true, Value: 3}}
+	orchestrator.expressionStore["2"] = &Expression{ID: "2", Expr: "1 + 2", Status: "cancelled"}
+	orchestrator.expressionStore["3"] = &Expression{ID: "3", Expr: "1 + 2", Status: "in_progress", AST: &ASTNode{Operator: "+"}}
+	orchestrator.mutex.Unlock()
+
+	req, err := http.NewRequest("DELETE", "/api/v1/expressions", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	expectedBody := `{"purged":2}`
+	if recorder.Code != http.StatusOK || recorder.Body.String() != expectedBody {
+		t.Errorf("Expected 200 %s, got %d %s", expectedBody, recorder.Code, recorder.Body.String())
+	}
+	if _, ok := orchestrator.expressionStore["3"]; !ok {
+		t.Errorf("Expected in-progress expression to stay in the store")
+	}
+}
+
+func TestHandlePostTaskRequest_Error(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	ast, err := ParseAST("(1/0)+(2*3)")
+	if err != nil {
+		t.Fatalf("Failed to parse expression: %v", err)
+	}
+	orchestrator.mutex.Lock()
+	expr := &Expression{ID: "1", Expr: "(1/0)+(2*3)", Status: "pending", AST: ast}
+	orchestrator.expressionStore["1"] = expr
+	orchestrator.scheduleTasksForExpression(expr)
+	task := orchestrator.taskQueue.PopFront().(*Task)
+	orchestrator.mutex.Unlock()
+
+	req, err := http.NewRequest("POST", "/internal/task", strings.NewReader(`{"id":"`+task.ID+`","result":0,"error":"division by zero is not allowed"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	expectedBody := `{"status":"error accepted"}`
+	if recorder.Code != http.StatusOK || recorder.Body.String() != expectedBody {
+		t.Errorf("Expected 200 %s, got %d %s", expectedBody, recorder.Code, recorder.Body.String())
+	}
+	if expr.Status != "failed" || expr.Error != "division by zero is not allowed" || expr.CompletedAt == nil {
+		t.Errorf("Expected failed expression with error, got %+v", expr)
+	}
+	if orchestrator.taskQueue.Len() != 0 || len(orchestrator.taskStorage) != 0 {
+		t.Errorf("Expected remaining tasks to be dropped, got %d queued and %d stored", orchestrator.taskQueue.Len(), len(orchestrator.taskStorage))
+	}
+}
+
+func TestHandleCalculateRequest_NaturalNotation(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/api/v1/calculate", orchestrator.handleCalculateRequest)
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	tests := []struct {
+		body     string
+		status   int
+		expected float64
+	}{
+		{`{"expression":"3!(1+1)"}`, http.StatusUnprocessableEntity, 0},
+		{`{"expression":"3!(1+1)","natural_notation":true}`, http.StatusCreated, 12},
+		{`{"expression":"2pi","natural_notation":true}`, http.StatusCreated, 2 * math.Pi},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", strings.NewReader(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != test.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", test.body, test.status, recorder.Code, recorder.Body.String())
+		}
+		if test.status != http.StatusCreated {
+			continue
+		}
+		var response ExpressionResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		runMatrixTasks(t, orchestrator, router)
+		expr := orchestrator.expressionStore[response.ID]
+		if expr.Status != "completed" || expr.Result == nil || math.Abs(*expr.Result-test.expected) > 1e-12 {
+			t.Errorf("%s: expected %v, got %+v", test.body, test.expected, expr)
+		}
+	}
+}
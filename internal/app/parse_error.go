@@ -0,0 +1,115 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Codes of parse errors.
+const (
+	PARSE_EMPTY_EXPRESSION   = "empty_expression"
+	PARSE_UNEXPECTED_TOKEN   = "unexpected_token"
+	PARSE_UNEXPECTED_END     = "unexpected_end"
+	PARSE_INVALID_NUMBER     = "invalid_number"
+	PARSE_UNKNOWN_IDENTIFIER = "unknown_identifier"
+	PARSE_UNKNOWN_FUNCTION   = "unknown_function"
+	PARSE_UNKNOWN_UNIT       = "unknown_unit"
+	PARSE_ARGUMENT_COUNT     = "argument_count"
+	PARSE_INVALID_MATRIX     = "invalid_matrix"
+	PARSE_INVALID_CALL       = "invalid_call"
+)
+
+var errUnknownFunction = errors.New("unknown function")
+
+// Token sets reported as expected.
+var (
+	expectedOperand  = []string{"number", "identifier", "(", "[", "-", "+", "!"}
+	expectedOperator = []string{"operator", "end of expression"}
+)
+
+// ParseError swagger model
+// @Description Ошибка разбора выражения
+type ParseError struct {
+	Code    string `json:"code" example:"unexpected_token"`
+	Message string `json:"message" example:"unexpected \")\""`
+	// Offset is the byte offset in the original expression, Column the
+	// 1-based position in characters.
+	Offset   int      `json:"offset" example:"4"`
+	Column   int      `json:"column" example:"5"`
+	Expected []string `json:"expected,omitempty" example:"number,identifier,("`
+	Snippet  string   `json:"snippet" example:"2*(3+)\n     ^"`
+}
+
+func newParseError(input string, offset int, code string, expected []string, message string) *ParseError {
+	offset = min(max(offset, 0), len(input))
+	column := utf8.RuneCountInString(input[:offset]) + 1
+	line := strings.NewReplacer("\n", " ", "\t", " ").Replace(input)
+	return &ParseError{
+		Code:     code,
+		Message:  message,
+		Offset:   offset,
+		Column:   column,
+		Expected: expected,
+		Snippet:  line + "\n" + strings.Repeat(" ", column-1) + "^",
+	}
+}
+
+func (e *ParseError) Error() string {
+	return e.Message
+}
+
+// ParseErrors are all errors found in one expression, in input order.
+type ParseErrors []*ParseError
+
+func (e ParseErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ParseErrorResponse swagger model
+// @Description Ошибки разбора выражения
+type ParseErrorResponse struct {
+	Error  string        `json:"error" example:"Invalid expression"`
+	Errors []*ParseError `json:"errors"`
+}
+
+// fail records an error at offset and returns it. Parsing continues after
+// errors the caller can recover from, so that one response lists them all.
+func (p *parser) fail(offset int, code string, expected []string, format string, args ...interface{}) error {
+	err := newParseError(p.input, offset, code, expected, fmt.Sprintf(format, args...))
+	p.errors = append(p.errors, err)
+	return err
+}
+
+// unexpected records the token at the current position that is not one of
+// expected.
+func (p *parser) unexpected(expected []string) error {
+	if p.pos >= len(p.input) {
+		return p.fail(p.pos, PARSE_UNEXPECTED_END, expected, "unexpected end of expression")
+	}
+	ch, _ := utf8.DecodeRuneInString(p.input[p.pos:])
+	return p.fail(p.pos, PARSE_UNEXPECTED_TOKEN, expected, "unexpected %q", ch)
+}
+
+// synchronize skips to the first of stops outside nested brackets, after an
+// error inside a group, and reports whether it found one.
+func (p *parser) synchronize(stops string) bool {
+	depth := 0
+	for ; p.pos < len(p.input); p.pos++ {
+		ch := p.input[p.pos]
+		switch {
+		case depth == 0 && strings.IndexByte(stops, ch) >= 0:
+			return true
+		case ch == '(' || ch == '[':
+			depth++
+		case ch == ')' || ch == ']':
+			depth--
+		}
+	}
+	return false
+}
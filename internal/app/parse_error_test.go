@@ -0,0 +1,141 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func parseErrors(t *testing.T, input string) ParseErrors {
+	t.Helper()
+	_, err := ParseAST(input)
+	var errs ParseErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("ParseAST(%q): expected ParseErrors, got %v", input, err)
+	}
+	return errs
+}
+
+func TestParseAST_ErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		code     string
+		message  string
+		offset   int
+		column   int
+		expected []string
+	}{
+		{"", PARSE_EMPTY_EXPRESSION, "empty expression", 0, 1, expectedOperand},
+		{"   ", PARSE_EMPTY_EXPRESSION, "empty expression", 3, 4, expectedOperand},
+		{"1 + ", PARSE_UNEXPECTED_END, "unexpected end of expression", 4, 5, expectedOperand},
+		{"2 * (3 + 4", PARSE_UNEXPECTED_END, "unexpected end of expression", 10, 11, []string{"operator", ")"}},
+		{"1 2", PARSE_UNEXPECTED_TOKEN, `unexpected '2'`, 2, 3, expectedOperator},
+		{"1 + 2 )", PARSE_UNEXPECTED_TOKEN, `unexpected ')'`, 6, 7, expectedOperator},
+		{"1 ? 2 3", PARSE_UNEXPECTED_TOKEN, `unexpected '3'`, 6, 7, []string{":"}},
+		{"sqrt(4 5)", PARSE_UNEXPECTED_TOKEN, `unexpected '5'`, 7, 8, []string{"operator", ",", ")"}},
+		{"1 + foo", PARSE_UNKNOWN_IDENTIFIER, "unknown identifier foo", 4, 5, nil},
+		{"1 + foo(2)", PARSE_UNKNOWN_FUNCTION, "unknown function foo", 4, 5, nil},
+		{"3 parsec", PARSE_UNKNOWN_UNIT, "unknown unit parsec", 2, 3, nil},
+		{"1.2.3", PARSE_INVALID_NUMBER, "unexpected . in number 1.2", 3, 4, nil},
+		{"  sqrt(1, 2)", PARSE_ARGUMENT_COUNT, "function sqrt expects 1 argument, got 2", 2, 3, nil},
+		{"[[1,2],[3]]", PARSE_INVALID_MATRIX, "invalid matrix: row 2 has 1 elements, expected 2", 0, 1, nil},
+		{"1 + [1, 2 m]", PARSE_INVALID_MATRIX, "matrix element has a unit", 8, 9, nil},
+		{"«1» + ", PARSE_UNEXPECTED_TOKEN, `unexpected '«'`, 0, 1, expectedOperand},
+		{"1 + «", PARSE_UNEXPECTED_TOKEN, `unexpected '«'`, 4, 5, expectedOperand},
+		{"ü + 1", PARSE_UNEXPECTED_TOKEN, `unexpected 'ü'`, 0, 1, expectedOperand},
+	}
+	for _, test := range tests {
+		errs := parseErrors(t, test.input)
+		err := errs[0]
+		if err.Code != test.code || err.Message != test.message || err.Offset != test.offset || err.Column != test.column || !reflect.DeepEqual(err.Expected, test.expected) {
+			t.Errorf("ParseAST(%q): got %+v, want %s %q at %d (column %d) expecting %v", test.input, err, test.code, test.message, test.offset, test.column, test.expected)
+		}
+	}
+}
+
+func TestParseAST_ErrorColumnCountsCharacters(t *testing.T) {
+	errs := parseErrors(t, "sqrt(«)")
+	if err := errs[0]; err.Offset != 5 || err.Column != 6 || err.Snippet != "sqrt(«)\n     ^" {
+		t.Errorf("Expected the error after sqrt(, got %+v", err)
+	}
+	errs = parseErrors(t, "(1 + 1) 2")
+	if err := errs[0]; err.Offset != 8 || err.Column != 9 || err.Snippet != "(1 + 1) 2\n        ^" {
+		t.Errorf("Expected a caret under 2, got %+v", err)
+	}
+}
+
+func TestParseAST_CollectsErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		offsets []int
+	}{
+		{"(1 +) * (2 *)", []int{4, 12}},
+		{"max(1 +, foo, 3) + 1", []int{7, 9}},
+		{"sqrt(*) + (1 2) + min(,)", []int{5, 13, 22, 23}},
+		// No recovery outside a group.
+		{"1 + * 2 + *", []int{4}},
+	}
+	for _, test := range tests {
+		errs := parseErrors(t, test.input)
+		offsets := make([]int, len(errs))
+		for i, err := range errs {
+			offsets[i] = err.Offset
+		}
+		if !reflect.DeepEqual(offsets, test.offsets) {
+			t.Errorf("ParseAST(%q): expected errors at %v, got %v", test.input, test.offsets, errs)
+		}
+	}
+}
+
+func TestParseAST_Spaces(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{" 1 +\t2 ", "1+2"},
+		{"sqrt ( 4 ) * - 3", "sqrt(4)*(-3)"},
+		{"5 kg * 2 m ^ 2", "(5kg)*(2m^2)"},
+		{"2 i + [ 1 , 2 ]", "2i+[1,2]"},
+		{"1 < 2 ? ! 0 : 1", "1<2?!(0):1"},
+	}
+	for _, test := range tests {
+		ast, err := ParseAST(test.input)
+		if err != nil {
+			t.Errorf("ParseAST(%q): unexpected error %v", test.input, err)
+			continue
+		}
+		if got := ast.String(); got != test.expected {
+			t.Errorf("ParseAST(%q).String() = %q, want %q", test.input, got, test.expected)
+		}
+	}
+}
+
+func TestHandleCalculateRequest_ParseErrors(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/api/v1/calculate", orchestrator.handleCalculateRequest)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", strings.NewReader(`{"expression":"(1 +) * (2 *)"}`))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422, got %d", recorder.Code)
+	}
+	var response ParseErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Error != "Invalid expression" || len(response.Errors) != 2 {
+		t.Fatalf("Expected two parse errors, got %s", recorder.Body.String())
+	}
+	if err := response.Errors[1]; err.Code != PARSE_UNEXPECTED_TOKEN || err.Column != 13 || err.Snippet != "(1 +) * (2 *)\n            ^" {
+		t.Errorf("Unexpected second error %+v", err)
+	}
+}
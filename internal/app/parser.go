@@ -1,39 +1,156 @@
 package app
 
 import (
-	"fmt"
-	"strconv"
-	"strings"
+	"Yandex_Calc_V2.0/internal/eval"
+	"Yandex_Calc_V2.0/internal/matrix"
+	"Yandex_Calc_V2.0/internal/ops"
+	"Yandex_Calc_V2.0/internal/units"
+	"errors"
+	"math"
 	"unicode"
 )
 
 type ASTNode struct {
 	IsLeaf        bool
 	Value         float64
+	Imag          float64         // imaginary part of a leaf
+	Matrix        *matrix.Matrix  // value of a matrix leaf, nil for numbers
+	Unit          units.Dimension // unit of a leaf; Value is in SI base units
+	Variable      string          // name of a variable leaf of a symbolic expression
 	Operator      string
 	Left, Right   *ASTNode
 	TaskScheduled bool
 }
 
-func ParseAST(expression string) (*ASTNode, error) {
-	expr := strings.ReplaceAll(expression, " ", "")
-	if expr == "" {
-		return nil, fmt.Errorf("empty expression")
+// precedence returns the binding strength of an infix operator. Leaves and
+// function calls bind tighter than any operator.
+func precedence(op string) int {
+	if op == CONDITIONAL {
+		return math.MinInt
 	}
-	p := &parser{input: expr, pos: 0}
-	node, err := p.parseExpression()
-	if err != nil {
-		return nil, err
+	if infix, ok := ops.LookupKind(op, ops.Infix); ok {
+		return infix.Precedence
 	}
-	if p.pos < len(p.input) {
-		return nil, fmt.Errorf("unexpected token at position %d", p.pos)
+	return math.MaxInt
+}
+
+func rightAssociative(op string) bool {
+	infix, ok := ops.LookupKind(op, ops.Infix)
+	return ok && infix.Associativity == ops.RightAssociative
+}
+
+// String renders the node back to an infix expression with the minimal
+// number of parentheses.
+func (n *ASTNode) String() string {
+	if n == nil {
+		return ""
 	}
-	return node, nil
+	if isArgumentList(n) {
+		return n.Left.String() + ARGUMENT_LIST + n.Right.String()
+	}
+	if isConditional(n) {
+		condition := n.Left.String()
+		if isConditional(n.Left) {
+			condition = "(" + condition + ")"
+		}
+		return condition + CONDITIONAL + n.Right.Left.String() + BRANCHES + n.Right.Right.String()
+	}
+	if isCall(n) {
+		return n.Operator + "(" + n.Left.String() + ")"
+	}
+	if _, ok := ops.LookupKind(n.Operator, ops.Function); ok && isOperation(n) {
+		return n.Operator + "(" + n.Left.String() + "," + n.Right.String() + ")"
+	}
+	if n.IsLeaf || n.Left == nil || n.Right == nil {
+		if n.Variable != "" {
+			return n.Variable
+		}
+		if n.Matrix != nil {
+			return n.Matrix.String()
+		}
+		if n.Imag != 0 {
+			return formatComplex(n.Value, n.Imag)
+		}
+		if !n.Unit.Dimensionless() {
+			return "(" + n.Unit.Format(n.Value) + ")"
+		}
+		value := formatNumber(n.Value)
+		if n.Value < 0 {
+			return "(" + value + ")"
+		}
+		return value
+	}
+	left, right := n.Left.String(), n.Right.String()
+	prec := precedence(n.Operator)
+	if isOperation(n.Left) {
+		leftPrec := precedence(n.Left.Operator)
+		if leftPrec < prec || (leftPrec == prec && rightAssociative(n.Operator)) {
+			left = "(" + left + ")"
+		}
+	}
+	if isOperation(n.Right) {
+		rightPrec := precedence(n.Right.Operator)
+		if rightPrec < prec || (rightPrec == prec && !rightAssociative(n.Operator)) {
+			right = "(" + right + ")"
+		}
+	}
+	return left + n.Operator + right
+}
+
+// ParseOptions select the parts of the grammar that are off by default.
+type ParseOptions struct {
+	// SpecialValues allows the literals inf and nan.
+	SpecialValues bool
+	// Natural notation allows implicit multiplication, as in 2pi, 3(4+5)
+	// and (a+b)(a-b), and the postfix factorial 5!.
+	Natural bool
+	// Variables are names read as variable leaves, for symbolic
+	// expressions. They shadow constants and units.
+	Variables []string
+}
+
+// ParseAST parses the expression. Its errors are ParseErrors with positions
+// in the expression as written.
+func ParseAST(expression string) (*ASTNode, error) {
+	return ParseASTWithOptions(expression, ParseOptions{})
+}
+
+func ParseASTWithOptions(expression string, options ParseOptions) (*ASTNode, error) {
+	p := newParser(expression)
+	p.options = options
+	return p.parse()
 }
 
 type parser struct {
-	input string
-	pos   int
+	input   string
+	pos     int
+	options ParseOptions
+	// params binds the parameter names of a user function body to the
+	// argument subtrees of the call being expanded.
+	params map[string]*ASTNode
+	// call expands a call of a function that is not built in.
+	call func(name string, args []*ASTNode) (*ASTNode, error)
+	// errors collects the errors found so far.
+	errors ParseErrors
+}
+
+func newParser(expression string) *parser {
+	return &parser{input: expression, pos: 0}
+}
+
+func (p *parser) parse() (*ASTNode, error) {
+	p.skipSpaces()
+	if p.pos == len(p.input) {
+		return nil, append(p.errors, newParseError(p.input, p.pos, PARSE_EMPTY_EXPRESSION, expectedOperand, "empty expression"))
+	}
+	node, err := p.parseExpression()
+	if err == nil && p.pos < len(p.input) {
+		p.unexpected(expectedOperator)
+	}
+	if len(p.errors) > 0 {
+		return nil, p.errors
+	}
+	return node, nil
 }
 
 func (p *parser) peek() rune {
@@ -43,106 +160,347 @@ func (p *parser) peek() rune {
 	return 0
 }
 
+func (p *parser) peekAt(offset int) rune {
+	if p.pos+offset < len(p.input) {
+		return rune(p.input[p.pos+offset])
+	}
+	return 0
+}
+
 func (p *parser) get() rune {
 	ch := p.peek()
 	p.pos++
 	return ch
 }
 
+// skipSpaces moves past white space, which may stand between any two tokens.
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+// parseExpression parses infix operators and a conditional c?a:b, which
+// binds looser than any of them and groups to the right.
 func (p *parser) parseExpression() (*ASTNode, error) {
-	node, err := p.parseTerm()
+	node, err := p.parseBinary(math.MinInt)
+	if err != nil || p.peek() != '?' {
+		return node, err
+	}
+	p.get()
+	then, err := p.parseExpression()
 	if err != nil {
 		return nil, err
 	}
-	for {
-		ch := p.peek()
-		if ch == '+' || ch == '-' {
-			op := string(p.get())
-			right, err := p.parseTerm()
-			if err != nil {
-				return nil, err
-			}
-			node = &ASTNode{
-				IsLeaf:   false,
-				Operator: op,
-				Left:     node,
-				Right:    right,
-			}
-		} else {
-			break
-		}
+	if p.peek() != ':' {
+		return nil, p.unexpected([]string{":"})
 	}
-	return node, nil
+	p.get()
+	otherwise, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	return newConditional(node, then, otherwise), nil
 }
 
-func (p *parser) parseTerm() (*ASTNode, error) {
+// parseBinary parses operands joined by infix operators of the registry that
+// bind tighter than minPrecedence.
+func (p *parser) parseBinary(minPrecedence int) (*ASTNode, error) {
 	node, err := p.parseFactor()
 	if err != nil {
 		return nil, err
 	}
 	for {
-		ch := p.peek()
-		if ch == '*' || ch == '/' {
-			op := string(p.get())
-			right, err := p.parseFactor()
-			if err != nil {
-				return nil, err
-			}
-			node = &ASTNode{
-				IsLeaf:   false,
-				Operator: op,
-				Left:     node,
-				Right:    right,
-			}
-		} else {
+		p.skipSpaces()
+		op, ok := ops.Default.MatchInfix(p.input[p.pos:])
+		implicit := !ok && p.options.Natural && p.operandAhead()
+		if implicit {
+			op, ok = ops.LookupKind("*", ops.Infix)
+		}
+		if !ok || op.Precedence <= minPrecedence {
 			break
 		}
+		if !implicit {
+			p.pos += len(op.Symbol)
+		}
+		next := op.Precedence
+		if op.Associativity == ops.RightAssociative {
+			next--
+		}
+		right, err := p.parseBinary(next)
+		if err != nil {
+			return nil, err
+		}
+		node = &ASTNode{
+			IsLeaf:   false,
+			Operator: op.Symbol,
+			Left:     node,
+			Right:    right,
+		}
 	}
 	return node, nil
 }
 
 func (p *parser) parseFactor() (*ASTNode, error) {
+	p.skipSpaces()
 	ch := p.peek()
 	if ch == '(' {
 		p.get()
 		node, err := p.parseExpression()
-		if err != nil {
-			return nil, err
+		if err == nil && p.peek() != ')' {
+			err = p.unexpected([]string{"operator", ")"})
 		}
-		if p.peek() != ')' {
-			return nil, fmt.Errorf("missing closing parenthesis at position %d", p.pos)
+		if err != nil {
+			// Report the error and go on after the group.
+			if !p.synchronize(")") {
+				return nil, err
+			}
+			node = &ASTNode{IsLeaf: true}
 		}
 		p.get()
-		return node, nil
+		return p.parsePostfix(node), nil
+	}
+	if ch == '!' {
+		p.get()
+		node, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return &ASTNode{Operator: NOT, Left: node}, nil
 	}
 	unarySign := ""
 	if ch == '+' || ch == '-' {
 		unarySign = string(p.get())
+		p.skipSpaces()
 		ch = p.peek()
 	}
-	start := p.pos
-	for {
-		ch = p.peek()
-		if unicode.IsDigit(ch) || ch == '.' {
-			p.get()
-		} else {
-			break
+	if ch == '[' {
+		node, err := p.parseMatrix()
+		if err != nil || unarySign != "-" {
+			return node, err
 		}
+		node.setMatrix(matrix.Map(leafMatrix(node), func(x float64) float64 { return -x }))
+		return node, nil
 	}
-	token := p.input[start:p.pos]
-	if token == "" {
-		return nil, fmt.Errorf("expected number at position %d", start)
+	if isIdentifierStart(ch) {
+		node, err := p.parseIdentifier()
+		if err != nil {
+			return nil, err
+		}
+		node = p.parsePostfix(node)
+		if unarySign == "-" {
+			return negate(node), nil
+		}
+		return node, nil
+	}
+	if !isDigit(ch) && ch != '.' {
+		return nil, p.unexpected(expectedOperand)
 	}
-	value, err := strconv.ParseFloat(token, 64)
+	token, err := eval.LexNumber(p.input, p.pos)
 	if err != nil {
-		return nil, fmt.Errorf("invalid number %s", token)
+		var syntax *eval.SyntaxError
+		errors.As(err, &syntax)
+		return nil, p.fail(syntax.Offset, PARSE_INVALID_NUMBER, nil, "%s", syntax.Message)
 	}
+	p.pos = token.End
+	value, _ := token.Value.Float64()
 	node := &ASTNode{
 		IsLeaf: true,
 		Value:  value,
 	}
+	p.skipSpaces()
+	if p.peek() == 'i' && !isIdentifierChar(p.peekAt(1)) {
+		p.get()
+		node.Value, node.Imag = 0, value
+	} else if isIdentifierStart(p.peek()) && (!p.options.Natural || p.unitAhead()) {
+		if err := p.parseUnit(node); err != nil {
+			return nil, err
+		}
+	}
+	node = p.parsePostfix(node)
 	if unarySign == "-" {
-		node.Value = -node.Value
+		return negate(node), nil
 	}
 	return node, nil
 }
+
+func negate(node *ASTNode) *ASTNode {
+	if node.IsLeaf && node.Variable == "" {
+		node.Value, node.Imag = -node.Value, -node.Imag
+		return node
+	}
+	return &ASTNode{Operator: "-", Left: &ASTNode{IsLeaf: true}, Right: node}
+}
+
+// parsePostfix applies the factorials of natural notation that follow an
+// operand; != is a comparison.
+func (p *parser) parsePostfix(node *ASTNode) *ASTNode {
+	for p.options.Natural {
+		p.skipSpaces()
+		if p.peek() != '!' || p.peekAt(1) == '=' {
+			break
+		}
+		p.get()
+		node = &ASTNode{Operator: ops.FACTORIAL, Left: node}
+	}
+	return node
+}
+
+func (p *parser) isVariable(name string) bool {
+	for _, variable := range p.options.Variables {
+		if variable == name {
+			return true
+		}
+	}
+	return false
+}
+
+// operandAhead reports whether an operand starts at the current position,
+// which in natural notation multiplies the operand before it.
+func (p *parser) operandAhead() bool {
+	ch := p.peek()
+	return isDigit(ch) || (ch == '.' && isDigit(p.peekAt(1))) || ch == '(' || ch == '[' || isIdentifierStart(ch)
+}
+
+// unitAhead reports whether the identifier at the current position is a
+// unit rather than the start of a call.
+func (p *parser) unitAhead() bool {
+	end := p.pos
+	for end < len(p.input) && isIdentifierChar(rune(p.input[end])) {
+		end++
+	}
+	name := p.input[p.pos:end]
+	_, ok := units.Lookup(name)
+	ok = ok && !p.isVariable(name)
+	for end < len(p.input) && unicode.IsSpace(rune(p.input[end])) {
+		end++
+	}
+	return ok && (end == len(p.input) || p.input[end] != '(')
+}
+
+func isDigit(ch rune) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+func isIdentifierStart(ch rune) bool {
+	return ch == '_' || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z')
+}
+
+func isIdentifierChar(ch rune) bool {
+	return isIdentifierStart(ch) || isDigit(ch)
+}
+
+// parseIdentifier parses a parameter reference, a unit or a function call.
+// Calls of built-in functions become nodes with the argument in Left; calls
+// of other functions are handed to p.call.
+func (p *parser) parseIdentifier() (*ASTNode, error) {
+	start := p.pos
+	for isIdentifierChar(p.peek()) {
+		p.get()
+	}
+	name := p.input[start:p.pos]
+	p.skipSpaces()
+	if p.peek() != '(' {
+		if arg, ok := p.params[name]; ok {
+			return cloneAST(arg), nil
+		}
+		if p.isVariable(name) {
+			return &ASTNode{IsLeaf: true, Variable: name}, nil
+		}
+		if name == "i" {
+			return &ASTNode{IsLeaf: true, Imag: 1}, nil
+		}
+		if value, ok := ops.LookupConstant(name); ok {
+			return &ASTNode{IsLeaf: true, Value: value}, nil
+		}
+		if value, ok := specialValues[name]; ok {
+			if !p.options.SpecialValues {
+				return nil, p.fail(start, PARSE_INVALID_NUMBER, nil, "special value %s is not allowed", name)
+			}
+			return &ASTNode{IsLeaf: true, Value: value}, nil
+		}
+		if unit, ok := units.Lookup(name); ok {
+			return &ASTNode{IsLeaf: true, Value: unit.Scale, Unit: unit.Dimension}, nil
+		}
+		return nil, p.fail(start, PARSE_UNKNOWN_IDENTIFIER, nil, "unknown identifier %s", name)
+	}
+	p.get()
+	args, err := p.parseArguments()
+	if err != nil {
+		return nil, err
+	}
+	if name == IF {
+		if len(args) != 3 {
+			return nil, p.fail(start, PARSE_ARGUMENT_COUNT, nil, "function %s expects 3 arguments, got %d", name, len(args))
+		}
+		return newConditional(args[0], args[1], args[2]), nil
+	}
+	if fn, ok := ops.LookupFunction(name); ok {
+		if fn.Arity == ops.Variadic {
+			if len(args) == 0 {
+				return nil, p.fail(start, PARSE_ARGUMENT_COUNT, nil, "function %s expects at least 1 argument", name)
+			}
+			return &ASTNode{Operator: name, Left: buildBalanced(ARGUMENT_LIST, args)}, nil
+		}
+		if len(args) != fn.Arity {
+			noun := "arguments"
+			if fn.Arity == 1 {
+				noun = "argument"
+			}
+			return nil, p.fail(start, PARSE_ARGUMENT_COUNT, nil, "function %s expects %d %s, got %d", name, fn.Arity, noun, len(args))
+		}
+		node := &ASTNode{Operator: name, Left: args[0]}
+		if fn.Arity == 2 {
+			node.Right = args[1]
+		}
+		return node, nil
+	}
+	if p.call == nil {
+		return nil, p.fail(start, PARSE_UNKNOWN_FUNCTION, nil, "unknown function %s", name)
+	}
+	node, err := p.call(name, args)
+	if errors.Is(err, errUnknownFunction) {
+		return nil, p.fail(start, PARSE_UNKNOWN_FUNCTION, nil, "%v", err)
+	}
+	if err != nil {
+		return nil, p.fail(start, PARSE_INVALID_CALL, nil, "%v", err)
+	}
+	return node, nil
+}
+
+// parseArguments parses the arguments of a call up to the closing
+// parenthesis. An argument with an error is reported and skipped.
+func (p *parser) parseArguments() ([]*ASTNode, error) {
+	var args []*ASTNode
+	p.skipSpaces()
+	if p.peek() == ')' {
+		p.get()
+		return args, nil
+	}
+	for {
+		arg, err := p.parseExpression()
+		if err == nil && p.peek() != ',' && p.peek() != ')' {
+			err = p.unexpected([]string{"operator", ",", ")"})
+		}
+		if err != nil {
+			if !p.synchronize(",)") {
+				return nil, err
+			}
+			arg = &ASTNode{IsLeaf: true}
+		}
+		args = append(args, arg)
+		if p.get() == ')' {
+			return args, nil
+		}
+	}
+}
+
+func cloneAST(node *ASTNode) *ASTNode {
+	if node == nil {
+		return nil
+	}
+	clone := *node
+	clone.Left = cloneAST(node.Left)
+	clone.Right = cloneAST(node.Right)
+	return &clone
+}
@@ -1,6 +1,8 @@
 package app
 
 import (
+	"Yandex_Calc_V2.0/internal/eval"
+	"Yandex_Calc_V2.0/internal/ops"
 	"math"
 	"testing"
 )
@@ -119,3 +121,168 @@ func TestParseAST_InvalidExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestASTNode_String(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{"1+2", "1+2"},
+		{"1+2*3", "1+2*3"},
+		{"(1+2)*3", "(1+2)*3"},
+		{"10-(5-2)", "10-(5-2)"},
+		{"100/10/5", "100/10/5"},
+		{"100/(10/5)", "100/(10/5)"},
+		{"-2*3.5", "(-2)*3.5"},
+		{"(3+4)*(5-2)", "(3+4)*(5-2)"},
+	}
+
+	for _, tt := range tests {
+		node, err := ParseAST(tt.expression)
+		if err != nil {
+			t.Fatalf("unexpected error for expression %q: %v", tt.expression, err)
+		}
+		if node.String() != tt.expected {
+			t.Errorf("for expression %q, expected %q, got %q", tt.expression, tt.expected, node.String())
+		}
+		reparsed, err := ParseAST(node.String())
+		if err != nil || !compareASTNodes(node, reparsed) {
+			t.Errorf("for expression %q, rendered form %q does not parse back to the same AST", tt.expression, node.String())
+		}
+	}
+}
+
+func TestParseAST_Calls(t *testing.T) {
+	node, err := ParseAST("2*sqrt(9+7)")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := createASTNode(false, 0, "*", createASTNode(true, 2, "", nil, nil), createASTNode(false, 0, "sqrt", createASTNode(false, 0, "+", createASTNode(true, 9, "", nil, nil), createASTNode(true, 7, "", nil, nil)), nil))
+	if !compareASTNodes(node, expected) {
+		t.Errorf("AST mismatch")
+	}
+	if node.String() != "2*sqrt(9+7)" {
+		t.Errorf("expected 2*sqrt(9+7), got %s", node.String())
+	}
+	for _, expression := range []string{"sqrt(1,2)", "sqrt()", "hyp(3,4)", "x+1", "sqrt(1"} {
+		if _, err := ParseAST(expression); err == nil {
+			t.Errorf("expected an error for expression %q, got nil", expression)
+		}
+	}
+}
+
+func TestRegisteredOperator(t *testing.T) {
+	// A right-associative power operator registered once is parsed,
+	// rendered, scheduled, computed by agents and verified by eval.
+	if _, ok := ops.Lookup("#"); !ok {
+		err := ops.Register(&ops.Operation{
+			Symbol:        "#",
+			Kind:          ops.Infix,
+			Arity:         2,
+			Precedence:    3,
+			Associativity: ops.RightAssociative,
+			Cost:          50,
+			Apply:         func(args []float64) (float64, error) { return math.Pow(args[0], args[1]), nil },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	node, err := ParseAST("2*2#3#2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if node.String() != "2*2#3#2" || node.Right.Right.Operator != "#" {
+		t.Errorf("expected right-associative parse, got %s", node.String())
+	}
+	leftDeep := createASTNode(false, 0, "#", createASTNode(false, 0, "#", createASTNode(true, 2, "", nil, nil), createASTNode(true, 3, "", nil, nil)), createASTNode(true, 2, "", nil, nil))
+	if rendered := leftDeep.String(); rendered != "(2#3)#2" {
+		t.Errorf("expected (2#3)#2, got %s", rendered)
+	}
+	result, err := eval.Eval("2*2#3#2")
+	if err != nil || eval.BigratToFloat(result) != 1024 {
+		t.Errorf("expected eval to give 1024, got %v (%v)", result, err)
+	}
+	if value, err := NewAgent().Calculate("#", 3, 2); err != nil || value != 9 {
+		t.Errorf("expected agent to compute 9, got %v (%v)", value, err)
+	}
+
+	orchestrator := NewOrchestrator()
+	submitExpression(t, orchestrator, "1", "2#3")
+	task := orchestrator.taskQueue.PopFront().(*Task)
+	if task.Operation != "#" || task.OperationTime != 50 {
+		t.Errorf("unexpected task %+v", task)
+	}
+	if (AgentCapabilities{}).canRun(task) || !(AgentCapabilities{"#": true}).canRun(task) {
+		t.Error("expected the operator to require a capability")
+	}
+}
+
+func TestParseASTWithOptions_Natural(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2pi", "2*3.141592653589793"},
+		{"3(4+5)", "3*(4+5)"},
+		{"(1+2)(3-4)", "(1+2)*(3-4)"},
+		{"2 sqrt(4)", "2*sqrt(4)"},
+		{"2m 3", "(2m)*3"},
+		{"5!", "factorial(5)"},
+		{"-3!", "0-factorial(3)"},
+		{"2^3!", "2^factorial(3)"},
+		{"(1+2)!!", "factorial(factorial(1+2))"},
+		{"3! != 6", "factorial(3)!=6"},
+		{"1/2pi", "1/2*3.141592653589793"},
+		{"2 > 1 ? 2e : 3", "2>1?2*2.718281828459045:3"},
+	}
+	natural := ParseOptions{Natural: true}
+	for _, test := range tests {
+		ast, err := ParseASTWithOptions(test.input, natural)
+		if err != nil {
+			t.Errorf("ParseASTWithOptions(%q): unexpected error %v", test.input, err)
+			continue
+		}
+		if got := ast.String(); got != test.expected {
+			t.Errorf("ParseASTWithOptions(%q).String() = %q, want %q", test.input, got, test.expected)
+		}
+		if _, err := ParseAST(test.input); err == nil {
+			t.Errorf("ParseAST(%q): expected an error without natural notation", test.input)
+		}
+		// eval must read the expression the same way.
+		want, err := eval.EvalWithOptions(ast.String(), eval.Options{})
+		if err != nil {
+			t.Errorf("eval.Eval(%q): %v", ast.String(), err)
+			continue
+		}
+		got, err := eval.EvalWithOptions(test.input, eval.Options{Natural: true})
+		if err != nil || eval.BigratToFloat(got) != eval.BigratToFloat(want) {
+			t.Errorf("eval.EvalWithOptions(%q) = %v, %v, want %v", test.input, got, err, want)
+		}
+	}
+}
+
+func TestParseAST_Constants(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"pi", math.Pi},
+		{"e", math.E},
+		{"tau", 2 * math.Pi},
+		{"-phi", -math.Phi},
+	}
+	for _, test := range tests {
+		ast, err := ParseAST(test.input)
+		if err != nil || !ast.IsLeaf || ast.Value != test.expected {
+			t.Errorf("ParseAST(%q) = %v, %v, want %v", test.input, ast, err, test.expected)
+		}
+	}
+	registry := NewFunctionRegistry()
+	if err := registry.Define("alice", &UserFunction{Name: "f", Params: []string{"e"}, Body: "e*2"}); err != nil {
+		t.Fatal(err)
+	}
+	if ast, _, err := registry.Parse("alice", "f(3)", ParseOptions{}); err != nil || ast.String() != "3*2" {
+		t.Errorf("Expected the parameter to shadow the constant, got %v, %v", ast, err)
+	}
+}
@@ -0,0 +1,40 @@
+package app
+
+import "Yandex_Calc_V2.0/internal/ops"
+
+const MIN_REDUCTION_ARITY = 3
+
+// reductionOperation returns the reduction that folds chains of the infix
+// operator, or "" if there is none.
+func reductionOperation(op string) string {
+	if infix, ok := ops.LookupKind(op, ops.Infix); ok {
+		return infix.Reduction
+	}
+	return ""
+}
+
+func isReduction(op string) bool {
+	_, ok := ops.LookupKind(op, ops.Reduction)
+	return ok
+}
+
+// reductionOperands returns the operands of the + or * chain rooted at the
+// node when the chain is long enough to be shipped as one reduction task.
+func (o *Orchestrator) reductionOperands(node *ASTNode) []*ASTNode {
+	if !o.Config.ReductionTasks || reductionOperation(node.Operator) == "" || !isOperation(node) {
+		return nil
+	}
+	operands := flattenChain(node, node.Operator, nil)
+	if len(operands) < max(o.Config.MinReductionArity, 3) {
+		return nil
+	}
+	return operands
+}
+
+func flattenChain(node *ASTNode, op string, operands []*ASTNode) []*ASTNode {
+	if isOperation(node) && node.Operator == op {
+		operands = flattenChain(node.Left, op, operands)
+		return flattenChain(node.Right, op, operands)
+	}
+	return append(operands, node)
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestScheduleTasks_Reduction(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.Config.ReductionTasks = true
+	router := gin.Default()
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	expr := submitExpression(t, orchestrator, "1", "1+2+3+4*5")
+	if orchestrator.taskQueue.Len() != 1 {
+		t.Fatalf("Expected one task before the multiplication is done, got %d", orchestrator.taskQueue.Len())
+	}
+	mul := orchestrator.taskQueue.PopFront().(*Task)
+	if mul.Operation != "*" || mul.Args != nil {
+		t.Fatalf("Expected a binary multiplication task, got %+v", mul)
+	}
+	postResult(t, router, `{"id":"`+mul.ID+`","result":20}`)
+
+	if orchestrator.taskQueue.Len() != 1 {
+		t.Fatalf("Expected one reduction task, got %d", orchestrator.taskQueue.Len())
+	}
+	sum := orchestrator.taskQueue.PopFront().(*Task)
+	if sum.Operation != "sum" || len(sum.Args) != 4 || sum.Args[3] != 20 {
+		t.Fatalf("Expected sum of 4 arguments, got %+v", sum)
+	}
+	if sum.OperationTime != 3*orchestrator.Config.TimeForAddition {
+		t.Errorf("Expected operation time %d, got %d", 3*orchestrator.Config.TimeForAddition, sum.OperationTime)
+	}
+	recorder := postResult(t, router, `{"id":"`+sum.ID+`","result":26}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if expr.Status != "completed" || *expr.Result != 26 {
+		t.Errorf("Expected expression to complete with 26, got %s %v", expr.Status, expr.Result)
+	}
+}
+
+func TestScheduleTasks_ReductionBelowMinArity(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.Config.ReductionTasks = true
+	orchestrator.Config.MinReductionArity = 4
+
+	submitExpression(t, orchestrator, "1", "1*2*3")
+	task := orchestrator.taskQueue.PopFront().(*Task)
+	if task.Operation != "*" || task.Arg1 != 1 || task.Arg2 != 2 {
+		t.Errorf("Expected binary task 1*2, got %+v", task)
+	}
+}
+
+func TestGetTask_LegacyAgentSkipsReductions(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.Config.ReductionTasks = true
+	router := gin.Default()
+	router.GET("/internal/task", orchestrator.handleGetTaskRequest)
+
+	submitExpression(t, orchestrator, "1", "1+2+3")
+	submitExpression(t, orchestrator, "2", "4-5")
+
+	fetch := func(capabilities string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/internal/task", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if capabilities != "" {
+			req.Header.Set(AGENT_CAPABILITIES_HEADER, capabilities)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := fetch("")
+	expected := `{"task":{"id":"2","arg1":4,"arg2":5,"operation":"-","operation_time":152}}`
+	if recorder.Code != http.StatusOK || recorder.Body.String() != expected {
+		t.Fatalf("Expected %s, got %d %s", expected, recorder.Code, recorder.Body.String())
+	}
+	recorder = fetch("")
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for legacy agent, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	recorder = fetch("sum, prod")
+	expected = `{"task":{"id":"1","arg1":0,"arg2":0,"args":[1,2,3],"operation":"sum","operation_time":400}}`
+	if recorder.Code != http.StatusOK || recorder.Body.String() != expected {
+		t.Errorf("Expected %s, got %d %s", expected, recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestAgent_CalculateReduction(t *testing.T) {
+	agent := NewAgent()
+	tests := []struct {
+		op       string
+		args     []float64
+		expected float64
+	}{
+		{"sum", []float64{1, 2, 3, 4}, 10},
+		{"prod", []float64{1, 2, 3, 4}, 24},
+		{"sum", nil, 0},
+		{"prod", nil, 1},
+	}
+	for _, test := range tests {
+		result, err := agent.Calculate(test.op, test.args...)
+		if err != nil || result != test.expected {
+			t.Errorf("%s%v: expected %v, got %v (%v)", test.op, test.args, test.expected, result, err)
+		}
+	}
+	if _, err := agent.Calculate("+", 1, 2, 3); err == nil {
+		t.Error("Expected error for binary operator with three arguments")
+	}
+}
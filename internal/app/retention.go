@@ -0,0 +1,128 @@
+package app
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	RETENTION_MAX_AGE      = 24 * time.Hour
+	RETENTION_MAX_PER_USER = 1000
+	RETENTION_KEEP_FAILED  = true
+	JANITOR_INTERVAL       = time.Minute
+)
+
+// RetentionPolicy describes how long finished expressions stay in the store.
+// Zero MaxAge or MaxPerUser disables the corresponding limit. KeepFailed
+// exempts failed expressions from MaxPerUser only, so they still expire
+// after MaxAge.
+type RetentionPolicy struct {
+	MaxAge          time.Duration
+	MaxPerUser      int
+	KeepFailed      bool
+	JanitorInterval time.Duration
+}
+
+func SetDefaultRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{
+		MaxAge:          RETENTION_MAX_AGE,
+		MaxPerUser:      RETENTION_MAX_PER_USER,
+		KeepFailed:      RETENTION_KEEP_FAILED,
+		JanitorInterval: JANITOR_INTERVAL,
+	}
+}
+
+type JanitorStats struct {
+	Runs        int64      `json:"runs"`
+	PurgedTotal int64      `json:"purged_total"`
+	LastRun     *time.Time `json:"last_run,omitempty"`
+}
+
+func (o *Orchestrator) runJanitor() {
+	interval := o.Config.Retention.JanitorInterval
+	if interval <= 0 {
+		return
+	}
+	for {
+		time.Sleep(interval)
+		now := time.Now()
+		o.mutex.Lock()
+		purged := o.enforceRetention(now)
+		o.idempotency.Expire(now.Add(-o.Config.IdempotencyWindow))
+		o.forgetAgents(now)
+		unroutable := o.unroutableTasks(now)
+		o.mutex.Unlock()
+		if purged > 0 {
+			log.Printf("Janitor purged %d expressions", purged)
+		}
+		if len(unroutable) > 0 {
+			log.Printf("%d queued tasks cannot be run by any live agent, first: %s %s", len(unroutable), unroutable[0].ID, unroutable[0].Operation)
+		}
+	}
+}
+
+// enforceRetention removes finished expressions that violate the retention
+// policy, and finished jobs and import reports older than MaxAge.
+// Expressions that are still being calculated are never touched. The caller
+// must hold o.mutex.
+func (o *Orchestrator) enforceRetention(now time.Time) int {
+	policy := o.Config.Retention
+	perUser := make(map[string][]*Expression)
+	purged := 0
+	for id, expr := range o.expressionStore {
+		expr.syncStatus()
+		if !isFinished(expr) {
+			continue
+		}
+		if policy.MaxAge > 0 {
+			if at := expr.finishedAt(); at != nil && now.Sub(*at) > policy.MaxAge {
+				delete(o.expressionStore, id)
+				purged++
+				continue
+			}
+		}
+		if expr.Status != "failed" || !policy.KeepFailed {
+			perUser[expr.Owner] = append(perUser[expr.Owner], expr)
+		}
+	}
+	if policy.MaxPerUser > 0 {
+		for _, exprs := range perUser {
+			if len(exprs) <= policy.MaxPerUser {
+				continue
+			}
+			sort.Slice(exprs, func(i, j int) bool {
+				return newerThan(exprs[i], exprs[j])
+			})
+			for _, expr := range exprs[policy.MaxPerUser:] {
+				delete(o.expressionStore, expr.ID)
+				purged++
+			}
+		}
+	}
+	for id, job := range o.jobStore {
+		if policy.MaxAge > 0 && job.finished() && now.Sub(*job.CompletedAt) > policy.MaxAge {
+			delete(o.jobStore, id)
+		}
+	}
+	for id, report := range o.importReports {
+		if policy.MaxAge > 0 && now.Sub(report.CreatedAt) > policy.MaxAge {
+			delete(o.importReports, id)
+		}
+	}
+	o.janitorStats.Runs++
+	o.janitorStats.PurgedTotal += int64(purged)
+	o.janitorStats.LastRun = &now
+	return purged
+}
+
+func newerThan(a, b *Expression) bool {
+	at, bt := a.finishedAt(), b.finishedAt()
+	if at != nil && bt != nil && !at.Equal(*bt) {
+		return at.After(*bt)
+	}
+	ai, _ := strconv.ParseInt(a.ID, 10, 64)
+	bi, _ := strconv.ParseInt(b.ID, 10, 64)
+	return ai > bi
+}
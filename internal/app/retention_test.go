@@ -0,0 +1,74 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnforceRetention(t *testing.T) {
+	now := time.Now()
+	hoursAgo := func(h int) *time.Time {
+		at := now.Add(-time.Duration(h) * time.Hour)
+		return &at
+	}
+
+	tests := []struct {
+		name      string
+		policy    RetentionPolicy
+		remaining []string
+	}{
+		{
+			// Failed expressions expire even with KeepFailed.
+			name:      "Max Age",
+			policy:    RetentionPolicy{MaxAge: 10 * time.Hour, KeepFailed: true},
+			remaining: []string{"2", "3", "4", "6"},
+		},
+		{
+			name:      "Max Per User",
+			policy:    RetentionPolicy{MaxPerUser: 1, KeepFailed: true},
+			remaining: []string{"2", "4", "5", "6"},
+		},
+		{
+			name:      "Drop Failed",
+			policy:    RetentionPolicy{MaxPerUser: 1, KeepFailed: false},
+			remaining: []string{"2", "4", "6"},
+		},
+		{
+			name:      "Disabled",
+			policy:    RetentionPolicy{KeepFailed: true},
+			remaining: []string{"1", "2", "3", "4", "5", "6"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			orchestrator := NewOrchestrator()
+			orchestrator.Config.Retention = test.policy
+			orchestrator.expressionStore = map[string]*Expression{
+				"1": {ID: "1", Status: "completed", Owner: "alice", CreatedAt: hoursAgo(30), CompletedAt: hoursAgo(20)},
+				"2": {ID: "2", Status: "completed", Owner: "alice", CreatedAt: hoursAgo(3), CompletedAt: hoursAgo(2)},
+				"3": {ID: "3", Status: "cancelled", Owner: "alice", CreatedAt: hoursAgo(5)},
+				"4": {ID: "4", Status: "completed", Owner: "bob", CreatedAt: hoursAgo(1), CompletedAt: hoursAgo(1)},
+				"5": {ID: "5", Status: "failed", Owner: "bob", CreatedAt: hoursAgo(40), CompletedAt: hoursAgo(40)},
+				"6": {ID: "6", Status: "in_progress", Owner: "bob", CreatedAt: hoursAgo(50), AST: &ASTNode{Operator: "+"}},
+			}
+
+			purged := orchestrator.enforceRetention(now)
+
+			if purged != 6-len(test.remaining) {
+				t.Errorf("Expected %d purged expressions, got %d", 6-len(test.remaining), purged)
+			}
+			if len(orchestrator.expressionStore) != len(test.remaining) {
+				t.Errorf("Expected %d remaining expressions, got %d", len(test.remaining), len(orchestrator.expressionStore))
+			}
+			for _, id := range test.remaining {
+				if _, ok := orchestrator.expressionStore[id]; !ok {
+					t.Errorf("Expected expression %s to be kept", id)
+				}
+			}
+			if orchestrator.janitorStats.Runs != 1 || orchestrator.janitorStats.PurgedTotal != int64(purged) {
+				t.Errorf("Unexpected janitor stats: %+v", orchestrator.janitorStats)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package app
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"Yandex_Calc_V2.0/internal/ops"
+)
+
+// Literals of the special values. They are real numbers only; JSON has no
+// numbers for them, so results report them in special_result and agents in
+// TaskResult.Special.
+const (
+	INF = "inf"
+	NAN = "nan"
+)
+
+var specialValues = map[string]float64{
+	INF: math.Inf(1),
+	NAN: math.NaN(),
+}
+
+var errNotFinite = errors.New("result is not a finite number")
+
+func isFinite(x float64) bool {
+	return !math.IsInf(x, 0) && !math.IsNaN(x)
+}
+
+func allFinite(values []float64) bool {
+	for _, x := range values {
+		if !isFinite(x) {
+			return false
+		}
+	}
+	return true
+}
+
+// formatNumber renders a real number as a literal the parser reads back.
+// Like encoding/json, it switches to an exponent for very large and very
+// small magnitudes, so 1e308 does not become 309 digits.
+func formatNumber(x float64) string {
+	switch {
+	case math.IsNaN(x):
+		return NAN
+	case math.IsInf(x, 1):
+		return INF
+	case math.IsInf(x, -1):
+		return "-" + INF
+	}
+	if abs := math.Abs(x); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		return strconv.FormatFloat(x, 'e', -1, 64)
+	}
+	return strconv.FormatFloat(x, 'f', -1, 64)
+}
+
+func parseSpecial(text string) (float64, bool) {
+	if name, negative := strings.CutPrefix(text, "-"); negative {
+		value, ok := specialValues[name]
+		return -value, ok
+	}
+	value, ok := specialValues[text]
+	return value, ok
+}
+
+// hasSpecialValues reports whether a leaf of the subtree is not finite.
+func hasSpecialValues(node *ASTNode) bool {
+	if node == nil {
+		return false
+	}
+	if node.IsLeaf {
+		return !isFinite(node.Value) || !isFinite(node.Imag)
+	}
+	return hasSpecialValues(node.Left) || hasSpecialValues(node.Right)
+}
+
+// checkValue turns a special value into an error unless the configuration
+// allows them. Complex numbers must be finite either way.
+func (o *Orchestrator) checkValue(z complex128) error {
+	if !isFinite(imag(z)) || (!isFinite(real(z)) && !o.Config.SpecialValues) {
+		return errNotFinite
+	}
+	return nil
+}
+
+func (o *Orchestrator) parseOptions() ParseOptions {
+	return ParseOptions{SpecialValues: o.Config.SpecialValues}
+}
+
+// computeLocally applies an operation with special operands in the
+// orchestrator, as tasks cannot carry them to the agents.
+func (o *Orchestrator) computeLocally(expr *Expression, node *ASTNode, op string, args []float64) {
+	value, err := ops.Apply(op, args...)
+	if err == nil {
+		err = o.checkValue(complex(value, 0))
+	}
+	if err != nil {
+		o.failExpression(expr, err.Error())
+		return
+	}
+	node.setComplex(complex(value, 0))
+}
@@ -0,0 +1,253 @@
+package app
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseAST_NumericLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1e10", 1e10},
+		{"2.5E-3", 0.0025},
+		{".5e2", 50},
+		{"0x1F", 31},
+		{"0b101", 5},
+		{"1_000_000", 1000000},
+		{"-1.5e+3", -1500},
+	}
+	for _, test := range tests {
+		ast, err := ParseAST(test.input)
+		if err != nil {
+			t.Errorf("ParseAST(%q): unexpected error %v", test.input, err)
+			continue
+		}
+		if !ast.IsLeaf || ast.Value != test.expected {
+			t.Errorf("ParseAST(%q) = %s, want %v", test.input, ast, test.expected)
+		}
+	}
+}
+
+func TestParseAST_InvalidNumericLiterals(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		offset  int
+	}{
+		{"1.2.3", "unexpected . in number 1.2", 3},
+		{"2 * 1.", "expected a digit after the decimal point", 6},
+		{"0x", "hexadecimal literal has no digits", 0},
+		{"1 + 0b12", "invalid digit '2' in binary literal", 7},
+		{"1__000", "underscore must separate digits", 1},
+		{"inf", "special value inf is not allowed", 0},
+		{"1 / nan", "special value nan is not allowed", 4},
+	}
+	for _, test := range tests {
+		errs := parseErrors(t, test.input)
+		if err := errs[0]; err.Code != PARSE_INVALID_NUMBER || err.Message != test.message || err.Offset != test.offset {
+			t.Errorf("ParseAST(%q): got %+v, want %q at %d", test.input, err, test.message, test.offset)
+		}
+	}
+}
+
+func TestParseAST_SpecialValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"inf", "inf"},
+		{"-inf", "(-inf)"},
+		{"nan", "nan"},
+		{"1/inf", "1/inf"},
+	}
+	options := ParseOptions{SpecialValues: true}
+	for _, test := range tests {
+		ast, err := ParseASTWithOptions(test.input, options)
+		if err != nil {
+			t.Errorf("ParseASTWithOptions(%q): unexpected error %v", test.input, err)
+			continue
+		}
+		if got := ast.String(); got != test.expected {
+			t.Errorf("ParseASTWithOptions(%q).String() = %q, want %q", test.input, got, test.expected)
+		}
+		if again, err := ParseASTWithOptions(test.expected, options); err != nil || again.String() != test.expected {
+			t.Errorf("ParseASTWithOptions(%q) does not round trip: %v, %v", test.expected, again, err)
+		}
+	}
+}
+
+func submitSpecial(t *testing.T, o *Orchestrator, id, text string) *Expression {
+	t.Helper()
+	ast, err := ParseASTWithOptions(text, o.parseOptions())
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %v", text, err)
+	}
+	expr := &Expression{ID: id, Expr: text, Status: "pending", AST: ast, Options: o.parseOptions()}
+	o.expressionStore[id] = expr
+	o.scheduleTasksForExpression(expr)
+	if err := o.completeExpression(expr); err != nil {
+		t.Fatalf("Failed to complete %q: %v", text, err)
+	}
+	return expr
+}
+
+func TestScheduleTasks_SpecialOperandsComputedLocally(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.Config.SpecialValues = true
+	tests := []struct {
+		input   string
+		result  *float64
+		special string
+	}{
+		{"1/inf", new(float64), ""},
+		{"inf-inf", nil, "nan"},
+		{"-inf*2", nil, "-inf"},
+	}
+	for i, test := range tests {
+		expr := submitSpecial(t, orchestrator, string(rune('1'+i)), test.input)
+		if expr.Status != "completed" || expr.SpecialResult != test.special || (expr.Result == nil) != (test.result == nil) {
+			t.Errorf("%s: expected %v %q, got %+v", test.input, test.result, test.special, expr)
+		}
+		if expr.Result != nil && *expr.Result != *test.result {
+			t.Errorf("%s: expected %v, got %v", test.input, *test.result, *expr.Result)
+		}
+	}
+	if orchestrator.taskQueue.Len() != 0 {
+		t.Errorf("Expected no tasks, got %d", orchestrator.taskQueue.Len())
+	}
+}
+
+func TestOptimize_ZeroProductOfSpecialValues(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.Config.SpecialValues = true
+	orchestrator.Config.Optimizer = OptimizerConfig{Enabled: true, Identities: true}
+	for _, input := range []string{"0*inf", "nan*0", "inf*0+1"} {
+		ast, err := ParseASTWithOptions(input, orchestrator.parseOptions())
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", input, err)
+		}
+		optimized, _ := orchestrator.Optimize(ast, false)
+		if value, _ := evaluateLocally(optimized); !math.IsNaN(value) {
+			t.Errorf("%s: expected nan, got %s = %v", input, optimized, value)
+		}
+	}
+}
+
+func TestHandlePostTaskRequest_SpecialResult(t *testing.T) {
+	for _, allowed := range []bool{true, false} {
+		orchestrator := NewOrchestrator()
+		orchestrator.Config.SpecialValues = allowed
+		router := gin.Default()
+		router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+		expr := submitSpecial(t, orchestrator, "1", "1e308*10")
+		if recorder := postResult(t, router, `{"id":"1","result":0,"special":"inf"}`); recorder.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+		}
+		if allowed && (expr.Status != "completed" || expr.SpecialResult != INF) {
+			t.Errorf("Expected inf, got %+v", expr)
+		}
+		if !allowed && (expr.Status != "failed" || expr.Error != errNotFinite.Error()) {
+			t.Errorf("Expected a failed expression, got %+v", expr)
+		}
+	}
+}
+
+func TestHandlePostTaskRequest_InvalidSpecialKeepsTask(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.Config.SpecialValues = true
+	router := gin.Default()
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	expr := submitSpecial(t, orchestrator, "1", "1e308*10")
+	if recorder := postResult(t, router, `{"id":"1","result":0,"special":"infinity"}`); recorder.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if _, ok := orchestrator.taskStorage["1"]; !ok {
+		t.Fatal("Expected the task to be kept for a retry")
+	}
+	if recorder := postResult(t, router, `{"id":"1","result":0,"special":"inf"}`); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if expr.Status != "completed" || expr.SpecialResult != INF {
+		t.Errorf("Expected inf, got %+v", expr)
+	}
+}
+
+func TestHandleCalculateRequest_SpecialValues(t *testing.T) {
+	for _, allowed := range []bool{true, false} {
+		orchestrator := NewOrchestrator()
+		orchestrator.Config.SpecialValues = allowed
+		router := gin.Default()
+		router.POST("/api/v1/calculate", orchestrator.handleCalculateRequest)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", strings.NewReader(`{"expression":"2 > inf ? 1 : 0"}`))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if !allowed {
+			if recorder.Code != http.StatusUnprocessableEntity {
+				t.Errorf("Expected status 422, got %d", recorder.Code)
+			}
+			continue
+		}
+		if recorder.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", recorder.Code, recorder.Body.String())
+		}
+		if expr := orchestrator.expressionStore["1"]; expr.Status != "completed" || expr.Result == nil || *expr.Result != 0 {
+			t.Errorf("Expected 0, got %+v", expr)
+		}
+	}
+}
+
+func TestExpression_SpecialResultJSON(t *testing.T) {
+	expr := &Expression{ID: "1", Expr: "inf", Status: "completed", AST: &ASTNode{IsLeaf: true, Value: math.Inf(-1)}}
+	expr.setResult()
+	body, err := json.Marshal(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"id":"1","expression":"inf","status":"completed","special_result":"-inf"}`; string(body) != expected {
+		t.Errorf("Expected %s, got %s", expected, body)
+	}
+	for _, text := range []string{"inf", "-inf", "nan"} {
+		if value, ok := parseSpecial(text); !ok || formatNumber(value) != text {
+			t.Errorf("parseSpecial(%q) = %v, %v", text, value, ok)
+		}
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{0, "0"},
+		{-2.5, "-2.5"},
+		{1234567, "1234567"},
+		{0.000001, "0.000001"},
+		{1e-7, "1e-07"},
+		{1e21, "1e+21"},
+		{-1e308, "-1e+308"},
+		{math.Inf(1), "inf"},
+	}
+	for _, test := range tests {
+		got := formatNumber(test.value)
+		if got != test.expected {
+			t.Errorf("formatNumber(%v) = %q, want %q", test.value, got, test.expected)
+		}
+		if ast, err := ParseASTWithOptions(got, ParseOptions{SpecialValues: true}); err != nil {
+			t.Errorf("formatNumber(%v) = %q is not read back: %v", test.value, got, err)
+		} else if value, _ := evaluateLocally(ast); value != test.value {
+			t.Errorf("formatNumber(%v) = %q reads back as %v", test.value, got, value)
+		}
+	}
+}
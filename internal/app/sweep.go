@@ -0,0 +1,378 @@
+package app
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	JOB_SWEEP           = "sweep"
+	SWEEP_MAX_POINTS    = 100000
+	SWEEP_MAX_IN_FLIGHT = 256
+	SWEEP_NDJSON        = "ndjson"
+	SWEEP_CSV           = "csv"
+	SWEEP_FLUSH_ROWS    = 1000
+)
+
+// SweepVariable swagger model
+// @Description Диапазон переменной: значения from, from+step, ... не больше to
+type SweepVariable struct {
+	Name string  `json:"name" example:"x"`
+	From float64 `json:"from" example:"0"`
+	To   float64 `json:"to" example:"10"`
+	Step float64 `json:"step" example:"0.01"`
+}
+
+func (v SweepVariable) count() int {
+	return int(math.Floor((v.To-v.From)/v.Step+1e-9)) + 1
+}
+
+// sweepCell is the result of one point of a sweep.
+type sweepCell struct {
+	result  *float64
+	special string
+	err     string
+}
+
+func newSweepJob(variables []SweepVariable) (*Job, error) {
+	if len(variables) == 0 {
+		return nil, errors.New("no variables")
+	}
+	size := 1
+	seen := make(map[string]bool)
+	for _, v := range variables {
+		switch {
+		case !validVariable(v.Name):
+			return nil, fmt.Errorf("invalid variable name %q", v.Name)
+		case seen[v.Name]:
+			return nil, fmt.Errorf("variable %s is repeated", v.Name)
+		case !isFinite(v.From) || !isFinite(v.To) || !(v.Step > 0) || v.To < v.From:
+			return nil, fmt.Errorf("variable %s: expected from <= to and a positive step", v.Name)
+		}
+		seen[v.Name] = true
+		if float64(size)*((v.To-v.From)/v.Step+1) > SWEEP_MAX_POINTS {
+			return nil, fmt.Errorf("the grid has more than %d points", SWEEP_MAX_POINTS)
+		}
+		size *= v.count()
+	}
+	return &Job{Kind: JOB_SWEEP, grid: variables, cells: make([]sweepCell, size)}, nil
+}
+
+// gridPoint returns the values of the variables at the index of the
+// cartesian product; the last variable changes fastest.
+func (j *Job) gridPoint(index int) []float64 {
+	values := make([]float64, len(j.grid))
+	for i := len(j.grid) - 1; i >= 0; i-- {
+		count := j.grid[i].count()
+		values[i] = j.grid[i].From + float64(index%count)*j.grid[i].Step
+		index /= count
+	}
+	return values
+}
+
+// bind replaces the variables with their values.
+func bind(node *ASTNode, values map[string]float64) *ASTNode {
+	if node == nil {
+		return nil
+	}
+	if node.IsLeaf && node.Variable != "" {
+		return number(values[node.Variable])
+	}
+	clone := *node
+	clone.Left = bind(node.Left, values)
+	clone.Right = bind(node.Right, values)
+	return &clone
+}
+
+// startSweep queues the sweep. Its points are started as expressions by
+// pumpSweeps, which keeps at most Config.SweepMaxInFlight samples of all
+// sweeps in flight.
+func (o *Orchestrator) startSweep(job *Job) string {
+	o.jobCounter++
+	job.ID = strconv.FormatInt(o.jobCounter, 10)
+	job.Status = "pending"
+	job.setTotal(len(job.cells))
+	o.jobStore[job.ID] = job
+	o.sweepQueue = append(o.sweepQueue, job)
+	o.pumpSweeps()
+	return job.ID
+}
+
+// pumpSweeps starts points of the queued sweeps in turn while the limit
+// allows. Samples that finish at once call it again, so nested calls return
+// and leave the work to the outer loop.
+func (o *Orchestrator) pumpSweeps() {
+	if o.pumping {
+		return
+	}
+	o.pumping = true
+	defer func() { o.pumping = false }()
+	limit := o.Config.SweepMaxInFlight
+	for len(o.sweepQueue) > 0 && (limit <= 0 || o.sweepInFlight < limit) {
+		job := o.sweepQueue[0]
+		o.sweepQueue = o.sweepQueue[1:]
+		if job.finished() || job.next == len(job.cells) {
+			continue
+		}
+		o.startSweepSample(job)
+		if job.next < len(job.cells) && !job.finished() {
+			o.sweepQueue = append(o.sweepQueue, job)
+		}
+	}
+}
+
+func (o *Orchestrator) startSweepSample(job *Job) {
+	index := job.next
+	job.next++
+	values := make(map[string]float64, len(job.grid))
+	for i, value := range job.gridPoint(index) {
+		values[job.grid[i].Name] = value
+	}
+	point := bind(job.function, values)
+	expr := &Expression{
+		Expr:      point.String(),
+		CreatedAt: job.CreatedAt,
+		Owner:     job.Owner,
+		Options:   ParseOptions{SpecialValues: o.Config.SpecialValues},
+		JobID:     job.ID,
+		sample:    index,
+	}
+	o.sweepInFlight++
+	job.samples = append(job.samples, o.startExpression(expr, point, false, false))
+}
+
+// finishSweepSample records the result of a point. Unlike the samples of
+// solve and integrate, a failed point is reported in its row and does not
+// fail the sweep.
+func (o *Orchestrator) finishSweepSample(job *Job, expr *Expression) {
+	o.sweepInFlight--
+	if !job.finished() {
+		cell := &job.cells[expr.sample]
+		switch {
+		case expr.Status == "cancelled":
+			cell.err = JOB_SAMPLE_CANCELLED
+		case expr.Status != "completed":
+			cell.err = expr.Error
+		case expr.Result != nil:
+			cell.result = expr.Result
+		case expr.SpecialResult != "":
+			cell.special = expr.SpecialResult
+		default:
+			cell.err = "f " + JOB_SAMPLE_NOT_REAL
+		}
+		job.Status = "in_progress"
+		job.Progress.Done++
+		job.setTotal(job.Progress.Total)
+		if job.Progress.Done == job.Progress.Total {
+			now := time.Now()
+			job.Status = "completed"
+			job.CompletedAt = &now
+		}
+	}
+	o.pumpSweeps()
+}
+
+func jsonString(s string) string {
+	encoded, _ := json.Marshal(s)
+	return string(encoded)
+}
+
+// writeSweep streams the rows of a finished sweep, flushing them to the
+// client every SWEEP_FLUSH_ROWS rows.
+func writeSweep(out io.Writer, job *Job, format string) error {
+	w := bufio.NewWriter(out)
+	flush := func() error {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if flusher, ok := out.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		return nil
+	}
+	var table *csv.Writer
+	if format == SWEEP_CSV {
+		table = csv.NewWriter(w)
+		header := make([]string, 0, len(job.grid)+3)
+		for _, v := range job.grid {
+			header = append(header, v.Name)
+		}
+		if err := table.Write(append(header, "result", "special_result", "error")); err != nil {
+			return err
+		}
+	}
+	for i, cell := range job.cells {
+		values := job.gridPoint(i)
+		if table != nil {
+			record := make([]string, 0, len(values)+3)
+			for _, value := range values {
+				record = append(record, formatNumber(value))
+			}
+			result := ""
+			if cell.result != nil {
+				result = formatNumber(*cell.result)
+			}
+			if err := table.Write(append(record, result, cell.special, cell.err)); err != nil {
+				return err
+			}
+		} else {
+			var row strings.Builder
+			row.WriteByte('{')
+			for k, value := range values {
+				fmt.Fprintf(&row, "%s:%s,", jsonString(job.grid[k].Name), formatNumber(value))
+			}
+			switch {
+			case cell.result != nil:
+				fmt.Fprintf(&row, `"result":%s}`, formatNumber(*cell.result))
+			case cell.special != "":
+				fmt.Fprintf(&row, `"special_result":%s}`, jsonString(cell.special))
+			default:
+				fmt.Fprintf(&row, `"error":%s}`, jsonString(cell.err))
+			}
+			row.WriteByte('\n')
+			if _, err := w.WriteString(row.String()); err != nil {
+				return err
+			}
+		}
+		if (i+1)%SWEEP_FLUSH_ROWS == 0 {
+			if table != nil {
+				table.Flush()
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if table != nil {
+		table.Flush()
+		if err := table.Error(); err != nil {
+			return err
+		}
+	}
+	return flush()
+}
+
+// SweepRequest swagger model
+// @Description Вычисление выражения на сетке значений переменных
+type SweepRequest struct {
+	Expression string          `json:"expression" binding:"required" example:"x*y"`
+	Variables  []SweepVariable `json:"variables" binding:"required"`
+	// Format is the default format of the results: ndjson or csv.
+	Format          string `json:"format,omitempty" example:"ndjson"`
+	NaturalNotation bool   `json:"natural_notation,omitempty" example:"false"`
+}
+
+// @Summary Start a parameter sweep
+// @Description Calculate the expression at every point of the cartesian product of the variable ranges. Points are calculated as ordinary expressions with job_id set, at most SweepMaxInFlight of all sweeps at a time; the progress is reported by /jobs/{id}
+// @Tags jobs
+// @Accept json
+// @Produce json
+// @Param sweep body SweepRequest true "Expression and variable ranges"
+// @Success 201 {object} ExpressionResponse "Job ID"
+// @Failure 422 {object} ParseErrorResponse "Invalid expression or variable ranges"
+// @Router /sweep [post]
+func (o *Orchestrator) handleSweepRequest(c *gin.Context) {
+	if c.Request.Method != http.MethodPost {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
+		return
+	}
+	var req SweepRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Expression == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid Body"})
+		return
+	}
+	if req.Format == "" {
+		req.Format = SWEEP_NDJSON
+	}
+	if req.Format != SWEEP_NDJSON && req.Format != SWEEP_CSV {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid format " + req.Format})
+		return
+	}
+	job, err := newSweepJob(req.Variables)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid sweep: " + err.Error()})
+		return
+	}
+	now := time.Now()
+	job.Expr, job.Owner, job.CreatedAt, job.format = req.Expression, userFromRequest(c), &now, req.Format
+	options := o.parseOptions()
+	options.Natural = req.NaturalNotation
+	for _, v := range req.Variables {
+		options.Variables = append(options.Variables, v.Name)
+	}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	function, _, err := o.functions.Parse(job.Owner, req.Expression, options)
+	if err != nil {
+		var parseErrors ParseErrors
+		errors.As(err, &parseErrors)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid expression", "errors": parseErrors})
+		return
+	}
+	if hasUnits(function) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid sweep: units are not supported in jobs"})
+		return
+	}
+	job.function = function
+	c.JSON(http.StatusCreated, gin.H{"id": o.startSweep(job)})
+}
+
+// @Summary Get sweep results
+// @Description Stream the rows of a finished sweep as NDJSON or CSV. A sweep still being calculated returns 202 with its progress
+// @Tags jobs
+// @Produce json
+// @Produce plain
+// @Param id path string true "Job ID"
+// @Param format query string false "ndjson or csv, the format of the request by default"
+// @Success 200 {string} string "Rows"
+// @Success 202 {object} JobResponse "Sweep in progress"
+// @Failure 404 {object} Error "Sweep not found"
+// @Failure 409 {object} Error "Sweep cancelled"
+// @Failure 422 {object} Error "Invalid format"
+// @Router /sweep/{id} [get]
+func (o *Orchestrator) handleSweepResultsRequest(c *gin.Context) {
+	if c.Request.Method != http.MethodGet {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Wrong Method"})
+		return
+	}
+	o.mutex.Lock()
+	job, ok := o.userJob(c)
+	if !ok || job.Kind != JOB_SWEEP {
+		o.mutex.Unlock()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sweep not found"})
+		return
+	}
+	if job.Status != "completed" {
+		defer o.mutex.Unlock()
+		if job.finished() {
+			c.JSON(http.StatusConflict, gin.H{"error": "Sweep " + job.Status})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"job": job})
+		return
+	}
+	// The rows of a completed sweep no longer change.
+	o.mutex.Unlock()
+	format := c.DefaultQuery("format", job.format)
+	contentType := map[string]string{SWEEP_NDJSON: "application/x-ndjson", SWEEP_CSV: "text/csv"}[format]
+	if contentType == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid format " + format})
+		return
+	}
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	if err := writeSweep(c.Writer, job, format); err != nil {
+		c.Error(err)
+	}
+}
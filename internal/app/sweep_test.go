@@ -0,0 +1,207 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func sweepRouter(o *Orchestrator) *gin.Engine {
+	router := jobRouter(o)
+	router.POST("/api/v1/sweep", o.handleSweepRequest)
+	router.GET("/api/v1/sweep/:id", o.handleSweepResultsRequest)
+	return router
+}
+
+func postSweep(t *testing.T, router *gin.Engine, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/sweep", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func getSweep(router *gin.Engine, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestNewSweepJob(t *testing.T) {
+	job, err := newSweepJob([]SweepVariable{{Name: "x", From: 0, To: 1, Step: 0.5}, {Name: "y", From: 1, To: 2, Step: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(job.cells) != 6 {
+		t.Fatalf("Expected 6 points, got %d", len(job.cells))
+	}
+	if point := job.gridPoint(3); point[0] != 0.5 || point[1] != 2 {
+		t.Errorf("Expected point 3 at (0.5, 2), got %v", point)
+	}
+	if job, _ := newSweepJob([]SweepVariable{{Name: "x", From: 0, To: 10, Step: 0.01}}); len(job.cells) != 1001 {
+		t.Errorf("Expected 1001 points, got %d", len(job.cells))
+	}
+
+	tests := []struct {
+		variables []SweepVariable
+		message   string
+	}{
+		{nil, "no variables"},
+		{[]SweepVariable{{Name: "pi", To: 1, Step: 1}}, `invalid variable name "pi"`},
+		{[]SweepVariable{{Name: "x", To: 1, Step: 1}, {Name: "x", To: 1, Step: 1}}, "variable x is repeated"},
+		{[]SweepVariable{{Name: "x", To: 1}}, "variable x: expected from <= to and a positive step"},
+		{[]SweepVariable{{Name: "x", From: 2, To: 1, Step: 1}}, "variable x: expected from <= to and a positive step"},
+		{[]SweepVariable{{Name: "x", To: 1000, Step: 1}, {Name: "y", To: 1000, Step: 1}}, "the grid has more than 100000 points"},
+	}
+	for _, test := range tests {
+		if _, err := newSweepJob(test.variables); err == nil || err.Error() != test.message {
+			t.Errorf("newSweepJob(%v): expected %q, got %v", test.variables, test.message, err)
+		}
+	}
+}
+
+func TestHandleSweepRequest(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.Config.Optimizer.Enabled = false
+	router := sweepRouter(orchestrator)
+
+	recorder := postSweep(t, router, `{"expression":"x/y","variables":[{"name":"x","from":1,"to":2,"step":1},{"name":"y","from":0,"to":2,"step":2}]}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := getSweep(router, "/api/v1/sweep/1"); recorder.Code != http.StatusAccepted || !strings.Contains(recorder.Body.String(), `"total":4`) {
+		t.Errorf("Expected 202 with progress, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	agent := NewAgent()
+	for orchestrator.taskQueue.Len() > 0 {
+		task := orchestrator.taskQueue.PopFront().(*Task)
+		z, err := agent.compute(task.Operation, []float64{task.Arg1, task.Arg2}, nil)
+		body := `{"id":"` + task.ID + `","result":` + formatNumber(real(z)) + `}`
+		if err != nil {
+			body = `{"id":"` + task.ID + `","error":"` + err.Error() + `"}`
+		}
+		postResult(t, router, body)
+	}
+
+	recorder = getSweep(router, "/api/v1/sweep/1")
+	expected := `{"x":1,"y":0,"error":"division by zero is not allowed"}
+{"x":1,"y":2,"result":0.5}
+{"x":2,"y":0,"error":"division by zero is not allowed"}
+{"x":2,"y":2,"result":1}
+`
+	if recorder.Code != http.StatusOK || recorder.Body.String() != expected {
+		t.Errorf("Expected NDJSON rows, got %d:\n%s", recorder.Code, recorder.Body.String())
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Errorf("Expected application/x-ndjson, got %s", contentType)
+	}
+
+	recorder = getSweep(router, "/api/v1/sweep/1?format=csv")
+	expected = "x,y,result,special_result,error\n1,0,,,division by zero is not allowed\n1,2,0.5,,\n2,0,,,division by zero is not allowed\n2,2,1,,\n"
+	if recorder.Code != http.StatusOK || recorder.Body.String() != expected {
+		t.Errorf("Expected CSV rows, got %d:\n%s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := getSweep(router, "/api/v1/sweep/1?format=xml"); recorder.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", recorder.Code)
+	}
+	if recorder := getSweep(router, "/api/v1/sweep/2"); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", recorder.Code)
+	}
+}
+
+func TestHandleSweepRequest_Errors(t *testing.T) {
+	router := sweepRouter(NewOrchestrator())
+	tests := []string{
+		`{"expression":"x+","variables":[{"name":"x","to":1,"step":1}]}`,
+		`{"expression":"x+y","variables":[{"name":"x","to":1,"step":1}]}`,
+		`{"expression":"x","variables":[{"name":"x","to":1,"step":1}],"format":"xml"}`,
+		`{"expression":"x*1m","variables":[{"name":"x","to":1,"step":1}]}`,
+		`{"expression":"x","variables":[]}`,
+		`{"expression":"x"}`,
+	}
+	for _, body := range tests {
+		if recorder := postSweep(t, router, body); recorder.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: expected status 422, got %d", body, recorder.Code)
+		}
+	}
+}
+
+func TestPumpSweeps_Throttling(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.Config.Optimizer.Enabled = false
+	orchestrator.Config.SweepMaxInFlight = 3
+	router := sweepRouter(orchestrator)
+
+	postSweep(t, router, `{"expression":"x*2","variables":[{"name":"x","from":1,"to":4,"step":1}]}`)
+	postSweep(t, router, `{"expression":"x*3","variables":[{"name":"x","from":1,"to":4,"step":1}],"format":"csv"}`)
+	first, second := orchestrator.jobStore["1"], orchestrator.jobStore["2"]
+	if orchestrator.taskQueue.Len() != 3 || first.next != 3 || second.next != 0 {
+		t.Fatalf("Expected 3 points of the first sweep in flight, got %d tasks, next %d and %d", orchestrator.taskQueue.Len(), first.next, second.next)
+	}
+	task := orchestrator.taskQueue.PopFront().(*Task)
+	postResult(t, router, `{"id":"`+task.ID+`","result":2}`)
+	if orchestrator.sweepInFlight != 3 || first.next != 4 {
+		t.Errorf("Expected the freed slot to be taken by the first sweep, got %d in flight, next %d", orchestrator.sweepInFlight, first.next)
+	}
+
+	runMatrixTasks(t, orchestrator, router)
+	if first.Status != "completed" || second.Status != "completed" || orchestrator.sweepInFlight != 0 {
+		t.Fatalf("Expected completed sweeps, got %s and %s with %d in flight", first.Status, second.Status, orchestrator.sweepInFlight)
+	}
+	if recorder := getSweep(router, "/api/v1/sweep/2"); recorder.Body.String() != "x,result,special_result,error\n1,3,,\n2,6,,\n3,9,,\n4,12,,\n" {
+		t.Errorf("Unexpected CSV rows:\n%s", recorder.Body.String())
+	}
+}
+
+func TestHandleDeleteJobRequest_Sweep(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	orchestrator.Config.Optimizer.Enabled = false
+	orchestrator.Config.SweepMaxInFlight = 2
+	router := sweepRouter(orchestrator)
+	postSweep(t, router, `{"expression":"x*2","variables":[{"name":"x","from":1,"to":10,"step":1}]}`)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/jobs/1", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if orchestrator.sweepInFlight != 0 || orchestrator.taskQueue.Len() != 0 || orchestrator.jobStore["1"].next != 2 {
+		t.Errorf("Expected the sweep to stop, got %d in flight and %d tasks", orchestrator.sweepInFlight, orchestrator.taskQueue.Len())
+	}
+	if recorder := getSweep(router, "/api/v1/sweep/1"); recorder.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", recorder.Code)
+	}
+}
+
+func TestHandleSweepRequest_Negation(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := sweepRouter(orchestrator)
+	postSweep(t, router, `{"expression":"-x","variables":[{"name":"x","from":1,"to":2,"step":1}],"format":"csv"}`)
+
+	runMatrixTasks(t, orchestrator, router)
+	if recorder := getSweep(router, "/api/v1/sweep/1"); recorder.Body.String() != "x,result,special_result,error\n1,-1,,\n2,-2,,\n" {
+		t.Errorf("Unexpected CSV rows:\n%s", recorder.Body.String())
+	}
+}
+
+func TestHandleSweepResultsRequest_OtherUser(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := sweepRouter(orchestrator)
+	postSweep(t, router, `{"expression":"x*2","variables":[{"name":"x","from":1,"to":2,"step":1}]}`)
+	runMatrixTasks(t, orchestrator, router)
+
+	for user, code := range map[string]int{"": http.StatusOK, "bob": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/sweep/1", nil)
+		if user != "" {
+			req.Header.Set(USER_HEADER, user)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != code {
+			t.Errorf("User %q: expected status %d, got %d: %s", user, code, recorder.Code, recorder.Body.String())
+		}
+	}
+}
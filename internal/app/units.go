@@ -0,0 +1,168 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"unicode"
+
+	"Yandex_Calc_V2.0/internal/ops"
+	"Yandex_Calc_V2.0/internal/units"
+)
+
+// parseUnit reads the unit after a number literal, as in 3km or 2m^2, and
+// converts the literal to SI base units. An exponent written right after the
+// unit belongs to it, so 2m^2 is two square metres.
+func (p *parser) parseUnit(node *ASTNode) error {
+	start := p.pos
+	for isIdentifierChar(p.peek()) {
+		p.get()
+	}
+	name := p.input[start:p.pos]
+	unit, ok := units.Lookup(name)
+	if !ok {
+		return p.fail(start, PARSE_UNKNOWN_UNIT, nil, "unknown unit %s", name)
+	}
+	exponent := 1
+	p.skipSpaces()
+	if p.peek() == '^' {
+		caret := p.pos
+		p.get()
+		p.skipSpaces()
+		digits := p.pos
+		for unicode.IsDigit(p.peek()) {
+			p.get()
+		}
+		if digits == p.pos {
+			// Not an exponent of the unit, like 2m^x.
+			p.pos = caret
+		} else {
+			var err error
+			if exponent, err = strconv.Atoi(p.input[digits:p.pos]); err != nil {
+				return p.fail(digits, PARSE_INVALID_NUMBER, nil, "invalid exponent of %s", name)
+			}
+		}
+	}
+	node.Value = unit.Scaled(node.Value, exponent)
+	node.Unit = unit.Dimension.Pow(exponent)
+	return nil
+}
+
+// unitOf checks that the units of the expression are consistent and returns
+// the unit of its result. Sums need operands of one unit, products combine
+// them, and functions other than the ones below take dimensionless
+// arguments.
+func unitOf(node *ASTNode) (units.Dimension, error) {
+	if node.IsLeaf {
+		return node.Unit, nil
+	}
+	if args := callArguments(node); args != nil {
+		return aggregateUnit(node.Operator, args)
+	}
+	left, err := unitOf(node.Left)
+	if err != nil {
+		return left, err
+	}
+	if isCall(node) {
+		switch node.Operator {
+		case "abs", "conj", "re", "im", "transpose":
+			return left, nil
+		case "inv":
+			return left.Pow(-1), nil
+		case "sqrt":
+			if root, ok := left.Root(2); ok {
+				return root, nil
+			}
+			return left, fmt.Errorf("cannot take the square root of %s", describeUnit(left))
+		}
+		return left, dimensionless(node.Operator, left)
+	}
+	right, err := unitOf(node.Right)
+	if err != nil {
+		return right, err
+	}
+	switch node.Operator {
+	case "+", "-":
+		if left != right {
+			verb := map[string]string{"+": "add", "-": "subtract"}[node.Operator]
+			return left, fmt.Errorf("cannot %s %s and %s", verb, describeUnit(left), describeUnit(right))
+		}
+		return left, nil
+	case "*", "dot":
+		return left.Mul(right), nil
+	case "/":
+		return left.Div(right), nil
+	case "^":
+		if err := dimensionless("^", right); err != nil {
+			return right, err
+		}
+		if left.Dimensionless() {
+			return left, nil
+		}
+		exponent := node.Right
+		if !exponent.IsLeaf || exponent.Matrix != nil || exponent.Imag != 0 || exponent.Value != math.Trunc(exponent.Value) || math.Abs(exponent.Value) > math.MaxInt32 {
+			return left, fmt.Errorf("exponent of %s must be an integer constant", describeUnit(left))
+		}
+		return left.Pow(int(exponent.Value)), nil
+	case "<", "<=", ">", ">=", "==", "!=":
+		if left != right {
+			return left, fmt.Errorf("cannot compare %s and %s", describeUnit(left), describeUnit(right))
+		}
+		return units.Dimension{}, nil
+	case CONDITIONAL:
+		if !left.Dimensionless() {
+			return left, fmt.Errorf("condition must be dimensionless, got %s", left)
+		}
+		return right, nil
+	case BRANCHES:
+		if left != right {
+			return left, fmt.Errorf("branches of a conditional have different units: %s and %s", describeUnit(left), describeUnit(right))
+		}
+		return left, nil
+	}
+	if _, ok := ops.Lookup(node.Operator); ok {
+		if err := dimensionless(node.Operator, left); err != nil {
+			return left, err
+		}
+		return right, dimensionless(node.Operator, right)
+	}
+	return left, fmt.Errorf("unknown operator %s", node.Operator)
+}
+
+// aggregateUnit multiplies the units of the arguments of prod; the other
+// variadic functions need arguments of one unit, which var squares.
+func aggregateUnit(op string, args []*ASTNode) (units.Dimension, error) {
+	var result units.Dimension
+	for i, arg := range args {
+		unit, err := unitOf(arg)
+		if err != nil {
+			return unit, err
+		}
+		switch {
+		case op == "prod":
+			result = result.Mul(unit)
+		case i == 0:
+			result = unit
+		case unit != result:
+			return result, fmt.Errorf("%s expects arguments of one unit, got %s and %s", op, describeUnit(result), describeUnit(unit))
+		}
+	}
+	if op == "var" {
+		return result.Pow(2), nil
+	}
+	return result, nil
+}
+
+func dimensionless(op string, unit units.Dimension) error {
+	if unit.Dimensionless() {
+		return nil
+	}
+	return fmt.Errorf("%s expects dimensionless operands, got %s", op, unit)
+}
+
+func describeUnit(unit units.Dimension) string {
+	if unit.Dimensionless() {
+		return "dimensionless"
+	}
+	return unit.String()
+}
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseAST_Units(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"3 m / 2 s", "(3m)/(2s)"},
+		{"5 kg * 9.81 m/s^2", "(5kg)*(9.81m)/(1s)^2"},
+		{"2km^2", "(2000000m^2)"},
+		{"-3km", "(-3000m)"},
+		{"90min", "(5400s)"},
+		{"(5kg*m/s^2)", "(5kg)*(1m)/(1s)^2"},
+		{"3/s", "3/(1s)"},
+	}
+	for _, test := range tests {
+		ast, err := ParseAST(test.input)
+		if err != nil {
+			t.Errorf("ParseAST(%q): unexpected error %v", test.input, err)
+			continue
+		}
+		if got := ast.String(); got != test.expected {
+			t.Errorf("ParseAST(%q).String() = %q, want %q", test.input, got, test.expected)
+		}
+		if reparsed, err := ParseAST(ast.String()); err != nil || reparsed.String() != ast.String() {
+			t.Errorf("ParseAST(%q) does not survive a round trip: %v", ast.String(), err)
+		}
+	}
+
+	for _, input := range []string{"3 parsecs", "2in", "[1m,2]"} {
+		if _, err := ParseAST(input); err == nil {
+			t.Errorf("ParseAST(%q): expected an error", input)
+		}
+	}
+}
+
+func TestUnitOf(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{"3 m / 2 s", "m/s", ""},
+		{"5 kg * 9.81 m/s^2", "kg*m/s^2", ""},
+		{"2 N * 3 m", "kg*m^2/s^2", ""},
+		{"1 km + 500 m", "m", ""},
+		{"sqrt(4 m^2)", "m", ""},
+		{"2/s*3s", "", ""},
+		{"sin(2)*3 A", "A", ""},
+		{"m + s", "", "cannot add m and s"},
+		{"3m - 2", "", "cannot subtract m and dimensionless"},
+		{"sqrt(2m)", "", "cannot take the square root of m"},
+		{"sin(1m)", "", "sin expects dimensionless operands, got m"},
+		{"2^(1s)", "", "^ expects dimensionless operands, got s"},
+		{"m^(1/2)", "", "exponent of m must be an integer constant"},
+	}
+	for _, test := range tests {
+		ast, err := ParseAST(test.input)
+		if err != nil {
+			t.Errorf("ParseAST(%q): unexpected error %v", test.input, err)
+			continue
+		}
+		unit, err := unitOf(ast)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("unitOf(%q): expected error %q, got %v", test.input, test.err, err)
+			}
+			continue
+		}
+		if err != nil || unit.String() != test.expected {
+			t.Errorf("unitOf(%q) = %q, %v, want %q", test.input, unit, err, test.expected)
+		}
+	}
+}
+
+func TestHandleCalculateRequest_Units(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/api/v1/calculate", orchestrator.handleCalculateRequest)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", "/api/v1/calculate", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	if recorder := post(`{"expression": "m + s"}`); recorder.Code != http.StatusUnprocessableEntity || recorder.Body.String() != `{"error":"Incompatible units: cannot add m and s"}` {
+		t.Errorf("Expected m + s to be rejected, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := post(`{"expression": "3 m / 2 s"}`); recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	expr := orchestrator.expressionStore["1"]
+	if expr.Unit != "m/s" {
+		t.Errorf("Expected unit m/s, got %q", expr.Unit)
+	}
+
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+	task := orchestrator.taskQueue.PopFront().(*Task)
+	if task.Operation != "/" || task.Arg1 != 3 || task.Arg2 != 2 {
+		t.Fatalf("Unexpected task %+v", task)
+	}
+	if recorder := postResult(t, router, `{"id":"`+task.ID+`","result":1.5}`); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if expr.Status != "completed" || *expr.Result != 1.5 {
+		t.Errorf("Expected 1.5 m/s, got %+v", expr)
+	}
+}
+
+func TestScheduleTasks_UnitsVerification(t *testing.T) {
+	orchestrator := NewOrchestrator()
+	router := gin.Default()
+	router.POST("/internal/task", orchestrator.handlePostTaskRequest)
+
+	expr := submitExpression(t, orchestrator, "1", "5 kg * 9.81 m/s^2 + 1 km/min * 3 kg/s")
+	runMatrixTasks(t, orchestrator, router)
+	if expr.Status != "completed" || expr.Result == nil || *expr.Result-99.05 > 1e-12 || 99.05-*expr.Result > 1e-12 {
+		t.Errorf("Expected 99.05, got %+v", expr)
+	}
+}
@@ -0,0 +1,223 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"Yandex_Calc_V2.0/internal/app"
+)
+
+const (
+	DEFAULT_URL           = "http://localhost:8080"
+	DEFAULT_POLL_INTERVAL = 500 * time.Millisecond
+	USER_AGENT            = "calcctl"
+)
+
+// Client calls the calculator API. Token, when set, is sent as a bearer
+// token for deployments behind an authenticating proxy; User is sent in the
+// X-User-ID header the orchestrator uses to scope functions and imports.
+type Client struct {
+	BaseURL string
+	Token   string
+	User    string
+	HTTP    *http.Client
+}
+
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/"), HTTP: http.DefaultClient}
+}
+
+// APIError is a response with an error status. Errors holds the parse errors
+// of an invalid expression.
+type APIError struct {
+	Status  int
+	Message string
+	Errors  []*app.ParseError
+}
+
+func (e *APIError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("%s (HTTP %d)", e.Message, e.Status)
+	}
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = fmt.Sprintf("column %d: %s", err.Column, err.Message)
+	}
+	return fmt.Sprintf("%s: %s (HTTP %d)", e.Message, strings.Join(messages, "; "), e.Status)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", USER_AGENT)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if c.User != "" {
+		req.Header.Set(app.USER_HEADER, c.User)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		var failure app.ParseErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&failure); err != nil || failure.Error == "" {
+			failure.Error = http.StatusText(resp.StatusCode)
+		}
+		return &APIError{Status: resp.StatusCode, Message: failure.Error, Errors: failure.Errors}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Submit starts the calculation of the expression and returns its ID.
+func (c *Client) Submit(ctx context.Context, req app.ExpressionRequest) (string, error) {
+	var resp app.ExpressionResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/calculate", req, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (c *Client) Get(ctx context.Context, id string) (*app.Expression, error) {
+	var resp struct {
+		Expression *app.Expression `json:"expression"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/v1/expressions/"+url.PathEscape(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Expression, nil
+}
+
+// ListOptions are the filters of GET /api/v1/expressions; empty fields are
+// not sent.
+type ListOptions struct {
+	Status      string
+	Contains    string
+	CreatedFrom string
+	CreatedTo   string
+	Sort        string
+	Order       string
+	Limit       int
+	Cursor      string
+}
+
+func (l ListOptions) query() string {
+	values := url.Values{}
+	for name, value := range map[string]string{
+		"status":       l.Status,
+		"q":            l.Contains,
+		"created_from": l.CreatedFrom,
+		"created_to":   l.CreatedTo,
+		"sort":         l.Sort,
+		"order":        l.Order,
+		"cursor":       l.Cursor,
+	} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	if l.Limit > 0 {
+		values.Set("limit", strconv.Itoa(l.Limit))
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return "?" + values.Encode()
+}
+
+// Page is a page of GET /api/v1/expressions.
+type Page struct {
+	Expressions []*app.Expression `json:"expressions"`
+	NextCursor  string            `json:"next_cursor,omitempty"`
+	Total       int               `json:"total"`
+}
+
+func (c *Client) List(ctx context.Context, options ListOptions) (*Page, error) {
+	var page Page
+	if err := c.do(ctx, http.MethodGet, "/api/v1/expressions"+options.query(), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// Cancel cancels an in-flight expression; purge also removes it from the
+// store.
+func (c *Client) Cancel(ctx context.Context, id string, purge bool) error {
+	path := "/api/v1/expressions/" + url.PathEscape(id)
+	if purge {
+		path += "?purge=true"
+	}
+	return c.do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+func (c *Client) Agents(ctx context.Context) (*app.AgentsResponse, error) {
+	var resp app.AgentsResponse
+	if err := c.do(ctx, http.MethodGet, "/admin/agents", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Finished reports whether the expression is completed, failed or
+// cancelled.
+func Finished(expr *app.Expression) bool {
+	return expr.Status == "completed" || expr.Status == "failed" || expr.Status == "cancelled"
+}
+
+// Wait polls the expression every interval until it is finished, calling
+// progress after every poll. On error the last polled state is returned.
+func (c *Client) Wait(ctx context.Context, id string, interval time.Duration, progress func(*app.Expression)) (*app.Expression, error) {
+	if interval <= 0 {
+		interval = DEFAULT_POLL_INTERVAL
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last *app.Expression
+	for {
+		expr, err := c.Get(ctx, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return last, err
+		}
+		last = expr
+		if progress != nil {
+			progress(expr)
+		}
+		if Finished(expr) {
+			return expr, nil
+		}
+		select {
+		case <-ctx.Done():
+			return expr, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Yandex_Calc_V2.0/internal/app"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.ReleaseMode)
+}
+
+func newServer(t *testing.T) *Client {
+	t.Helper()
+	server := httptest.NewServer(app.NewOrchestrator().Router())
+	t.Cleanup(server.Close)
+	return New(server.URL + "/")
+}
+
+func TestClient_SubmitGetList(t *testing.T) {
+	c := newServer(t)
+	ctx := context.Background()
+
+	ids := make([]string, 0, 3)
+	for _, expression := range []string{"5", "2+3", "2*3"} {
+		id, err := c.Submit(ctx, app.ExpressionRequest{Expression: expression})
+		if err != nil {
+			t.Fatalf("Submit(%q): %v", expression, err)
+		}
+		ids = append(ids, id)
+	}
+	expr, err := c.Get(ctx, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expr.Status != "completed" || expr.Result == nil || *expr.Result != 5 {
+		t.Errorf("Expected 5, got %+v", expr)
+	}
+
+	page, err := c.List(ctx, ListOptions{Status: "pending", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || len(page.Expressions) != 1 || page.Expressions[0].ID != ids[1] || page.NextCursor == "" {
+		t.Errorf("Unexpected page %+v", page)
+	}
+	page, err = c.List(ctx, ListOptions{Status: "pending", Limit: 1, Cursor: page.NextCursor})
+	if err != nil || len(page.Expressions) != 1 || page.Expressions[0].ID != ids[2] {
+		t.Errorf("Unexpected second page %+v, %v", page, err)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	c := newServer(t)
+	ctx := context.Background()
+
+	_, err := c.Submit(ctx, app.ExpressionRequest{Expression: "2+"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnprocessableEntity || len(apiErr.Errors) != 1 {
+		t.Fatalf("Expected a parse error, got %v", err)
+	}
+	if expected := "Invalid expression: column 3: unexpected end of expression (HTTP 422)"; err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+	if _, err := c.Get(ctx, "42"); err == nil || err.Error() != "Expression not found (HTTP 404)" {
+		t.Errorf("Expected not found, got %v", err)
+	}
+	if err := c.Cancel(ctx, "42", false); !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound {
+		t.Errorf("Expected not found, got %v", err)
+	}
+	if _, err := New("http://127.0.0.1:1").Get(ctx, "1"); err == nil {
+		t.Error("Expected a connection error")
+	}
+}
+
+func TestClient_CancelAndWait(t *testing.T) {
+	c := newServer(t)
+	ctx := context.Background()
+
+	id, err := c.Submit(ctx, app.ExpressionRequest{Expression: "2+3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	polls := 0
+	expr, err := c.Wait(waitCtx, id, 10*time.Millisecond, func(*app.Expression) { polls++ })
+	if !errors.Is(err, context.DeadlineExceeded) || expr.Status != "pending" || polls < 2 {
+		t.Errorf("Expected a timeout while pending after several polls, got %+v, %v, %d polls", expr, err, polls)
+	}
+
+	if err := c.Cancel(ctx, id, false); err != nil {
+		t.Fatal(err)
+	}
+	expr, err = c.Wait(ctx, id, 10*time.Millisecond, nil)
+	if err != nil || expr.Status != "cancelled" || !Finished(expr) {
+		t.Errorf("Expected a cancelled expression, got %+v, %v", expr, err)
+	}
+	if err := c.Cancel(ctx, id, true); err != nil {
+		t.Errorf("Expected the expression to be purged, got %v", err)
+	}
+}
+
+func TestClient_Headers(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.Write([]byte(`{"agents":[{"id":"host-1","capabilities":["sqrt"],"live":true}],"unroutable":[]}`))
+	}))
+	defer server.Close()
+	c := NewFromConfig(Config{URL: server.URL, Token: "secret", User: "alice"})
+
+	resp, err := c.Agents(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Agents) != 1 || resp.Agents[0].ID != "host-1" || !resp.Agents[0].Live {
+		t.Errorf("Unexpected agents %+v", resp)
+	}
+	if header.Get("Authorization") != "Bearer secret" || header.Get(app.USER_HEADER) != "alice" || header.Get("User-Agent") != USER_AGENT {
+		t.Errorf("Unexpected headers %v", header)
+	}
+}
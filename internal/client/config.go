@@ -0,0 +1,72 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	ENV_CONFIG = "CALCCTL_CONFIG"
+	ENV_URL    = "CALCCTL_URL"
+	ENV_TOKEN  = "CALCCTL_TOKEN"
+	ENV_USER   = "CALCCTL_USER"
+)
+
+// Config is the connection settings of calcctl. They are read from a JSON
+// file and overridden by the environment.
+type Config struct {
+	URL   string `json:"url"`
+	Token string `json:"token,omitempty"`
+	User  string `json:"user,omitempty"`
+}
+
+// ConfigPath returns $CALCCTL_CONFIG or calcctl/config.json in the user
+// configuration directory.
+func ConfigPath(getenv func(string) string) string {
+	if path := getenv(ENV_CONFIG); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "calcctl", "config.json")
+}
+
+// LoadConfig reads the file, which may be missing, and applies the
+// environment on top of it.
+func LoadConfig(path string, getenv func(string) string) (Config, error) {
+	config := Config{URL: DEFAULT_URL}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return config, err
+		default:
+			if err := json.Unmarshal(data, &config); err != nil {
+				return config, fmt.Errorf("invalid config %s: %v", path, err)
+			}
+		}
+	}
+	for env, field := range map[string]*string{ENV_URL: &config.URL, ENV_TOKEN: &config.Token, ENV_USER: &config.User} {
+		if value := getenv(env); value != "" {
+			*field = value
+		}
+	}
+	if config.URL == "" {
+		config.URL = DEFAULT_URL
+	}
+	return config, nil
+}
+
+// NewFromConfig returns a client with the settings of the configuration.
+func NewFromConfig(config Config) *Client {
+	c := New(config.URL)
+	c.Token, c.User = config.Token, config.User
+	return c
+}
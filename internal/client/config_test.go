@@ -0,0 +1,47 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func env(values map[string]string) func(string) string {
+	return func(name string) string {
+		return values[name]
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"url":"http://calc:8080","token":"file-token"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path     string
+		env      map[string]string
+		expected Config
+	}{
+		{"", nil, Config{URL: DEFAULT_URL}},
+		{filepath.Join(t.TempDir(), "missing.json"), nil, Config{URL: DEFAULT_URL}},
+		{path, nil, Config{URL: "http://calc:8080", Token: "file-token"}},
+		{path, map[string]string{ENV_TOKEN: "env-token", ENV_USER: "bob"}, Config{URL: "http://calc:8080", Token: "env-token", User: "bob"}},
+		{"", map[string]string{ENV_URL: "http://other"}, Config{URL: "http://other"}},
+	}
+	for _, test := range tests {
+		config, err := LoadConfig(test.path, env(test.env))
+		if err != nil || config != test.expected {
+			t.Errorf("LoadConfig(%q, %v) = %+v, %v, want %+v", test.path, test.env, config, err, test.expected)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(`{"url":`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path, env(nil)); err == nil {
+		t.Error("Expected an invalid config error")
+	}
+	if got := ConfigPath(env(map[string]string{ENV_CONFIG: path})); got != path {
+		t.Errorf("ConfigPath() = %q, want %q", got, path)
+	}
+}
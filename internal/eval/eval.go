@@ -1,38 +1,36 @@
 package eval
 
 import (
+	"Yandex_Calc_V2.0/internal/ops"
 	"Yandex_Calc_V2.0/internal/stack"
 	"errors"
 	"fmt"
 	"math"
 	"math/big"
-	"regexp"
 	"strconv"
-	"strings"
 )
 
-var fp_rx = regexp.MustCompile(`(\d+(?:\.\d+)?)`)
-var functions_rx = regexp.MustCompile(`(sin|cos|tan|ln|arcsin|arccos|arctan|sqrt)`)
-var symbols_rx *regexp.Regexp
-var unary_minus_rx = regexp.MustCompile(`((?:^|[-+^%*/<>!=(])\s*)-`)
-var whitespace_rx = regexp.MustCompile(`\s+`)
-
 var ErrInvalidExpression = errors.New("invalid expression")
 
-var symbolTable map[string]string
+var ErrDivisionByZero = errors.New("division by zero is not allowed")
 
-var operators = []string{"-", "+", "*", "/", "<", ">", "@", "^", "**", "%", "!=", "==", ">=", "<="}
+// NEGATE is the unary minus in postfix notation.
+const NEGATE = "@"
 
 func prec(op string) (result int) {
-	if op == "-" || op == "+" {
+	if op == THEN_MARKER || op == END_MARKER {
+		result = math.MinInt
+	} else if op == "-" || op == "+" {
 		result = 1
 	} else if op == "*" || op == "/" {
 		result = 2
 	} else if op == "^" || op == "%" || op == "**" {
 		result = 3
-	} else if op == "@" {
+	} else if infix, ok := ops.LookupKind(op, ops.Infix); ok {
+		result = infix.Precedence
+	} else if op == NEGATE {
 		result = 4
-	} else if functions_rx.MatchString(op) {
+	} else if isFunction(op) {
 		result = 5
 	} else {
 		result = 0
@@ -40,280 +38,620 @@ func prec(op string) (result int) {
 	return
 }
 
+// opGTE reports whether op1 on the stack is applied before op2 is pushed.
 func opGTE(op1, op2 string) bool {
+	if infix, ok := ops.LookupKind(op2, ops.Infix); ok && infix.Associativity == ops.RightAssociative {
+		return prec(op1) > prec(op2)
+	}
 	return prec(op1) >= prec(op2)
 }
 
 func isFunction(token string) bool {
-	return functions_rx.MatchString(token)
+	_, ok := ops.LookupFunction(token)
+	return ok
 }
 
 func isOperator(token string) bool {
-	for _, v := range operators {
-		if v == token {
-			return true
-		}
+	if _, ok := ops.LookupKind(token, ops.Infix); ok {
+		return true
 	}
-	return false
+	return token == "**" || token == "%"
 }
 
-func isOperand(token string) bool {
-	return fp_rx.MatchString(token)
+// Markers of lazy operators in postfix notation. The operand after a marker
+// is skipped when the value before it decides the result: a && b becomes
+// a &&? b &&, and c ? a : b becomes c ? a : b ?:.
+const (
+	AND_MARKER  = "&&?"
+	OR_MARKER   = "||?"
+	THEN_MARKER = "?"
+	ELSE_MARKER = ":"
+	END_MARKER  = "?:"
+)
+
+var shortCircuitMarkers = map[string]string{"&&": AND_MARKER, "||": OR_MARKER}
+
+func marker(text string, at Token) Token {
+	return Token{Kind: Marker, Text: text, Start: at.Start, End: at.End}
 }
 
-func isSymbol(token string) bool {
-	for k := range symbolTable {
-		if k == token {
-			return true
+// skipOperand returns the index of target after the marker at i, skipping
+// nested lazy operators that open with open and close with closing.
+func skipOperand(postfix []Token, i int, open, closing, target string) (int, error) {
+	depth := 0
+	for j := i + 1; j < len(postfix); j++ {
+		switch text := postfix[j].Text; {
+		case depth == 0 && text == target:
+			return j, nil
+		case text == open:
+			depth++
+		case text == closing:
+			depth--
 		}
 	}
-	return false
+	return 0, syntaxError(postfix[i].Start, "unterminated %s", postfix[i].Text)
 }
 
-func convert2postfix(tokens []string) []string {
-	var st stack.Stack
-	var result []string
-	for _, token := range tokens {
-
-		stackString := fmt.Sprint(st)
-		stackString += ""
+// jump handles the marker at postfix[i] given the truth of the value on top
+// of the stack. It returns the index of the last token processed, whether
+// the value is popped, and, when a short-circuit operand is skipped, the
+// value that replaces it.
+func jump(postfix []Token, i int, truthy bool) (next int, pop bool, decided *big.Rat, err error) {
+	switch token := postfix[i].Text; token {
+	case AND_MARKER, OR_MARKER:
+		operator := token[:2]
+		if truthy != (token == OR_MARKER) {
+			return i, false, nil, nil
+		}
+		next, err = skipOperand(postfix, i, token, operator, operator)
+		decided = new(big.Rat)
+		if truthy {
+			decided.SetInt64(1)
+		}
+		return next, true, decided, err
+	case THEN_MARKER:
+		if truthy {
+			return i, true, nil, nil
+		}
+		next, err = skipOperand(postfix, i, THEN_MARKER, END_MARKER, ELSE_MARKER)
+		return next, true, nil, err
+	case ELSE_MARKER:
+		next, err = skipOperand(postfix, i, THEN_MARKER, END_MARKER, END_MARKER)
+		return next, false, nil, err
+	}
+	return i, false, nil, nil
+}
 
-		if isOperator(token) {
-		OPERATOR:
-			for {
-				top, err := st.Top()
-				if err == nil && top != "(" {
-					if opGTE(top.(string), token) {
-						pop, _ := st.Pop()
-						result = append(result, pop.(string))
-						continue
-					} else {
-						break OPERATOR
-					}
+// IF is the function form of the conditional: if(c,a,b) is c ? a : b.
+const IF = "if"
+
+// expandConditionals rewrites if(c,a,b) into ((c)?(a):(b)).
+func expandConditionals(tokens []Token) ([]Token, error) {
+	result := make([]Token, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		call := tokens[i]
+		if call.Kind != Identifier || call.Text != IF || i+1 >= len(tokens) || tokens[i+1].Kind != LeftParen {
+			result = append(result, call)
+			continue
+		}
+		var args [][]Token
+		var separators []Token
+		depth, start := 0, i+2
+		for j := i + 1; ; j++ {
+			if j >= len(tokens) {
+				return nil, syntaxError(call.Start, "missing ) of %s", IF)
+			}
+			switch tokens[j].Kind {
+			case LeftParen:
+				depth++
+			case RightParen:
+				depth--
+			}
+			if depth == 1 && tokens[j].Kind == Comma || depth == 0 {
+				arg, err := expandConditionals(tokens[start:j])
+				if err != nil {
+					return nil, err
 				}
-				break OPERATOR
+				args = append(args, arg)
+				separators = append(separators, tokens[j])
+				start = j + 1
 			}
-			st.Push(token)
+			if depth == 0 {
+				i = j
+				break
+			}
+		}
+		if len(args) != 3 {
+			return nil, syntaxError(call.Start, "%s expects 3 arguments, got %d", IF, len(args))
+		}
+		open := Token{Kind: LeftParen, Text: "(", Start: call.Start, End: call.End}
+		closing := Token{Kind: RightParen, Text: ")", Start: separators[2].Start, End: separators[2].End}
+		result = append(result, open, open)
+		result = append(result, args[0]...)
+		result = append(result, closing, Token{Kind: Question, Text: THEN_MARKER, Start: separators[0].Start, End: separators[0].End}, open)
+		result = append(result, args[1]...)
+		result = append(result, closing, Token{Kind: Colon, Text: ELSE_MARKER, Start: separators[1].Start, End: separators[1].End}, open)
+		result = append(result, args[2]...)
+		result = append(result, closing, closing)
+	}
+	return result, nil
+}
 
-		} else if isFunction(token) {
-		FUNCTION:
-			for {
-				top, err := st.Top()
-				if err == nil && top != "(" {
-					if opGTE(top.(string), token) {
-						pop, _ := st.Pop()
-						result = append(result, pop.(string))
-					}
-				} else {
-					break FUNCTION
-				}
-				break FUNCTION
+// ARITY_SEPARATOR joins the name of a call and its number of arguments when
+// a postfix token is printed: min(1,2,3) becomes 1 2 3 min#3.
+const ARITY_SEPARATOR = "#"
+
+// group is an open parenthesis of convert2postfix.
+type group struct {
+	// call is the function the parentheses belong to, if any.
+	call *Token
+	// commas counts the separators of the arguments.
+	commas int
+}
+
+// Options select the notation of an expression.
+type Options struct {
+	// Natural notation allows implicit multiplication, as in 2pi, 3(4+5) and
+	// (1+2)(3+4), and the postfix factorial 5!.
+	Natural bool
+}
+
+// convert2postfix converts the tokens to postfix notation with the
+// shunting-yard algorithm, checking that operands and operators alternate.
+func convert2postfix(tokens []Token, options Options) ([]Token, error) {
+	tokens, err := expandConditionals(tokens)
+	if err != nil {
+		return nil, err
+	}
+	var st stack.Stack
+	var result []Token
+	var groups []*group
+	// operand is set while an operand is expected, negated right after a
+	// unary minus, which may not be repeated.
+	operand, negated := true, false
+	// unwind moves operators to the output until stop holds for the top of
+	// the stack; a ? without its : is incomplete.
+	unwind := func(stop func(Token) bool) error {
+		for st.Len() > 0 {
+			top, _ := st.Top()
+			if stop(top.(Token)) {
+				return nil
 			}
-			st.Push(token)
+			st.Pop()
+			if top.(Token).Text == THEN_MARKER {
+				return syntaxError(top.(Token).Start, "missing : after ?")
+			}
+			result = append(result, top.(Token))
+		}
+		return nil
+	}
+	isOpen := func(token Token) bool { return token.Kind == LeftParen }
+	infix := func(token Token) error {
+		err := unwind(func(top Token) bool { return isOpen(top) || !opGTE(top.Text, token.Text) })
+		if err != nil {
+			return err
+		}
+		st.Push(token)
+		if text, ok := shortCircuitMarkers[token.Text]; ok {
+			result = append(result, marker(text, token))
+		}
+		operand = true
+		return nil
+	}
+	for i, token := range tokens {
+		if !operand && options.Natural && (token.Kind == Number || token.Kind == Identifier || token.Kind == LeftParen) {
+			// Implicit multiplication binds like *.
+			if err := infix(Token{Kind: Operator, Text: "*", Start: token.Start, End: token.Start}); err != nil {
+				return nil, err
+			}
+		}
+		if operand && token.Kind != Operator && token.Kind != Number && token.Kind != Identifier && token.Kind != LeftParen {
+			if token.Kind != RightParen || i == 0 || tokens[i-1].Kind != LeftParen || groups[len(groups)-1].call == nil {
+				return nil, syntaxError(token.Start, "unexpected %s", token.Text)
+			}
+		}
+		if !operand && (token.Kind == Number || token.Kind == Identifier || token.Kind == LeftParen) {
+			return nil, syntaxError(token.Start, "unexpected %s", token.Text)
+		}
+		wasNegated := negated
+		negated = false
+		switch token.Kind {
+		case Number:
+			result = append(result, token)
+			operand = false
 
-		} else if token == "(" {
+		case Identifier:
+			if !isFunction(token.Text) {
+				return nil, syntaxError(token.Start, "unknown identifier %s", token.Text)
+			}
+			if i+1 >= len(tokens) || tokens[i+1].Kind != LeftParen {
+				return nil, syntaxError(token.End, "expected ( after %s", token.Text)
+			}
+			token.Kind = Call
 			st.Push(token)
 
-		} else if token == ")" {
-		PAREN:
-			for {
-				top, err := st.Top()
-				if err == nil && top != "(" {
-					pop, _ := st.Pop()
-					result = append(result, pop.(string))
-				} else {
-					st.Pop()
-					break PAREN
+		case Operator:
+			switch {
+			case operand && token.Text == "-" && !wasNegated:
+				token.Text = NEGATE
+				st.Push(token)
+				negated = true
+			case operand && isFunction(token.Text):
+				// A prefix operator like !, applied to the operand that
+				// follows.
+				token.Kind = Call
+				token.Arity = 1
+				st.Push(token)
+			case !operand && options.Natural && token.Text == "!":
+				// The postfix factorial binds tighter than any operator, so
+				// it applies to the operand just written out.
+				result = append(result, Token{Kind: Call, Text: ops.FACTORIAL, Start: token.Start, End: token.End, Arity: 1})
+			case operand || !isOperator(token.Text):
+				return nil, syntaxError(token.Start, "unexpected %s", token.Text)
+			default:
+				if err := infix(token); err != nil {
+					return nil, err
 				}
 			}
 
-		} else if isOperand(token) {
-			result = append(result, token)
+		case Question:
+			err := unwind(func(top Token) bool {
+				return isOpen(top) || top.Text == THEN_MARKER || top.Text == END_MARKER
+			})
+			if err != nil {
+				return nil, err
+			}
+			st.Push(marker(THEN_MARKER, token))
+			result = append(result, marker(THEN_MARKER, token))
+			operand = true
+
+		case Colon:
+			err := unwind(func(top Token) bool { return isOpen(top) || top.Text == THEN_MARKER })
+			if err != nil {
+				return nil, err
+			}
+			if top, err := st.Top(); err != nil || top.(Token).Text != THEN_MARKER {
+				return nil, syntaxError(token.Start, "unexpected : without ?")
+			}
+			st.Pop()
+			st.Push(marker(END_MARKER, token))
+			result = append(result, marker(ELSE_MARKER, token))
+			operand = true
+
+		case LeftParen:
+			g := &group{}
+			if i > 0 && tokens[i-1].Kind == Identifier {
+				call, _ := st.Top()
+				g.call = new(Token)
+				*g.call = call.(Token)
+			}
+			groups = append(groups, g)
+			st.Push(token)
 
-		} else if isSymbol(token) {
-			result = append(result, symbolTable[token])
+		case Comma:
+			if len(groups) == 0 || groups[len(groups)-1].call == nil {
+				return nil, syntaxError(token.Start, "unexpected ,")
+			}
+			if err := unwind(isOpen); err != nil {
+				return nil, err
+			}
+			groups[len(groups)-1].commas++
+			operand = true
 
-		} else {
-			result = append(result, token)
+		case RightParen:
+			if len(groups) == 0 {
+				return nil, syntaxError(token.Start, "unexpected )")
+			}
+			if err := unwind(isOpen); err != nil {
+				return nil, err
+			}
+			st.Pop()
+			g := groups[len(groups)-1]
+			groups = groups[:len(groups)-1]
+			if g.call != nil {
+				st.Pop()
+				call := *g.call
+				call.End = token.End
+				if !operand {
+					call.Arity = g.commas + 1
+				}
+				result = append(result, call)
+			}
+			operand = false
 		}
+	}
+	if operand {
+		return nil, syntaxError(endOffset(tokens), "unexpected end of expression")
+	}
+	if len(groups) > 0 {
+		return nil, syntaxError(endOffset(tokens), "missing )")
+	}
+	if err := unwind(func(Token) bool { return false }); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
 
+func endOffset(tokens []Token) int {
+	if len(tokens) == 0 {
+		return 0
 	}
+	return tokens[len(tokens)-1].End
+}
 
-	for !st.IsEmpty() {
-		pop, _ := st.Pop()
-		result = append(result, pop.(string))
+// ratFromFloat converts the result of a float operation; infinities and NaN
+// have no rational value.
+func ratFromFloat(x float64) (*big.Rat, error) {
+	if math.IsInf(x, 0) || math.IsNaN(x) {
+		return nil, ops.ErrUndefined
 	}
+	return new(big.Rat).SetFloat64(x), nil
+}
 
-	return result
+func compare(op string, cmp int) bool {
+	switch op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "==":
+		return cmp == 0
+	}
+	return cmp != 0
 }
 
-func evaluatePostfix(postfix []string) (*big.Rat, error) {
+func evaluatePostfix(postfix []Token) (*big.Rat, error) {
 	var st stack.Stack
-	result := new(big.Rat)
-	for _, token := range postfix {
-
-		stackString := fmt.Sprint(st)
-		stackString += ""
-
-		if isOperand(token) {
-			bigrat := new(big.Rat)
-			if _, err := fmt.Sscan(token, bigrat); err != nil {
-				return nil, fmt.Errorf("unable to scan %s", token)
+	pop := func(n int) ([]*big.Rat, error) {
+		if st.Len() < n {
+			return nil, ErrInvalidExpression
+		}
+		args := make([]*big.Rat, n)
+		for i := n - 1; i >= 0; i-- {
+			value, _ := st.Pop()
+			args[i] = value.(*big.Rat)
+		}
+		return args, nil
+	}
+	floats := func(args []*big.Rat) []float64 {
+		values := make([]float64, len(args))
+		for i, arg := range args {
+			values[i] = BigratToFloat(arg)
+		}
+		return values
+	}
+	for i := 0; i < len(postfix); i++ {
+		token := postfix[i]
+		switch token.Kind {
+		case Number:
+			if token.Imag {
+				return nil, ErrInvalidExpression
 			}
-			st.Push(bigrat)
-
-		} else if isOperator(token) {
+			st.Push(token.Value)
 
-			op2, err2 := st.Pop()
-			if err2 != nil {
-				return nil, err2
+		case Marker:
+			truthy := false
+			if token.Text != ELSE_MARKER && token.Text != END_MARKER {
+				top, err := st.Top()
+				if err != nil {
+					return nil, ErrInvalidExpression
+				}
+				truthy = top.(*big.Rat).Sign() != 0
+			}
+			next, drop, decided, err := jump(postfix, i, truthy)
+			if err != nil {
+				return nil, err
 			}
+			if drop {
+				st.Pop()
+			}
+			if decided != nil {
+				st.Push(decided)
+			}
+			i = next
 
-			var op1 interface{}
-			if token != "@" {
-				var err1 error
-				if op1, err1 = st.Pop(); err1 != nil {
-					return nil, err1
-				}
+		case Call:
+			args, err := pop(token.Arity)
+			if err != nil {
+				return nil, err
 			}
+			value, err := ops.Apply(token.Text, floats(args)...)
+			if err != nil {
+				return nil, err
+			}
+			result, err := ratFromFloat(value)
+			if err != nil {
+				return nil, err
+			}
+			st.Push(result)
 
-			dummy := new(big.Rat)
-			switch token {
-			case "**", "^":
-				float1 := BigratToFloat(op1.(*big.Rat))
-				float2 := BigratToFloat(op2.(*big.Rat))
-				float_result := math.Pow(float1, float2)
-				st.Push(FloatToBigrat(float_result))
-			case "%":
-				float1 := BigratToFloat(op1.(*big.Rat))
-				float2 := BigratToFloat(op2.(*big.Rat))
-				float_result := math.Mod(float1, float2)
-				st.Push(FloatToBigrat(float_result))
-			case "*":
-				result := dummy.Mul(op1.(*big.Rat), op2.(*big.Rat))
-				st.Push(result)
-			case "/":
-				result := dummy.Quo(op1.(*big.Rat), op2.(*big.Rat))
-				st.Push(result)
+		case Operator:
+			arity := 2
+			if token.Text == NEGATE {
+				arity = 1
+			}
+			args, err := pop(arity)
+			if err != nil {
+				return nil, err
+			}
+			result := new(big.Rat)
+			switch token.Text {
+			case NEGATE:
+				result.Neg(args[0])
 			case "+":
-				result = dummy.Add(op1.(*big.Rat), op2.(*big.Rat))
-				st.Push(result)
+				result.Add(args[0], args[1])
 			case "-":
-				result = dummy.Sub(op1.(*big.Rat), op2.(*big.Rat))
-				st.Push(result)
-			case "<":
-				if op1.(*big.Rat).Cmp(op2.(*big.Rat)) <= -1 {
-					st.Push(big.NewRat(1, 1))
-				} else {
-					st.Push(new(big.Rat))
-				}
-			case "<=":
-				if op1.(*big.Rat).Cmp(op2.(*big.Rat)) <= 0 {
-					st.Push(big.NewRat(1, 1))
-				} else {
-					st.Push(new(big.Rat))
-				}
-			case ">":
-				if op1.(*big.Rat).Cmp(op2.(*big.Rat)) >= 1 {
-					st.Push(big.NewRat(1, 1))
-				} else {
-					st.Push(new(big.Rat))
+				result.Sub(args[0], args[1])
+			case "*":
+				result.Mul(args[0], args[1])
+			case "/":
+				if args[1].Sign() == 0 {
+					return nil, ErrDivisionByZero
 				}
-			case ">=":
-				if op1.(*big.Rat).Cmp(op2.(*big.Rat)) >= 0 {
-					st.Push(big.NewRat(1, 1))
-				} else {
-					st.Push(new(big.Rat))
+				result.Quo(args[0], args[1])
+			case "<", "<=", ">", ">=", "==", "!=":
+				if compare(token.Text, args[0].Cmp(args[1])) {
+					result.SetInt64(1)
 				}
-			case "==":
-				if op1.(*big.Rat).Cmp(op2.(*big.Rat)) == 0 {
-					st.Push(big.NewRat(1, 1))
-				} else {
-					st.Push(new(big.Rat))
+			default:
+				values := floats(args)
+				var value float64
+				switch token.Text {
+				case "**", "^":
+					value = math.Pow(values[0], values[1])
+				case "%":
+					value = math.Mod(values[0], values[1])
+				default:
+					if value, err = ops.Apply(token.Text, values...); err != nil {
+						return nil, err
+					}
 				}
-			case "!=":
-				if op1.(*big.Rat).Cmp(op2.(*big.Rat)) == 0 {
-					st.Push(new(big.Rat))
-				} else {
-					st.Push(big.NewRat(1, 1))
+				if result, err = ratFromFloat(value); err != nil {
+					return nil, err
 				}
-			case "@":
-				result := dummy.Mul(big.NewRat(-1, 1), op2.(*big.Rat))
-				st.Push(result)
-			}
-		} else if isFunction(token) {
-			op2, err := st.Pop()
-			if err != nil {
-				return nil, err
 			}
-			switch token {
-			case "sin":
-				float_result := BigratToFloat(op2.(*big.Rat))
-				st.Push(FloatToBigrat(math.Sin(float_result)))
-			case "cos":
-				float_result := BigratToFloat(op2.(*big.Rat))
-				st.Push(FloatToBigrat(math.Cos(float_result)))
-			case "tan":
-				float_result := BigratToFloat(op2.(*big.Rat))
-				st.Push(FloatToBigrat(math.Tan(float_result)))
-			case "arcsin":
-				float_result := BigratToFloat(op2.(*big.Rat))
-				st.Push(FloatToBigrat(math.Asin(float_result)))
-			case "arccos":
-				float_result := BigratToFloat(op2.(*big.Rat))
-				st.Push(FloatToBigrat(math.Acos(float_result)))
-			case "arctan":
-				float_result := BigratToFloat(op2.(*big.Rat))
-				st.Push(FloatToBigrat(math.Atan(float_result)))
-			case "ln":
-				float_result := BigratToFloat(op2.(*big.Rat))
-				st.Push(FloatToBigrat(math.Log(float_result)))
-			case "sqrt":
-				float_result := BigratToFloat(op2.(*big.Rat))
-				st.Push(FloatToBigrat(math.Sqrt(float_result)))
-			}
-		} else {
+			st.Push(result)
+
+		default:
 			return nil, ErrInvalidExpression
 		}
 	}
+	if st.Len() != 1 {
+		return nil, ErrInvalidExpression
+	}
+	retval, _ := st.Pop()
+	return retval.(*big.Rat), nil
+}
+
+func Eval(expr string) (*big.Rat, error) {
+	return EvalWithOptions(expr, Options{})
+}
 
-	retval, err := st.Pop()
+func EvalWithOptions(expr string, options Options) (*big.Rat, error) {
+	tokens, err := Tokenise(expr)
 	if err != nil {
 		return nil, err
 	}
-	return retval.(*big.Rat), nil
+	postfix, err := convert2postfix(tokens, options)
+	if err != nil {
+		return nil, err
+	}
+	return evaluatePostfix(postfix)
 }
 
-func Tokenise(expr string) []string {
-	spaced := unary_minus_rx.ReplaceAllString(expr, "$1 @")
-	spaced = fp_rx.ReplaceAllString(spaced, " ${1} ")
-	spaced = functions_rx.ReplaceAllString(spaced, " ${1} ")
+// EvalComplex evaluates an expression that may contain imaginary literals
+// such as 4i or i. Unlike Eval it works in complex128, not exact rationals.
+func EvalComplex(expr string) (complex128, error) {
+	return EvalComplexWithOptions(expr, Options{})
+}
 
-	if symbols_rx != nil {
-		spaced = symbols_rx.ReplaceAllString(spaced, " ${1} ")
+func EvalComplexWithOptions(expr string, options Options) (complex128, error) {
+	tokens, err := Tokenise(expr)
+	if err != nil {
+		return 0, err
 	}
-
-	symbols := []string{"(", ")"}
-	for _, symbol := range symbols {
-		spaced = strings.Replace(spaced, symbol, fmt.Sprintf(" %s ", symbol), -1)
+	postfix, err := convert2postfix(joinImaginary(tokens), options)
+	if err != nil {
+		return 0, err
 	}
-
-	stripped := whitespace_rx.ReplaceAllString(strings.TrimSpace(spaced), "|")
-	result := strings.Split(stripped, "|")
-	return result
+	return evaluateComplexPostfix(postfix)
 }
 
-func Eval(expr string) (result *big.Rat, err error) {
-	defer func() {
-		if e := recover(); e != nil {
-			result = nil
-			err = ErrInvalidExpression
+func evaluateComplexPostfix(postfix []Token) (complex128, error) {
+	var st stack.Stack
+	for i := 0; i < len(postfix); i++ {
+		token := postfix[i]
+		switch token.Kind {
+		case Number:
+			value, _ := token.Value.Float64()
+			if token.Imag {
+				st.Push(complex(0, value))
+			} else {
+				st.Push(complex(value, 0))
+			}
+
+		case Marker:
+			truthy := false
+			if token.Text != ELSE_MARKER && token.Text != END_MARKER {
+				top, err := st.Top()
+				if err != nil {
+					return 0, ErrInvalidExpression
+				}
+				truthy = top.(complex128) != 0
+			}
+			next, drop, decided, err := jump(postfix, i, truthy)
+			if err != nil {
+				return 0, err
+			}
+			if drop {
+				st.Pop()
+			}
+			if decided != nil {
+				value, _ := decided.Float64()
+				st.Push(complex(value, 0))
+			}
+			i = next
+
+		case Call, Operator:
+			arity := 2
+			if token.Kind == Call {
+				arity = token.Arity
+			} else if token.Text == NEGATE {
+				arity = 1
+			}
+			if st.Len() < arity {
+				return 0, ErrInvalidExpression
+			}
+			args := make([]complex128, arity)
+			allReal := true
+			for i := arity - 1; i >= 0; i-- {
+				op, _ := st.Pop()
+				args[i] = op.(complex128)
+				allReal = allReal && imag(args[i]) == 0
+			}
+			if token.Text == NEGATE {
+				// 0-z keeps a zero imaginary part +0, so sqrt(-4) is 2i.
+				st.Push(complex(0, 0) - args[0])
+				continue
+			}
+			name := token.Text
+			if name == "**" {
+				name = "^"
+			}
+			value, err := applyComplex(name, args, allReal)
+			if err != nil {
+				return 0, err
+			}
+			st.Push(value)
+
+		default:
+			return 0, ErrInvalidExpression
 		}
-	}()
+	}
+	if st.Len() != 1 {
+		return 0, ErrInvalidExpression
+	}
+	retval, _ := st.Pop()
+	return retval.(complex128), nil
+}
 
-	tokens := Tokenise(expr)
-	postfix := convert2postfix(tokens)
-	return evaluatePostfix(postfix)
+// applyComplex applies an operation to complex operands. Operations without
+// a complex implementation, such as min or <, use the real one when the
+// operands are all real.
+func applyComplex(name string, args []complex128, allReal bool) (complex128, error) {
+	if op, ok := ops.Lookup(name); !allReal || !ok || op.ApplyComplex != nil {
+		return ops.ApplyComplex(name, args...)
+	}
+	reals := make([]float64, len(args))
+	for i, arg := range args {
+		reals[i] = real(arg)
+	}
+	value, err := ops.Apply(name, reals...)
+	return complex(value, 0), err
 }
 
 func BigratToInt(bigrat *big.Rat) (int64, error) {
@@ -1,7 +1,9 @@
 package eval
 
 import (
+	"math"
 	"math/big"
+	"math/cmplx"
 	"testing"
 )
 
@@ -34,6 +36,11 @@ func TestEval_ValidExpressions(t *testing.T) {
 		{"10+5*2/3.0*2.0", 16.6666666667},
 		{"10+5*2/3.0*2.0+1", 17.6666666667},
 		{"10+5*2/3.0*2.0-1", 15.6666666667},
+		{"1e3+2.5E-1", 1000.25},
+		{".5*4", 2},
+		{"0x1F+0b101", 36},
+		{"2**10", 1024},
+		{"1_000_000/0b1_000", 125000},
 	}
 	for _, tt := range tests {
 		result, err := Eval(tt.expression)
@@ -73,6 +80,12 @@ func TestEval_InvalidExpressions(t *testing.T) {
 		"10+5*2/3*(10+5)+-10*",
 		"10+5*2/3*(10+5)+-10*/",
 		"10+5*2/3*(10+5)+-10*/10",
+		"1 2",
+		"--5",
+		"2 3 +",
+		"1e",
+		"0x",
+		"2 $ 3",
 	}
 	for _, expr := range tests {
 		_, err := Eval(expr)
@@ -154,3 +167,234 @@ func TestFloatToBigrat(t *testing.T) {
 		}
 	}
 }
+
+func TestEval_Functions(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   float64
+	}{
+		{"sqrt(16)", 4},
+		{"sqrt(3*3+4*4)", 5},
+		{"2*sqrt(9)+1", 7},
+		{"ln(1)", 0},
+		{"cos(0)+sin(0)", 1},
+	}
+	for _, tt := range tests {
+		result, err := Eval(tt.expression)
+		if err != nil {
+			t.Errorf("unexpected error for expression %q: %v", tt.expression, err)
+			continue
+		}
+		if actual := BigratToFloat(result); actual != tt.expected {
+			t.Errorf("for expression %q, expected %v, got %v", tt.expression, tt.expected, actual)
+		}
+	}
+	for _, expression := range []string{"foo(1)", "sqrt(0-1)"} {
+		if _, err := Eval(expression); err == nil {
+			t.Errorf("expected an error for expression %q, got nil", expression)
+		}
+	}
+}
+
+func TestEvalComplex(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   complex128
+	}{
+		{"3+4i", 3 + 4i},
+		{"i*i", -1},
+		{"(1+2i)*(3-i)", 5 + 5i},
+		{"-2.5i", -2.5i},
+		{"sqrt(0-4)", 2i},
+		{"sqrt(-4)", 2i},
+		{"ln(-1)", complex(0, math.Pi)},
+		{"abs(3+4i)", 5},
+		{"conj(3+4i)+re(2i)+im(2i)", 5 - 4i},
+		{"2^3^2", 512},
+		{"1+2*3", 7},
+	}
+	for _, tt := range tests {
+		result, err := EvalComplex(tt.expression)
+		if err != nil {
+			t.Errorf("unexpected error for expression %q: %v", tt.expression, err)
+			continue
+		}
+		if cmplx.Abs(result-tt.expected) > 1e-12 {
+			t.Errorf("for expression %q, expected %v, got %v", tt.expression, tt.expected, result)
+		}
+	}
+	for _, expression := range []string{"1/(i-i)", "3+", "x+1"} {
+		if _, err := EvalComplex(expression); err == nil {
+			t.Errorf("expected an error for expression %q, got nil", expression)
+		}
+	}
+}
+
+func TestEval_Units(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   float64
+	}{
+		{"3 m / 2 s", 1.5},
+		{"5 kg * 2 m/s^2", 10},
+		{"2km^2", 2e6},
+		{"90 min + 1h", 9000},
+		{"-3km", -3000},
+		{"(5kg*m/s^2)", 5},
+	}
+	for _, tt := range tests {
+		result, err := Eval(tt.expression)
+		if err != nil {
+			t.Errorf("unexpected error for expression %q: %v", tt.expression, err)
+			continue
+		}
+		if actual := BigratToFloat(result); actual != tt.expected {
+			t.Errorf("for expression %q, expected %v, got %v", tt.expression, tt.expected, actual)
+		}
+	}
+}
+
+func TestEval_Variadic(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   float64
+	}{
+		{"min(3, 1, 2)", 1},
+		{"max(1+2, 2*2, -5)", 4},
+		{"sum(1,2,3,4)*2", 20},
+		{"prod(2,3)", 6},
+		{"avg(1,2,3,4)", 2.5},
+		{"median(5,1,3)", 3},
+		{"var(2,4,4,4,5,5,7,9)", 4},
+		{"stddev(2,4,4,4,5,5,7,9)+1", 3},
+		{"min(-1,-2)", -2},
+		{"max(min(1,2),sqrt(9))", 3},
+		{"min(5)", 5},
+		{"sum(1 m, 50 cm)", 1.5},
+	}
+	for _, tt := range tests {
+		result, err := Eval(tt.expression)
+		if err != nil {
+			t.Errorf("unexpected error for expression %q: %v", tt.expression, err)
+			continue
+		}
+		if actual := BigratToFloat(result); actual != tt.expected {
+			t.Errorf("for expression %q, expected %v, got %v", tt.expression, tt.expected, actual)
+		}
+	}
+	for _, expression := range []string{"min()", "1,2", "sqrt(1,2)"} {
+		if _, err := Eval(expression); err == nil {
+			t.Errorf("expected an error for expression %q, got nil", expression)
+		}
+	}
+	if z, err := EvalComplex("max(1,2)*i"); err != nil || z != 2i {
+		t.Errorf("max(1,2)*i = %v, %v", z, err)
+	}
+}
+
+func TestEval_Conditional(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   float64
+	}{
+		{"1 < 2", 1},
+		{"2 <= 1", 0},
+		{"3 >= 3", 1},
+		{"1+1 == 2", 1},
+		{"1 != 1", 0},
+		{"!0", 1},
+		{"!(2 > 1)", 0},
+		{"1 > 0 && 2 > 1", 1},
+		{"0 || 2", 1},
+		{"0 && 1/0", 0},
+		{"1 || 1/0", 1},
+		{"2 > 1 ? 10 : 20", 10},
+		{"0 ? 1/0 : 5", 5},
+		{"1 ? 0 ? 1 : 2 : 3", 2},
+		{"0 ? 1 : 0 ? 2 : 3", 3},
+		{"-1 ? -2 : -3", -2},
+		{"(1 ? 2 : 3) + 1", 3},
+		{"min(0 ? 2 : 3, 4)", 3},
+		{"if(1 < 2, 10, 1/0)", 10},
+		{"2 * if(0, 1, if(1, 3, 4))", 6},
+		{"if(max(0, 1), min(5, 6), 7) + 1", 6},
+	}
+	for _, tt := range tests {
+		result, err := Eval(tt.expression)
+		if err != nil {
+			t.Errorf("unexpected error for expression %q: %v", tt.expression, err)
+			continue
+		}
+		if actual := BigratToFloat(result); actual != tt.expected {
+			t.Errorf("for expression %q, expected %v, got %v", tt.expression, tt.expected, actual)
+		}
+	}
+	for _, expression := range []string{"1 ?", "1 : 2", "(1 ? 2) : 3", "1 ? 2 : 1/0 ? 3", "if(1, 2)", "if(1, 2, 3"} {
+		if _, err := Eval(expression); err == nil {
+			t.Errorf("expected an error for expression %q, got nil", expression)
+		}
+	}
+	if z, err := EvalComplex("1 < 2 ? i : 0"); err != nil || z != 1i {
+		t.Errorf("1 < 2 ? i : 0 = %v, %v", z, err)
+	}
+}
+
+func TestEval_Constants(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   float64
+	}{
+		{"pi", math.Pi},
+		{"2*pi - tau", 0},
+		{"ln(e)", 1},
+		{"phi^2 - phi", 1},
+	}
+	for _, test := range tests {
+		result, err := Eval(test.expression)
+		if err != nil {
+			t.Errorf("Eval(%q): unexpected error %v", test.expression, err)
+			continue
+		}
+		if actual := BigratToFloat(result); math.Abs(actual-test.expected) > 1e-9 {
+			t.Errorf("Eval(%q) = %v, want %v", test.expression, actual, test.expected)
+		}
+	}
+}
+
+func TestEvalWithOptions_Natural(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   float64
+	}{
+		{"2pi", 2 * math.Pi},
+		{"3(4+5)", 27},
+		{"(1+2)(3+4)", 21},
+		{"2 sqrt(16)", 8},
+		{"5!", 120},
+		{"-3!", -6},
+		{"2^3!", 64},
+		{"(1+2)!/2", 3},
+		{"1/2pi", math.Pi / 2},
+		{"3! != 6", 0},
+	}
+	natural := Options{Natural: true}
+	for _, test := range tests {
+		result, err := EvalWithOptions(test.expression, natural)
+		if err != nil {
+			t.Errorf("EvalWithOptions(%q): unexpected error %v", test.expression, err)
+			continue
+		}
+		if actual := BigratToFloat(result); math.Abs(actual-test.expected) > 1e-9 {
+			t.Errorf("EvalWithOptions(%q) = %v, want %v", test.expression, actual, test.expected)
+		}
+		if _, err := Eval(test.expression); err == nil {
+			t.Errorf("Eval(%q): expected an error without natural notation", test.expression)
+		}
+	}
+	if z, err := EvalComplexWithOptions("2i(3+i)", natural); err != nil || z != complex(-2, 6) {
+		t.Errorf("EvalComplexWithOptions(2i(3+i)) = %v, %v", z, err)
+	}
+	if _, err := EvalWithOptions("2.5!", natural); err == nil {
+		t.Error("Expected an error for 2.5!")
+	}
+}
@@ -0,0 +1,328 @@
+package eval
+
+import (
+	"Yandex_Calc_V2.0/internal/ops"
+	"Yandex_Calc_V2.0/internal/units"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type TokenKind int
+
+const (
+	Number TokenKind = iota
+	Identifier
+	Operator
+	LeftParen
+	RightParen
+	Comma
+	Question
+	Colon
+	// Call and Marker only appear in postfix notation: a function applied
+	// to Arity arguments, and a jump of a lazy operator.
+	Call
+	Marker
+)
+
+var kindNames = map[TokenKind]string{
+	Number:     "number",
+	Identifier: "identifier",
+	Operator:   "operator",
+	LeftParen:  "(",
+	RightParen: ")",
+	Comma:      ",",
+	Question:   "?",
+	Colon:      ":",
+	Call:       "call",
+	Marker:     "marker",
+}
+
+func (k TokenKind) String() string {
+	return kindNames[k]
+}
+
+// Token is a lexeme of an expression. Start and End are the byte offsets of
+// the text in the expression; tokens made by the evaluator, like the unary
+// minus @, have the span of the text they stand for.
+type Token struct {
+	Kind       TokenKind
+	Text       string
+	Start, End int
+	// Value of a number, exact for decimal literals.
+	Value *big.Rat
+	// Imag marks an imaginary number like 4i.
+	Imag bool
+	// Arity is the number of arguments of a call.
+	Arity int
+}
+
+func (t Token) String() string {
+	if t.Kind == Call {
+		return t.Text + ARITY_SEPARATOR + strconv.Itoa(t.Arity)
+	}
+	return t.Text
+}
+
+// SyntaxError is a lexical or syntax error at a byte offset of the
+// expression. It matches ErrInvalidExpression with errors.Is.
+type SyntaxError struct {
+	Offset  int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at offset %d", e.Message, e.Offset)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return ErrInvalidExpression
+}
+
+func syntaxError(offset int, format string, args ...interface{}) error {
+	return &SyntaxError{Offset: offset, Message: fmt.Sprintf(format, args...)}
+}
+
+// evalOperators are the operators eval knows besides the infix operators of
+// the registry: ** is a synonym of ^, % is the remainder and ! the prefix
+// negation.
+var evalOperators = []string{"**", "%", "!"}
+
+func isDigit(ch rune) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+func isIdentifierStart(ch rune) bool {
+	return ch == '_' || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z')
+}
+
+func isIdentifierChar(ch rune) bool {
+	return isIdentifierStart(ch) || isDigit(ch)
+}
+
+// Lex splits the expression into tokens. Numbers follow the grammar of
+// LexNumber: decimal with an optional exponent (1.5, .5, 1e-3), hexadecimal
+// (0x1F) or binary (0b101).
+func Lex(expr string) ([]Token, error) {
+	var tokens []Token
+	pos := 0
+	for pos < len(expr) {
+		ch, size := utf8.DecodeRuneInString(expr[pos:])
+		var token Token
+		var err error
+		switch {
+		case unicode.IsSpace(ch):
+			pos += size
+			continue
+		case isDigit(ch) || (ch == '.' && pos+1 < len(expr) && isDigit(rune(expr[pos+1]))):
+			token, err = LexNumber(expr, pos)
+		case isIdentifierStart(ch):
+			end := pos
+			for end < len(expr) && isIdentifierChar(rune(expr[end])) {
+				end++
+			}
+			token = Token{Kind: Identifier, Text: expr[pos:end]}
+		default:
+			token, err = lexSymbol(expr, pos, ch)
+		}
+		if err != nil {
+			return nil, err
+		}
+		token.Start, token.End = pos, pos+len(token.Text)
+		tokens = append(tokens, token)
+		pos = token.End
+	}
+	return tokens, nil
+}
+
+var punctuation = map[rune]TokenKind{
+	'(': LeftParen,
+	')': RightParen,
+	',': Comma,
+	'?': Question,
+	':': Colon,
+}
+
+// lexSymbol reads punctuation or the longest operator at pos.
+func lexSymbol(expr string, pos int, ch rune) (Token, error) {
+	if kind, ok := punctuation[ch]; ok {
+		return Token{Kind: kind, Text: string(ch)}, nil
+	}
+	match := ""
+	if op, ok := ops.Default.MatchInfix(expr[pos:]); ok {
+		match = op.Symbol
+	}
+	for _, symbol := range evalOperators {
+		if strings.HasPrefix(expr[pos:], symbol) && len(symbol) > len(match) {
+			match = symbol
+		}
+	}
+	if match == "" {
+		return Token{}, syntaxError(pos, "unexpected character %q", ch)
+	}
+	return Token{Kind: Operator, Text: match}, nil
+}
+
+// LexNumber reads the numeric literal at pos. The grammar is
+//
+//	number  = decimal | "0x" hex | "0b" binary
+//	decimal = digits [ "." digits ] [ ("e" | "E") [ "+" | "-" ] digits ]
+//	        | "." digits [ ("e" | "E") [ "+" | "-" ] digits ]
+//
+// where an underscore may separate two digits, as in 1_000_000 or 0xFF_FF.
+// The value of a decimal literal is exact.
+func LexNumber(expr string, start int) (Token, error) {
+	pos := start
+	digits := func(valid func(byte) bool) (int, error) {
+		from := pos
+		for pos < len(expr) {
+			switch {
+			case valid(expr[pos]):
+				pos++
+			case expr[pos] == '_' && pos > from && valid(expr[pos-1]) && pos+1 < len(expr) && valid(expr[pos+1]):
+				pos++
+			case expr[pos] == '_':
+				return 0, syntaxError(pos, "underscore must separate digits")
+			default:
+				return pos - from, nil
+			}
+		}
+		return pos - from, nil
+	}
+	decimal := func(ch byte) bool { return '0' <= ch && ch <= '9' }
+	number := func(text string, value *big.Rat) Token {
+		return Token{Kind: Number, Text: text, Start: start, End: start + len(text), Value: value}
+	}
+	if expr[pos] == '0' && pos+1 < len(expr) && strings.ContainsRune("xXbB", rune(expr[pos+1])) {
+		base, name, valid := 16, "hexadecimal", func(ch byte) bool {
+			return decimal(ch) || ('a' <= ch && ch <= 'f') || ('A' <= ch && ch <= 'F')
+		}
+		if expr[pos+1] == 'b' || expr[pos+1] == 'B' {
+			base, name, valid = 2, "binary", func(ch byte) bool { return ch == '0' || ch == '1' }
+		}
+		pos += 2
+		if n, err := digits(valid); err != nil {
+			return Token{}, err
+		} else if n == 0 {
+			return Token{}, syntaxError(start, "%s literal has no digits", name)
+		}
+		if pos < len(expr) && (decimal(expr[pos]) || expr[pos] == '.') {
+			return Token{}, syntaxError(pos, "invalid digit %q in %s literal", expr[pos], name)
+		}
+		value, _ := new(big.Int).SetString(strings.ReplaceAll(expr[start+2:pos], "_", ""), base)
+		return number(expr[start:pos], new(big.Rat).SetInt(value)), nil
+	}
+	if _, err := digits(decimal); err != nil {
+		return Token{}, err
+	}
+	if pos < len(expr) && expr[pos] == '.' {
+		pos++
+		if n, err := digits(decimal); err != nil {
+			return Token{}, err
+		} else if n == 0 {
+			return Token{}, syntaxError(pos, "expected a digit after the decimal point")
+		}
+	}
+	// An e is an exponent only when digits follow, so that 2e can still be
+	// read as a number and an identifier.
+	if pos < len(expr) && (expr[pos] == 'e' || expr[pos] == 'E') {
+		mark := pos
+		pos++
+		if pos < len(expr) && (expr[pos] == '+' || expr[pos] == '-') {
+			pos++
+		}
+		if n, err := digits(decimal); err != nil {
+			return Token{}, err
+		} else if n == 0 {
+			pos = mark
+		}
+	}
+	if pos < len(expr) && expr[pos] == '.' {
+		return Token{}, syntaxError(pos, "unexpected . in number %s", expr[start:pos])
+	}
+	value, ok := new(big.Rat).SetString(strings.ReplaceAll(expr[start:pos], "_", ""))
+	if !ok {
+		return Token{}, syntaxError(start, "malformed number %s", expr[start:pos])
+	}
+	return number(expr[start:pos], value), nil
+}
+
+// Tokenise lexes the expression, converts quantities with units into
+// numbers in SI base units and constants such as pi into numbers.
+func Tokenise(expr string) ([]Token, error) {
+	tokens, err := Lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	return joinConstants(joinUnits(tokens)), nil
+}
+
+// joinConstants replaces the names of constants with their values.
+func joinConstants(tokens []Token) []Token {
+	for i, token := range tokens {
+		value, ok := ops.LookupConstant(token.Text)
+		if token.Kind == Identifier && ok && (i+1 == len(tokens) || tokens[i+1].Kind != LeftParen) {
+			tokens[i].Kind, tokens[i].Value = Number, new(big.Rat).SetFloat64(value)
+		}
+	}
+	return tokens
+}
+
+func isInteger(token Token) bool {
+	return token.Kind == Number && !token.Imag && token.Value.IsInt()
+}
+
+// joinUnits converts quantities such as 3 km or 2 m ^ 2 into one number
+// token in SI base units. A unit without a number, as in m/s, becomes its
+// scale. Names followed by ( are left to functions.
+func joinUnits(tokens []Token) []Token {
+	result := make([]Token, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		unit, ok := units.Lookup(token.Text)
+		if token.Kind != Identifier || !ok || (i+1 < len(tokens) && tokens[i+1].Kind == LeftParen) {
+			result = append(result, token)
+			continue
+		}
+		value := unit.Scale
+		if n := len(result); n > 0 && result[n-1].Kind == Number {
+			number, _ := result[n-1].Value.Float64()
+			token.Start = result[n-1].Start
+			result = result[:n-1]
+			exponent := 1
+			if i+2 < len(tokens) && tokens[i+1].Text == "^" && isInteger(tokens[i+2]) {
+				exponent = int(tokens[i+2].Value.Num().Int64())
+				token.End = tokens[i+2].End
+				i += 2
+			}
+			value = unit.Scaled(number, exponent)
+		}
+		text := strconv.FormatFloat(value, 'g', -1, 64)
+		exact, _ := new(big.Rat).SetString(text)
+		result = append(result, Token{Kind: Number, Text: text, Start: token.Start, End: token.End, Value: exact})
+	}
+	return result
+}
+
+// joinImaginary turns a number followed by i, as in 4i, and a lone i into
+// imaginary numbers.
+func joinImaginary(tokens []Token) []Token {
+	result := make([]Token, 0, len(tokens))
+	for _, token := range tokens {
+		if token.Kind != Identifier || token.Text != "i" {
+			result = append(result, token)
+			continue
+		}
+		if n := len(result); n > 0 && result[n-1].Kind == Number && !result[n-1].Imag {
+			result[n-1].Imag = true
+			result[n-1].End = token.End
+			result[n-1].Text += "i"
+			continue
+		}
+		result = append(result, Token{Kind: Number, Text: "i", Start: token.Start, End: token.End, Value: big.NewRat(1, 1), Imag: true})
+	}
+	return result
+}
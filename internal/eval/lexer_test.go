@@ -0,0 +1,182 @@
+package eval
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	tokens, err := Lex("2**x >= 1e-3 != (0x1F, 0b101) && !.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type lexeme struct {
+		kind       TokenKind
+		text       string
+		start, end int
+	}
+	expected := []lexeme{
+		{Number, "2", 0, 1},
+		{Operator, "**", 1, 3},
+		{Identifier, "x", 3, 4},
+		{Operator, ">=", 5, 7},
+		{Number, "1e-3", 8, 12},
+		{Operator, "!=", 13, 15},
+		{LeftParen, "(", 16, 17},
+		{Number, "0x1F", 17, 21},
+		{Comma, ",", 21, 22},
+		{Number, "0b101", 23, 28},
+		{RightParen, ")", 28, 29},
+		{Operator, "&&", 30, 32},
+		{Operator, "!", 33, 34},
+		{Number, ".5", 34, 36},
+	}
+	actual := make([]lexeme, len(tokens))
+	for i, token := range tokens {
+		actual[i] = lexeme{token.Kind, token.Text, token.Start, token.End}
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Lex:\n got %v\nwant %v", actual, expected)
+	}
+	values := map[string]float64{"1e-3": 0.001, "0x1F": 31, "0b101": 5, ".5": 0.5}
+	for _, token := range tokens {
+		if want, ok := values[token.Text]; ok {
+			if got, _ := token.Value.Float64(); got != want {
+				t.Errorf("value of %s: expected %v, got %v", token.Text, want, got)
+			}
+		}
+	}
+}
+
+func TestLex_Numbers(t *testing.T) {
+	tests := []struct {
+		input string
+		texts []string
+	}{
+		{"1.5E+2", []string{"1.5E+2"}},
+		{"2e", []string{"2", "e"}},
+		{"2e+x", []string{"2", "e", "+", "x"}},
+		{"0XfF", []string{"0XfF"}},
+		{"3km", []string{"3", "km"}},
+		{"4i", []string{"4", "i"}},
+		{"1_000_000+0xFF_FF", []string{"1_000_000", "+", "0xFF_FF"}},
+		{"arcsin(1)", []string{"arcsin", "(", "1", ")"}},
+	}
+	for _, test := range tests {
+		tokens, err := Lex(test.input)
+		if err != nil {
+			t.Errorf("Lex(%q): unexpected error %v", test.input, err)
+			continue
+		}
+		texts := make([]string, len(tokens))
+		for i, token := range tokens {
+			texts[i] = token.Text
+		}
+		if !reflect.DeepEqual(texts, test.texts) {
+			t.Errorf("Lex(%q) = %q, want %q", test.input, texts, test.texts)
+		}
+	}
+}
+
+func TestLex_Errors(t *testing.T) {
+	tests := []struct {
+		input   string
+		offset  int
+		message string
+	}{
+		{"1 $ 2", 2, `unexpected character '$'`},
+		{"2 * 1.", 6, "expected a digit after the decimal point"},
+		{"1.2.3", 3, "unexpected . in number 1.2"},
+		{"0x", 0, "hexadecimal literal has no digits"},
+		{"0b102", 4, `invalid digit '2' in binary literal`},
+		{"1 @ 2", 2, `unexpected character '@'`},
+		{"1__000", 1, "underscore must separate digits"},
+		{"1_000_", 5, "underscore must separate digits"},
+		{"1_.5", 1, "underscore must separate digits"},
+		{"1 + ü", 4, `unexpected character 'ü'`},
+	}
+	for _, test := range tests {
+		_, err := Lex(test.input)
+		var syntax *SyntaxError
+		if !errors.As(err, &syntax) || syntax.Offset != test.offset || syntax.Message != test.message {
+			t.Errorf("Lex(%q): expected %q at %d, got %v", test.input, test.message, test.offset, err)
+		}
+		if _, err := Eval(test.input); !errors.Is(err, ErrInvalidExpression) {
+			t.Errorf("Eval(%q): expected an invalid expression, got %v", test.input, err)
+		}
+	}
+}
+
+func TestConvert2postfix(t *testing.T) {
+	tests := []struct {
+		input   string
+		postfix string
+	}{
+		{"1 + 2 * 3", "1 2 3 * +"},
+		{"-2^2", "2 @ 2 ^"},
+		{"2 ** 3 >= 8", "2 3 ** 8 >="},
+		{"max(1, 2 - -3)", "1 2 3 @ - max#2"},
+		{"!(1 != 2)", "1 2 != !#1"},
+		{"1 && 0 || 1", "1 &&? 0 && ||? 1 ||"},
+		{"if(1, 2, 3)", "1 ? 2 : 3 ?:"},
+	}
+	for _, test := range tests {
+		tokens, err := Tokenise(test.input)
+		if err != nil {
+			t.Fatalf("Tokenise(%q): %v", test.input, err)
+		}
+		postfix, err := convert2postfix(tokens, Options{})
+		if err != nil {
+			t.Errorf("convert2postfix(%q): unexpected error %v", test.input, err)
+			continue
+		}
+		texts := make([]string, len(postfix))
+		for i, token := range postfix {
+			texts[i] = token.String()
+		}
+		if got := join(texts); got != test.postfix {
+			t.Errorf("convert2postfix(%q) = %q, want %q", test.input, got, test.postfix)
+		}
+	}
+}
+
+func join(texts []string) string {
+	result := ""
+	for i, text := range texts {
+		if i > 0 {
+			result += " "
+		}
+		result += text
+	}
+	return result
+}
+
+func TestConvert2postfix_Errors(t *testing.T) {
+	tests := []struct {
+		input   string
+		offset  int
+		message string
+	}{
+		{"1 2", 2, "unexpected 2"},
+		{"1 +", 3, "unexpected end of expression"},
+		{"(1 + 2", 6, "missing )"},
+		{"1 + 2)", 5, "unexpected )"},
+		{"sin 1", 3, "expected ( after sin"},
+		{"arcsinh(1)", 0, "unknown identifier arcsinh"},
+		{"--1", 1, "unexpected -"},
+		{"+1", 0, "unexpected +"},
+		{"1 ? 2", 2, "missing : after ?"},
+		{"1 : 2", 2, "unexpected : without ?"},
+		{"(1, 2)", 2, "unexpected ,"},
+		{"max(1,)", 6, "unexpected )"},
+		{"if(1, 2)", 0, "if expects 3 arguments, got 2"},
+	}
+	for _, test := range tests {
+		_, err := Eval(test.input)
+		var syntax *SyntaxError
+		if !errors.As(err, &syntax) || syntax.Offset != test.offset || syntax.Message != test.message {
+			t.Errorf("Eval(%q): expected %q at %d, got %v", test.input, test.message, test.offset, err)
+		}
+	}
+}
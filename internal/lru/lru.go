@@ -0,0 +1,66 @@
+package lru
+
+import (
+	"container/list"
+)
+
+type entry struct {
+	key   interface{}
+	value interface{}
+}
+
+type Cache struct {
+	capacity int
+	items    map[interface{}]*list.Element
+	order    *list.List
+}
+
+func New(capacity int) *Cache {
+	return &Cache{
+		capacity: capacity,
+		items:    make(map[interface{}]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *Cache) Len() int {
+	return c.order.Len()
+}
+
+func (c *Cache) Cap() int {
+	return c.capacity
+}
+
+func (c *Cache) Get(key interface{}) (interface{}, bool) {
+	if el, ok := c.items[key]; ok {
+		c.order.MoveToFront(el)
+		return el.Value.(*entry).value, true
+	}
+	return nil, false
+}
+
+func (c *Cache) Put(key, value interface{}) {
+	if c.capacity <= 0 {
+		return
+	}
+	if el, ok := c.items[key]; ok {
+		el.Value.(*entry).value = value
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&entry{key: key, value: value})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry).key)
+	}
+}
+
+func (c *Cache) Remove(key interface{}) bool {
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+		delete(c.items, key)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package lru
+
+import (
+	"testing"
+)
+
+func TestPutGet(t *testing.T) {
+	c := New(2)
+	c.Put("a", 1)
+	c.Put("b", 2)
+
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("Expected 1, got %v (found %v)", v, ok)
+	}
+	if v, ok := c.Get("b"); !ok || v != 2 {
+		t.Errorf("Expected 2, got %v (found %v)", v, ok)
+	}
+	if _, ok := c.Get("c"); ok {
+		t.Errorf("Expected missing key c")
+	}
+	if c.Len() != 2 {
+		t.Errorf("Expected length 2, got %d", c.Len())
+	}
+}
+
+func TestEviction(t *testing.T) {
+	c := New(2)
+	c.Put("a", 1)
+	c.Put("b", 2)
+	c.Get("a")
+	c.Put("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("Expected least recently used key b to be evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Errorf("Expected recently used key a to stay")
+	}
+	if _, ok := c.Get("c"); !ok {
+		t.Errorf("Expected new key c to be stored")
+	}
+	if c.Len() != 2 {
+		t.Errorf("Expected length 2, got %d", c.Len())
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	c := New(2)
+	c.Put("a", 1)
+	c.Put("b", 2)
+	c.Put("a", 10)
+	c.Put("c", 3)
+
+	if v, ok := c.Get("a"); !ok || v != 10 {
+		t.Errorf("Expected updated value 10, got %v (found %v)", v, ok)
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("Expected key b to be evicted")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	c := New(2)
+	c.Put("a", 1)
+
+	if !c.Remove("a") {
+		t.Errorf("Expected key a to be removed")
+	}
+	if c.Remove("a") {
+		t.Errorf("Expected second removal to report false")
+	}
+	if c.Len() != 0 {
+		t.Errorf("Expected length 0, got %d", c.Len())
+	}
+}
+
+func TestZeroCapacity(t *testing.T) {
+	c := New(0)
+	c.Put("a", 1)
+
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Expected zero-capacity cache to store nothing")
+	}
+	if c.Len() != 0 {
+		t.Errorf("Expected length 0, got %d", c.Len())
+	}
+}
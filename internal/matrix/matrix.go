@@ -0,0 +1,284 @@
+package matrix
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MaxElements bounds the size of a matrix literal or result.
+const MaxElements = 1 << 20
+
+var ErrSingular = errors.New("matrix is singular")
+
+// Matrix is a dense matrix stored row by row. A vector is a matrix with one
+// column.
+type Matrix struct {
+	Rows int       `json:"rows" example:"2"`
+	Cols int       `json:"cols" example:"2"`
+	Data []float64 `json:"data"`
+}
+
+func New(rows, cols int) *Matrix {
+	return &Matrix{Rows: rows, Cols: cols, Data: make([]float64, rows*cols)}
+}
+
+// FromRows builds a matrix from rows of equal length.
+func FromRows(rows [][]float64) (*Matrix, error) {
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return nil, errors.New("empty matrix")
+	}
+	m := New(len(rows), len(rows[0]))
+	if len(m.Data) > MaxElements {
+		return nil, fmt.Errorf("matrix has more than %d elements", MaxElements)
+	}
+	for i, row := range rows {
+		if len(row) != m.Cols {
+			return nil, fmt.Errorf("row %d has %d elements, expected %d", i+1, len(row), m.Cols)
+		}
+		copy(m.Data[i*m.Cols:], row)
+	}
+	return m, nil
+}
+
+// Scalar wraps a number into a 1x1 matrix.
+func Scalar(x float64) *Matrix {
+	return &Matrix{Rows: 1, Cols: 1, Data: []float64{x}}
+}
+
+// IsScalar reports whether the matrix is 1x1. Such matrices act as numbers.
+func (m *Matrix) IsScalar() bool {
+	return m.Rows == 1 && m.Cols == 1
+}
+
+func (m *Matrix) IsVector() bool {
+	return m.Rows == 1 || m.Cols == 1
+}
+
+func (m *Matrix) At(i, j int) float64 {
+	return m.Data[i*m.Cols+j]
+}
+
+func (m *Matrix) Clone() *Matrix {
+	clone := &Matrix{Rows: m.Rows, Cols: m.Cols, Data: make([]float64, len(m.Data))}
+	copy(clone.Data, m.Data)
+	return clone
+}
+
+// Shape renders the dimensions as 2x3.
+func (m *Matrix) Shape() string {
+	return fmt.Sprintf("%dx%d", m.Rows, m.Cols)
+}
+
+// String renders a column vector as [1,2] and any other matrix as
+// [[1,2],[3,4]], the syntax of matrix literals.
+func (m *Matrix) String() string {
+	var b strings.Builder
+	if m.Cols == 1 {
+		b.WriteByte('[')
+		for i, x := range m.Data {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(strconv.FormatFloat(x, 'f', -1, 64))
+		}
+		b.WriteByte(']')
+		return b.String()
+	}
+	b.WriteByte('[')
+	for i := 0; i < m.Rows; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('[')
+		for j := 0; j < m.Cols; j++ {
+			if j > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(strconv.FormatFloat(m.At(i, j), 'f', -1, 64))
+		}
+		b.WriteByte(']')
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// Slice returns the rows [from, to) as a new matrix.
+func (m *Matrix) Slice(from, to int) *Matrix {
+	block := New(to-from, m.Cols)
+	copy(block.Data, m.Data[from*m.Cols:to*m.Cols])
+	return block
+}
+
+// Stack puts the rows of b under the rows of a.
+func Stack(a, b *Matrix) (*Matrix, error) {
+	if a.Cols != b.Cols {
+		return nil, fmt.Errorf("cannot stack %s and %s matrices", a.Shape(), b.Shape())
+	}
+	m := New(a.Rows+b.Rows, a.Cols)
+	copy(m.Data, a.Data)
+	copy(m.Data[len(a.Data):], b.Data)
+	return m, nil
+}
+
+// Elementwise applies fn to the elements at the same positions of matrices
+// of equal shape.
+func Elementwise(a, b *Matrix, name string, fn func(x, y float64) float64) (*Matrix, error) {
+	if a.Rows != b.Rows || a.Cols != b.Cols {
+		return nil, fmt.Errorf("cannot %s %s and %s matrices", name, a.Shape(), b.Shape())
+	}
+	m := New(a.Rows, a.Cols)
+	for i := range m.Data {
+		m.Data[i] = fn(a.Data[i], b.Data[i])
+	}
+	return m, nil
+}
+
+// Map applies fn to every element.
+func Map(a *Matrix, fn func(x float64) float64) *Matrix {
+	m := New(a.Rows, a.Cols)
+	for i, x := range a.Data {
+		m.Data[i] = fn(x)
+	}
+	return m
+}
+
+// Multiply returns the matrix product a*b.
+func Multiply(a, b *Matrix) (*Matrix, error) {
+	if a.Cols != b.Rows {
+		return nil, fmt.Errorf("cannot multiply %s and %s matrices", a.Shape(), b.Shape())
+	}
+	m := New(a.Rows, b.Cols)
+	for i := 0; i < a.Rows; i++ {
+		for j := 0; j < b.Cols; j++ {
+			sum := 0.0
+			for k := 0; k < a.Cols; k++ {
+				sum += a.At(i, k) * b.At(k, j)
+			}
+			m.Data[i*m.Cols+j] = sum
+		}
+	}
+	return m, nil
+}
+
+func Transpose(a *Matrix) *Matrix {
+	m := New(a.Cols, a.Rows)
+	for i := 0; i < a.Rows; i++ {
+		for j := 0; j < a.Cols; j++ {
+			m.Data[j*m.Cols+i] = a.At(i, j)
+		}
+	}
+	return m
+}
+
+// Dot returns the scalar product of two vectors of equal length, in any
+// orientation.
+func Dot(a, b *Matrix) (float64, error) {
+	if !a.IsVector() || !b.IsVector() || len(a.Data) != len(b.Data) {
+		return 0, fmt.Errorf("cannot take the dot product of %s and %s matrices", a.Shape(), b.Shape())
+	}
+	sum := 0.0
+	for i, x := range a.Data {
+		sum += x * b.Data[i]
+	}
+	return sum, nil
+}
+
+// decompose runs Gaussian elimination with partial pivoting on a copy of the
+// square matrix and applies the same row operations to rhs, if given. It
+// returns the determinant.
+func decompose(a, rhs *Matrix) (float64, error) {
+	if a.Rows != a.Cols {
+		return 0, fmt.Errorf("%s matrix is not square", a.Shape())
+	}
+	n := a.Rows
+	m := a.Clone()
+	det := 1.0
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(m.At(row, col)) > math.Abs(m.At(pivot, col)) {
+				pivot = row
+			}
+		}
+		if m.At(pivot, col) == 0 {
+			return 0, nil
+		}
+		if pivot != col {
+			swapRows(m, pivot, col)
+			if rhs != nil {
+				swapRows(rhs, pivot, col)
+			}
+			det = -det
+		}
+		p := m.At(col, col)
+		det *= p
+		for k := col; k < n; k++ {
+			m.Data[col*n+k] /= p
+		}
+		if rhs != nil {
+			for k := 0; k < rhs.Cols; k++ {
+				rhs.Data[col*rhs.Cols+k] /= p
+			}
+		}
+		for row := 0; row < n; row++ {
+			f := m.At(row, col)
+			if row == col || f == 0 {
+				continue
+			}
+			for k := col; k < n; k++ {
+				m.Data[row*n+k] -= f * m.At(col, k)
+			}
+			if rhs != nil {
+				for k := 0; k < rhs.Cols; k++ {
+					rhs.Data[row*rhs.Cols+k] -= f * rhs.At(col, k)
+				}
+			}
+		}
+	}
+	return det, nil
+}
+
+func swapRows(m *Matrix, i, j int) {
+	for k := 0; k < m.Cols; k++ {
+		m.Data[i*m.Cols+k], m.Data[j*m.Cols+k] = m.Data[j*m.Cols+k], m.Data[i*m.Cols+k]
+	}
+}
+
+func Det(a *Matrix) (float64, error) {
+	return decompose(a, nil)
+}
+
+func Inverse(a *Matrix) (*Matrix, error) {
+	if a.Rows != a.Cols {
+		return nil, fmt.Errorf("%s matrix is not square", a.Shape())
+	}
+	inverse := New(a.Rows, a.Cols)
+	for i := 0; i < a.Rows; i++ {
+		inverse.Data[i*a.Cols+i] = 1
+	}
+	det, err := decompose(a, inverse)
+	if err != nil {
+		return nil, err
+	}
+	if det == 0 {
+		return nil, ErrSingular
+	}
+	return inverse, nil
+}
+
+// Equal reports whether the matrices have the same shape and their elements
+// differ by at most tolerance relative to the larger magnitude.
+func Equal(a, b *Matrix, tolerance float64) bool {
+	if a.Rows != b.Rows || a.Cols != b.Cols {
+		return false
+	}
+	for i, x := range a.Data {
+		if math.Abs(x-b.Data[i]) > tolerance*math.Max(1, math.Max(math.Abs(x), math.Abs(b.Data[i]))) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package matrix
+
+import (
+	"errors"
+	"testing"
+)
+
+func mustRows(t *testing.T, rows [][]float64) *Matrix {
+	t.Helper()
+	m, err := FromRows(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestFromRows(t *testing.T) {
+	m := mustRows(t, [][]float64{{1, 2}, {3, 4}})
+	if m.Rows != 2 || m.Cols != 2 || m.At(1, 0) != 3 {
+		t.Errorf("unexpected matrix %+v", m)
+	}
+	if _, err := FromRows([][]float64{{1, 2}, {3}}); err == nil {
+		t.Errorf("expected ragged rows to be rejected")
+	}
+	if _, err := FromRows(nil); err == nil {
+		t.Errorf("expected an empty matrix to be rejected")
+	}
+}
+
+func TestString(t *testing.T) {
+	if s := mustRows(t, [][]float64{{1, 2}, {3, 4.5}}).String(); s != "[[1,2],[3,4.5]]" {
+		t.Errorf("unexpected %s", s)
+	}
+	if s := mustRows(t, [][]float64{{5}, {6}}).String(); s != "[5,6]" {
+		t.Errorf("unexpected %s", s)
+	}
+	if s := mustRows(t, [][]float64{{5, 6}}).String(); s != "[[5,6]]" {
+		t.Errorf("unexpected %s", s)
+	}
+}
+
+func TestMultiply(t *testing.T) {
+	a := mustRows(t, [][]float64{{1, 2}, {3, 4}})
+	v := mustRows(t, [][]float64{{5}, {6}})
+	m, err := Multiply(a, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(m, mustRows(t, [][]float64{{17}, {39}}), 0) {
+		t.Errorf("unexpected product %v", m)
+	}
+	if _, err := Multiply(v, v); err == nil || err.Error() != "cannot multiply 2x1 and 2x1 matrices" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestTransposeDot(t *testing.T) {
+	a := mustRows(t, [][]float64{{1, 2, 3}, {4, 5, 6}})
+	if !Equal(Transpose(a), mustRows(t, [][]float64{{1, 4}, {2, 5}, {3, 6}}), 0) {
+		t.Errorf("unexpected transpose %v", Transpose(a))
+	}
+	v := mustRows(t, [][]float64{{1}, {2}, {3}})
+	if d, err := Dot(v, Transpose(v)); err != nil || d != 14 {
+		t.Errorf("unexpected dot %v %v", d, err)
+	}
+	if _, err := Dot(v, a); err == nil {
+		t.Errorf("expected dot of a matrix to fail")
+	}
+}
+
+func TestDetInverse(t *testing.T) {
+	a := mustRows(t, [][]float64{{4, 7}, {2, 6}})
+	if d, err := Det(a); err != nil || d != 10 {
+		t.Errorf("unexpected det %v %v", d, err)
+	}
+	inv, err := Inverse(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(inv, mustRows(t, [][]float64{{0.6, -0.7}, {-0.2, 0.4}}), 1e-12) {
+		t.Errorf("unexpected inverse %v", inv)
+	}
+	identity, _ := Multiply(a, inv)
+	if !Equal(identity, mustRows(t, [][]float64{{1, 0}, {0, 1}}), 1e-12) {
+		t.Errorf("a*inv(a) = %v", identity)
+	}
+	singular := mustRows(t, [][]float64{{1, 2}, {2, 4}})
+	if d, _ := Det(singular); d != 0 {
+		t.Errorf("expected det 0, got %v", d)
+	}
+	if _, err := Inverse(singular); !errors.Is(err, ErrSingular) {
+		t.Errorf("expected ErrSingular, got %v", err)
+	}
+	if _, err := Det(mustRows(t, [][]float64{{1, 2}})); err == nil {
+		t.Errorf("expected a non-square det to fail")
+	}
+	p := mustRows(t, [][]float64{{0, 1}, {1, 0}})
+	if d, _ := Det(p); d != -1 {
+		t.Errorf("expected pivoting to flip the sign, got %v", d)
+	}
+}
+
+func TestSliceStack(t *testing.T) {
+	a := mustRows(t, [][]float64{{1, 2}, {3, 4}, {5, 6}})
+	top, bottom := a.Slice(0, 1), a.Slice(1, 3)
+	stacked, err := Stack(top, bottom)
+	if err != nil || !Equal(stacked, a, 0) {
+		t.Errorf("unexpected stack %v %v", stacked, err)
+	}
+	if _, err := Stack(top, Transpose(a)); err == nil {
+		t.Errorf("expected mismatched stack to fail")
+	}
+}
@@ -0,0 +1,30 @@
+package ops
+
+import (
+	"math"
+	"sort"
+)
+
+// constants are the named numbers of the expression language. A parameter of
+// a user function with the same name shadows them.
+var constants = map[string]float64{
+	"pi":  math.Pi,
+	"e":   math.E,
+	"tau": 2 * math.Pi,
+	"phi": math.Phi,
+}
+
+func LookupConstant(name string) (float64, bool) {
+	value, ok := constants[name]
+	return value, ok
+}
+
+// Constants returns the names of the constants in alphabetical order.
+func Constants() []string {
+	names := make([]string, 0, len(constants))
+	for name := range constants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,40 @@
+package ops
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestLookupConstant(t *testing.T) {
+	if value, ok := LookupConstant("tau"); !ok || value != 2*math.Pi {
+		t.Errorf("LookupConstant(tau) = %v, %v", value, ok)
+	}
+	if _, ok := LookupConstant("sin"); ok {
+		t.Error("sin is not a constant")
+	}
+	if names := Constants(); !reflect.DeepEqual(names, []string{"e", "phi", "pi", "tau"}) {
+		t.Errorf("Constants() = %v", names)
+	}
+}
+
+func TestApply_Factorial(t *testing.T) {
+	tests := []struct {
+		arg      float64
+		expected float64
+		err      bool
+	}{
+		{0, 1, false},
+		{5, 120, false},
+		{20, 2432902008176640000, false},
+		{-1, 0, true},
+		{2.5, 0, true},
+		{171, 0, true},
+	}
+	for _, test := range tests {
+		result, err := Apply(FACTORIAL, test.arg)
+		if (err != nil) != test.err || result != test.expected {
+			t.Errorf("%s(%v) = %v, %v, want %v", FACTORIAL, test.arg, result, err, test.expected)
+		}
+	}
+}
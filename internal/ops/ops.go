@@ -0,0 +1,554 @@
+package ops
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+	"strings"
+
+	"Yandex_Calc_V2.0/internal/matrix"
+)
+
+type Kind int
+
+const (
+	// Infix operators are written between two operands: 1 + 2.
+	Infix Kind = iota
+	// Function operators are called with arguments in parentheses: sqrt(2).
+	Function
+	// Reduction operators apply an associative infix operator to any
+	// number of arguments at once. They have no infix syntax and are called
+	// like variadic functions: sum(1,2,3).
+	Reduction
+)
+
+type Associativity int
+
+const (
+	LeftAssociative Associativity = iota
+	RightAssociative
+)
+
+// Variadic is the arity of operations that accept any number of arguments.
+const Variadic = -1
+
+// DEFAULT_COST_MS is the operation time of operations that do not set Cost.
+const DEFAULT_COST_MS = 222
+
+// ErrUndefined is wrapped by errors of operations whose real result does not
+// exist, such as sqrt(-1). The complex result may still exist.
+var ErrUndefined = errors.New("undefined")
+
+var errDivisionByZero = errors.New("division by zero is not allowed")
+
+// FACTORIAL is the function behind the postfix ! of natural notation: 5! is
+// factorial(5).
+const FACTORIAL = "factorial"
+
+// Operation describes one operation of the expression language.
+type Operation struct {
+	Symbol string
+	Kind   Kind
+	Arity  int
+	// Precedence orders infix operators: + is 1, * is 2, ^ is 3. Comparisons
+	// and logical operators bind looser than +, so theirs are zero or
+	// negative.
+	Precedence    int
+	Associativity Associativity
+	// Cost is the default simulated operation time in milliseconds.
+	Cost  int
+	Apply func(args []float64) (float64, error)
+	// ApplyComplex implements the operation for complex operands. It is nil
+	// for operations that only work on real numbers.
+	ApplyComplex func(args []complex128) (complex128, error)
+	// ApplyMatrix implements the operation for matrix operands. Scalars are
+	// passed as 1x1 matrices. It is nil for operations on numbers only.
+	ApplyMatrix func(args []*matrix.Matrix) (*matrix.Matrix, error)
+	// Core operations are understood by every agent, including the ones
+	// that do not advertise capabilities.
+	Core bool
+	// Reduction names the reduction that folds a chain of this infix
+	// operator; for a reduction it names the infix operator it folds.
+	Reduction string
+	// Decomposable variadic operations give the same result when applied to
+	// their results over parts of the arguments, min(a,b,c) =
+	// min(min(a,b),c), so that long argument lists can be split.
+	Decomposable bool
+}
+
+type Registry struct {
+	operations map[string]*Operation
+}
+
+func New() *Registry {
+	return &Registry{operations: make(map[string]*Operation)}
+}
+
+func (r *Registry) Register(op *Operation) error {
+	if op.Symbol == "" || (op.Apply == nil && op.ApplyMatrix == nil) {
+		return errors.New("operation needs a symbol and an implementation")
+	}
+	if _, ok := r.operations[op.Symbol]; ok {
+		return fmt.Errorf("operation %s is already registered", op.Symbol)
+	}
+	if op.Kind == Infix && op.Arity != 2 {
+		return fmt.Errorf("infix operation %s must be binary", op.Symbol)
+	}
+	if op.Cost <= 0 {
+		op.Cost = DEFAULT_COST_MS
+	}
+	r.operations[op.Symbol] = op
+	return nil
+}
+
+func (r *Registry) Lookup(symbol string) (*Operation, bool) {
+	op, ok := r.operations[symbol]
+	return op, ok
+}
+
+// LookupKind returns the operation only if it is of the given kind, so that
+// a function name is never mistaken for an operator and vice versa.
+func (r *Registry) LookupKind(symbol string, kind Kind) (*Operation, bool) {
+	op, ok := r.operations[symbol]
+	if !ok || op.Kind != kind {
+		return nil, false
+	}
+	return op, true
+}
+
+// LookupFunction returns an operation that is called by name: a function or
+// a reduction.
+func (r *Registry) LookupFunction(symbol string) (*Operation, bool) {
+	op, ok := r.operations[symbol]
+	if !ok || (op.Kind != Function && op.Kind != Reduction) {
+		return nil, false
+	}
+	return op, true
+}
+
+// Symbols returns the symbols of all operations of the kind in sorted order.
+func (r *Registry) Symbols(kind Kind) []string {
+	symbols := make([]string, 0, len(r.operations))
+	for symbol, op := range r.operations {
+		if op.Kind == kind {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// Extensions returns the symbols of operations that agents have to
+// advertise, in sorted order.
+func (r *Registry) Extensions() []string {
+	symbols := make([]string, 0, len(r.operations))
+	for symbol, op := range r.operations {
+		if !op.Core {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// MatchInfix returns the longest infix operator at the start of input.
+func (r *Registry) MatchInfix(input string) (*Operation, bool) {
+	var match *Operation
+	for symbol, op := range r.operations {
+		if op.Kind == Infix && strings.HasPrefix(input, symbol) && (match == nil || len(symbol) > len(match.Symbol)) {
+			match = op
+		}
+	}
+	return match, match != nil
+}
+
+func (r *Registry) check(symbol string, n int) (*Operation, error) {
+	op, ok := r.operations[symbol]
+	if !ok {
+		return nil, fmt.Errorf("invalid operator: %s", symbol)
+	}
+	if op.Arity != Variadic && n != op.Arity {
+		noun := "arguments"
+		if op.Arity == 1 {
+			noun = "argument"
+		}
+		return nil, fmt.Errorf("operator %s expects %d %s, got %d", symbol, op.Arity, noun, n)
+	}
+	return op, nil
+}
+
+// Apply checks the arity and runs the operation.
+func (r *Registry) Apply(symbol string, args ...float64) (float64, error) {
+	op, err := r.check(symbol, len(args))
+	if err != nil {
+		return 0, err
+	}
+	if op.Apply == nil {
+		return 0, fmt.Errorf("operator %s expects matrix operands", symbol)
+	}
+	return op.Apply(args)
+}
+
+// ApplyMatrix checks the arity and runs the matrix implementation. If all
+// operands are 1x1 the real implementation is used instead, if there is one.
+func (r *Registry) ApplyMatrix(symbol string, args ...*matrix.Matrix) (*matrix.Matrix, error) {
+	op, err := r.check(symbol, len(args))
+	if err != nil {
+		return nil, err
+	}
+	scalars := make([]float64, 0, len(args))
+	for _, arg := range args {
+		if arg.IsScalar() {
+			scalars = append(scalars, arg.Data[0])
+		}
+	}
+	if len(scalars) == len(args) && op.Apply != nil {
+		result, err := op.Apply(scalars)
+		if err != nil {
+			return nil, err
+		}
+		return matrix.Scalar(result), nil
+	}
+	if op.ApplyMatrix == nil {
+		return nil, fmt.Errorf("operator %s does not support matrix operands", symbol)
+	}
+	return op.ApplyMatrix(args)
+}
+
+// ApplyComplex checks the arity and runs the complex implementation.
+func (r *Registry) ApplyComplex(symbol string, args ...complex128) (complex128, error) {
+	op, err := r.check(symbol, len(args))
+	if err != nil {
+		return 0, err
+	}
+	if op.ApplyComplex == nil {
+		return 0, fmt.Errorf("operator %s does not support complex operands", symbol)
+	}
+	return op.ApplyComplex(args)
+}
+
+var Default = newDefault()
+
+func Register(op *Operation) error {
+	return Default.Register(op)
+}
+
+func Lookup(symbol string) (*Operation, bool) {
+	return Default.Lookup(symbol)
+}
+
+func LookupKind(symbol string, kind Kind) (*Operation, bool) {
+	return Default.LookupKind(symbol, kind)
+}
+
+func LookupFunction(symbol string) (*Operation, bool) {
+	return Default.LookupFunction(symbol)
+}
+
+func Apply(symbol string, args ...float64) (float64, error) {
+	return Default.Apply(symbol, args...)
+}
+
+func ApplyComplex(symbol string, args ...complex128) (complex128, error) {
+	return Default.ApplyComplex(symbol, args...)
+}
+
+func ApplyMatrix(symbol string, args ...*matrix.Matrix) (*matrix.Matrix, error) {
+	return Default.ApplyMatrix(symbol, args...)
+}
+
+func binary(fn func(x, y float64) (float64, error)) func(args []float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		return fn(args[0], args[1])
+	}
+}
+
+func complexBinary(fn func(x, y complex128) (complex128, error)) func(args []complex128) (complex128, error) {
+	return func(args []complex128) (complex128, error) {
+		return fn(args[0], args[1])
+	}
+}
+
+func defined(name string, arg, result float64) (float64, error) {
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, fmt.Errorf("%s is %w at %v", name, ErrUndefined, arg)
+	}
+	return result, nil
+}
+
+func complexDefined(name string, arg, result complex128) (complex128, error) {
+	if cmplx.IsNaN(result) || cmplx.IsInf(result) {
+		return 0, fmt.Errorf("%s is %w at %v", name, ErrUndefined, arg)
+	}
+	return result, nil
+}
+
+func function(name string, fn func(float64) float64, complexFn func(complex128) complex128) *Operation {
+	return &Operation{
+		Symbol: name,
+		Kind:   Function,
+		Arity:  1,
+		Apply: func(args []float64) (float64, error) {
+			return defined(name, args[0], fn(args[0]))
+		},
+		ApplyComplex: func(args []complex128) (complex128, error) {
+			return complexDefined(name, args[0], complexFn(args[0]))
+		},
+	}
+}
+
+func matrixBinary(fn func(a, b *matrix.Matrix) (*matrix.Matrix, error)) func(args []*matrix.Matrix) (*matrix.Matrix, error) {
+	return func(args []*matrix.Matrix) (*matrix.Matrix, error) {
+		return fn(args[0], args[1])
+	}
+}
+
+func matrixFunction(name string, arity int, fn func(args []*matrix.Matrix) (*matrix.Matrix, error)) *Operation {
+	return &Operation{Symbol: name, Kind: Function, Arity: arity, ApplyMatrix: fn}
+}
+
+// matrixProduct multiplies matrices, or scales one by a 1x1 operand.
+func matrixProduct(a, b *matrix.Matrix) (*matrix.Matrix, error) {
+	if a.IsScalar() {
+		a, b = b, a
+	}
+	if b.IsScalar() {
+		k := b.Data[0]
+		return matrix.Map(a, func(x float64) float64 { return x * k }), nil
+	}
+	return matrix.Multiply(a, b)
+}
+
+func matrixQuotient(a, b *matrix.Matrix) (*matrix.Matrix, error) {
+	if !b.IsScalar() {
+		return nil, fmt.Errorf("cannot divide by a %s matrix", b.Shape())
+	}
+	k := b.Data[0]
+	if k == 0 {
+		return nil, errDivisionByZero
+	}
+	return matrix.Map(a, func(x float64) float64 { return x / k }), nil
+}
+
+// aggregate describes a statistical function of one or more arguments.
+// cost is the operation time per argument.
+func aggregate(name string, cost int, decomposable bool, fn func(args []float64) float64) *Operation {
+	return &Operation{
+		Symbol:       name,
+		Kind:         Function,
+		Arity:        Variadic,
+		Cost:         cost,
+		Decomposable: decomposable,
+		Apply: func(args []float64) (float64, error) {
+			if len(args) == 0 {
+				return 0, fmt.Errorf("%s expects at least one argument", name)
+			}
+			return fn(args), nil
+		},
+	}
+}
+
+func sum(args []float64) float64 {
+	result := 0.0
+	for _, arg := range args {
+		result += arg
+	}
+	return result
+}
+
+func mean(args []float64) float64 {
+	return sum(args) / float64(len(args))
+}
+
+// variance is the population variance, computed around the mean to keep
+// the precision of values far from zero.
+func variance(args []float64) float64 {
+	m := mean(args)
+	result := 0.0
+	for _, arg := range args {
+		result += (arg - m) * (arg - m)
+	}
+	return result / float64(len(args))
+}
+
+func median(args []float64) float64 {
+	sorted := append([]float64(nil), args...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
+
+func truth(x float64) float64 {
+	if x != 0 {
+		return 1
+	}
+	return 0
+}
+
+// comparison describes an infix operator that gives 1 if the comparison
+// holds and 0 otherwise.
+func comparison(symbol string, fn func(x, y float64) bool) *Operation {
+	return &Operation{
+		Symbol:     symbol,
+		Kind:       Infix,
+		Arity:      2,
+		Precedence: 0,
+		Cost:       100,
+		Apply: binary(func(x, y float64) (float64, error) {
+			if fn(x, y) {
+				return 1, nil
+			}
+			return 0, nil
+		}),
+	}
+}
+
+// complexReal lifts a function that always has a real result.
+func complexReal(fn func(complex128) float64) func(complex128) complex128 {
+	return func(z complex128) complex128 {
+		return complex(fn(z), 0)
+	}
+}
+
+func newDefault() *Registry {
+	r := New()
+	operations := []*Operation{
+		{Symbol: "+", Kind: Infix, Arity: 2, Precedence: 1, Cost: 200, Core: true, Reduction: "sum",
+			Apply:        binary(func(x, y float64) (float64, error) { return x + y, nil }),
+			ApplyComplex: complexBinary(func(x, y complex128) (complex128, error) { return x + y, nil }),
+			ApplyMatrix: matrixBinary(func(a, b *matrix.Matrix) (*matrix.Matrix, error) {
+				return matrix.Elementwise(a, b, "add", func(x, y float64) float64 { return x + y })
+			})},
+		{Symbol: "-", Kind: Infix, Arity: 2, Precedence: 1, Cost: 152, Core: true,
+			Apply:        binary(func(x, y float64) (float64, error) { return x - y, nil }),
+			ApplyComplex: complexBinary(func(x, y complex128) (complex128, error) { return x - y, nil }),
+			ApplyMatrix: matrixBinary(func(a, b *matrix.Matrix) (*matrix.Matrix, error) {
+				return matrix.Elementwise(a, b, "subtract", func(x, y float64) float64 { return x - y })
+			})},
+		{Symbol: "*", Kind: Infix, Arity: 2, Precedence: 2, Cost: 228, Core: true, Reduction: "prod",
+			Apply:        binary(func(x, y float64) (float64, error) { return x * y, nil }),
+			ApplyComplex: complexBinary(func(x, y complex128) (complex128, error) { return x * y, nil }),
+			ApplyMatrix:  matrixBinary(matrixProduct)},
+		{Symbol: "/", Kind: Infix, Arity: 2, Precedence: 2, Cost: 300, Core: true,
+			Apply: binary(func(x, y float64) (float64, error) {
+				if y == 0 {
+					return 0, errDivisionByZero
+				}
+				return x / y, nil
+			}),
+			ApplyComplex: complexBinary(func(x, y complex128) (complex128, error) {
+				if y == 0 {
+					return 0, errDivisionByZero
+				}
+				return x / y, nil
+			}),
+			ApplyMatrix: matrixBinary(matrixQuotient)},
+		{Symbol: "^", Kind: Infix, Arity: 2, Precedence: 3, Associativity: RightAssociative, Cost: 250,
+			Apply: binary(func(x, y float64) (float64, error) {
+				return defined("^", x, math.Pow(x, y))
+			}),
+			ApplyComplex: complexBinary(func(x, y complex128) (complex128, error) {
+				if x == 0 && real(y) <= 0 {
+					return 0, fmt.Errorf("^ is %w at %v", ErrUndefined, x)
+				}
+				return complexDefined("^", x, cmplx.Pow(x, y))
+			})},
+		{Symbol: "sum", Kind: Reduction, Arity: Variadic, Reduction: "+", Decomposable: true,
+			Apply: func(args []float64) (float64, error) {
+				return sum(args), nil
+			}},
+		{Symbol: "prod", Kind: Reduction, Arity: Variadic, Reduction: "*", Decomposable: true,
+			Apply: func(args []float64) (float64, error) {
+				result := 1.0
+				for _, arg := range args {
+					result *= arg
+				}
+				return result, nil
+			}},
+		aggregate("min", 50, true, func(args []float64) float64 {
+			result := args[0]
+			for _, arg := range args[1:] {
+				result = math.Min(result, arg)
+			}
+			return result
+		}),
+		aggregate("max", 50, true, func(args []float64) float64 {
+			result := args[0]
+			for _, arg := range args[1:] {
+				result = math.Max(result, arg)
+			}
+			return result
+		}),
+		aggregate("avg", 50, false, mean),
+		aggregate("median", 100, false, median),
+		aggregate("var", 100, false, variance),
+		aggregate("stddev", 100, false, func(args []float64) float64 {
+			return math.Sqrt(variance(args))
+		}),
+		comparison("<", func(x, y float64) bool { return x < y }),
+		comparison("<=", func(x, y float64) bool { return x <= y }),
+		comparison(">", func(x, y float64) bool { return x > y }),
+		comparison(">=", func(x, y float64) bool { return x >= y }),
+		comparison("==", func(x, y float64) bool { return x == y }),
+		comparison("!=", func(x, y float64) bool { return x != y }),
+		// && and || short-circuit: the orchestrator evaluates them itself
+		// and never sends them to agents.
+		{Symbol: "&&", Kind: Infix, Arity: 2, Precedence: -1, Cost: 100, Core: true,
+			Apply: binary(func(x, y float64) (float64, error) { return truth(x) * truth(y), nil })},
+		{Symbol: "||", Kind: Infix, Arity: 2, Precedence: -2, Cost: 100, Core: true,
+			Apply: binary(func(x, y float64) (float64, error) { return math.Max(truth(x), truth(y)), nil })},
+		{Symbol: "!", Kind: Function, Arity: 1, Cost: 100,
+			Apply: func(args []float64) (float64, error) { return 1 - truth(args[0]), nil }},
+		{Symbol: FACTORIAL, Kind: Function, Arity: 1, Cost: 150,
+			Apply: func(args []float64) (float64, error) {
+				x := args[0]
+				if x < 0 || x != math.Trunc(x) {
+					return 0, fmt.Errorf("%s is defined for non-negative integers, got %v", FACTORIAL, x)
+				}
+				return defined(FACTORIAL, x, math.Round(math.Gamma(x+1)))
+			}},
+		function("sin", math.Sin, cmplx.Sin),
+		function("cos", math.Cos, cmplx.Cos),
+		function("tan", math.Tan, cmplx.Tan),
+		function("arcsin", math.Asin, cmplx.Asin),
+		function("arccos", math.Acos, cmplx.Acos),
+		function("arctan", math.Atan, cmplx.Atan),
+		function("ln", math.Log, cmplx.Log),
+		function("sqrt", math.Sqrt, cmplx.Sqrt),
+		function("abs", math.Abs, complexReal(cmplx.Abs)),
+		function("arg", func(x float64) float64 {
+			if x < 0 {
+				return math.Pi
+			}
+			return 0
+		}, complexReal(cmplx.Phase)),
+		function("conj", func(x float64) float64 { return x }, cmplx.Conj),
+		function("re", func(x float64) float64 { return x }, complexReal(func(z complex128) float64 { return real(z) })),
+		function("im", func(x float64) float64 { return 0 }, complexReal(func(z complex128) float64 { return imag(z) })),
+		matrixFunction("transpose", 1, func(args []*matrix.Matrix) (*matrix.Matrix, error) {
+			return matrix.Transpose(args[0]), nil
+		}),
+		matrixFunction("det", 1, func(args []*matrix.Matrix) (*matrix.Matrix, error) {
+			det, err := matrix.Det(args[0])
+			return matrix.Scalar(det), err
+		}),
+		matrixFunction("inv", 1, func(args []*matrix.Matrix) (*matrix.Matrix, error) {
+			return matrix.Inverse(args[0])
+		}),
+		matrixFunction("dot", 2, func(args []*matrix.Matrix) (*matrix.Matrix, error) {
+			dot, err := matrix.Dot(args[0], args[1])
+			return matrix.Scalar(dot), err
+		}),
+	}
+	for _, op := range operations {
+		if err := r.Register(op); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
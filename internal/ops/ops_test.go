@@ -0,0 +1,214 @@
+package ops
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+	"reflect"
+	"testing"
+
+	"Yandex_Calc_V2.0/internal/matrix"
+)
+
+func TestDefault_Apply(t *testing.T) {
+	tests := []struct {
+		symbol   string
+		args     []float64
+		expected float64
+		err      string
+	}{
+		{"+", []float64{1, 2}, 3, ""},
+		{"-", []float64{5, 3}, 2, ""},
+		{"*", []float64{4, 3}, 12, ""},
+		{"/", []float64{10, 2}, 5, ""},
+		{"/", []float64{10, 0}, 0, "division by zero is not allowed"},
+		{"sum", []float64{1, 2, 3, 4}, 10, ""},
+		{"prod", []float64{1, 2, 3, 4}, 24, ""},
+		{"sqrt", []float64{16}, 4, ""},
+		{"sqrt", []float64{-1}, 0, "sqrt is undefined at -1"},
+		{"sqrt", []float64{1, 2}, 0, "operator sqrt expects 1 argument, got 2"},
+		{"+", []float64{1, 2, 3}, 0, "operator + expects 2 arguments, got 3"},
+		{"^", []float64{2, 10}, 1024, ""},
+		{"^", []float64{-8, 0.5}, 0, "^ is undefined at -8"},
+		{"abs", []float64{-3}, 3, ""},
+		{"arg", []float64{-3}, math.Pi, ""},
+		{"im", []float64{-3}, 0, ""},
+		{"%", []float64{1, 2}, 0, "invalid operator: %"},
+		{"min", []float64{3, -1, 2}, -1, ""},
+		{"max", []float64{3, -1, 2}, 3, ""},
+		{"avg", []float64{1, 2, 3, 4}, 2.5, ""},
+		{"median", []float64{5, 1, 3}, 3, ""},
+		{"median", []float64{4, 1, 3, 2}, 2.5, ""},
+		{"var", []float64{2, 4, 4, 4, 5, 5, 7, 9}, 4, ""},
+		{"stddev", []float64{2, 4, 4, 4, 5, 5, 7, 9}, 2, ""},
+		{"stddev", []float64{7}, 0, ""},
+		{"min", nil, 0, "min expects at least one argument"},
+		{"<", []float64{1, 2}, 1, ""},
+		{">=", []float64{1, 2}, 0, ""},
+		{"==", []float64{2, 2}, 1, ""},
+		{"!=", []float64{2, 2}, 0, ""},
+		{"&&", []float64{2, -1}, 1, ""},
+		{"&&", []float64{2, 0}, 0, ""},
+		{"||", []float64{0, 0.5}, 1, ""},
+		{"!", []float64{3}, 0, ""},
+		{"!", []float64{0}, 1, ""},
+	}
+	for _, tt := range tests {
+		result, err := Apply(tt.symbol, tt.args...)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s%v: expected error %q, got %v", tt.symbol, tt.args, tt.err, err)
+			}
+			continue
+		}
+		if err != nil || result != tt.expected {
+			t.Errorf("%s%v: expected %v, got %v (%v)", tt.symbol, tt.args, tt.expected, result, err)
+		}
+	}
+}
+
+func TestDefault_Describe(t *testing.T) {
+	plus, ok := LookupKind("+", Infix)
+	if !ok || plus.Precedence != 1 || !plus.Core || plus.Reduction != "sum" {
+		t.Errorf("unexpected + %+v", plus)
+	}
+	if _, ok := LookupKind("sqrt", Infix); ok {
+		t.Error("sqrt must not be an infix operator")
+	}
+	expected := []string{"!", "!=", "<", "<=", "==", ">", ">=", "^", "abs", "arccos", "arcsin", "arctan", "arg", "avg", "conj", "cos", "det", "dot", "factorial", "im", "inv", "ln", "max", "median", "min", "prod", "re", "sin", "sqrt", "stddev", "sum", "tan", "transpose", "var"}
+	if extensions := Default.Extensions(); !reflect.DeepEqual(extensions, expected) {
+		t.Errorf("expected extensions %v, got %v", expected, extensions)
+	}
+	if functions := Default.Symbols(Function); len(functions) != 25 {
+		t.Errorf("expected 25 functions, got %v", functions)
+	}
+	for _, symbol := range []string{"sum", "min", "sqrt"} {
+		if _, ok := LookupFunction(symbol); !ok {
+			t.Errorf("%s must be callable", symbol)
+		}
+	}
+	if _, ok := LookupFunction("+"); ok {
+		t.Error("+ must not be callable")
+	}
+	if min, _ := Lookup("min"); !min.Decomposable || min.Arity != Variadic {
+		t.Errorf("unexpected min %+v", min)
+	}
+	if median, _ := Lookup("median"); median.Decomposable {
+		t.Error("median must not be decomposable")
+	}
+}
+
+func TestRegistry_Register(t *testing.T) {
+	r := New()
+	pow := &Operation{
+		Symbol:        "**",
+		Kind:          Infix,
+		Arity:         2,
+		Precedence:    3,
+		Associativity: RightAssociative,
+		Apply:         func(args []float64) (float64, error) { return math.Pow(args[0], args[1]), nil },
+	}
+	if err := r.Register(pow); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pow.Cost != DEFAULT_COST_MS {
+		t.Errorf("expected default cost, got %d", pow.Cost)
+	}
+	if err := r.Register(pow); err == nil {
+		t.Error("expected an error for a duplicate symbol")
+	}
+	if err := r.Register(&Operation{Symbol: "*", Kind: Infix, Arity: 2, Apply: pow.Apply}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.Register(&Operation{Symbol: "neg", Kind: Infix, Arity: 1, Apply: pow.Apply}); err == nil {
+		t.Error("expected an error for a unary infix operator")
+	}
+	if op, ok := r.MatchInfix("**2"); !ok || op.Symbol != "**" {
+		t.Errorf("expected the longest match **, got %v", op)
+	}
+	if op, ok := r.MatchInfix("*2"); !ok || op.Symbol != "*" {
+		t.Errorf("expected *, got %v", op)
+	}
+	if _, ok := r.MatchInfix("2"); ok {
+		t.Error("expected no match")
+	}
+}
+
+func TestDefault_ApplyComplex(t *testing.T) {
+	tests := []struct {
+		symbol   string
+		args     []complex128
+		expected complex128
+		err      string
+	}{
+		{"+", []complex128{3 + 4i, 1 - 1i}, 4 + 3i, ""},
+		{"*", []complex128{1i, 1i}, -1, ""},
+		{"/", []complex128{3 + 4i, 0}, 0, "division by zero is not allowed"},
+		{"sqrt", []complex128{-1}, 1i, ""},
+		{"abs", []complex128{3 + 4i}, 5, ""},
+		{"arg", []complex128{1i}, math.Pi / 2, ""},
+		{"conj", []complex128{3 + 4i}, 3 - 4i, ""},
+		{"re", []complex128{3 + 4i}, 3, ""},
+		{"im", []complex128{3 + 4i}, 4, ""},
+		{"^", []complex128{0, -1}, 0, "^ is undefined at (0+0i)"},
+		{"sum", []complex128{1, 2}, 0, "operator sum does not support complex operands"},
+	}
+	for _, tt := range tests {
+		result, err := ApplyComplex(tt.symbol, tt.args...)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s%v: expected error %q, got %v", tt.symbol, tt.args, tt.err, err)
+			}
+			continue
+		}
+		if err != nil || cmplx.Abs(result-tt.expected) > 1e-12 {
+			t.Errorf("%s%v: expected %v, got %v (%v)", tt.symbol, tt.args, tt.expected, result, err)
+		}
+	}
+	if result, err := ApplyComplex("^", 1i, 2); err != nil || cmplx.Abs(result+1) > 1e-12 {
+		t.Errorf("expected i^2 = -1, got %v (%v)", result, err)
+	}
+	if _, err := Apply("sqrt", -1); !errors.Is(err, ErrUndefined) {
+		t.Errorf("expected ErrUndefined, got %v", err)
+	}
+}
+
+func TestDefault_ApplyMatrix(t *testing.T) {
+	a := &matrix.Matrix{Rows: 2, Cols: 2, Data: []float64{1, 2, 3, 4}}
+	v := &matrix.Matrix{Rows: 2, Cols: 1, Data: []float64{5, 6}}
+	tests := []struct {
+		symbol   string
+		args     []*matrix.Matrix
+		expected *matrix.Matrix
+		err      string
+	}{
+		{"*", []*matrix.Matrix{a, v}, &matrix.Matrix{Rows: 2, Cols: 1, Data: []float64{17, 39}}, ""},
+		{"*", []*matrix.Matrix{matrix.Scalar(2), v}, &matrix.Matrix{Rows: 2, Cols: 1, Data: []float64{10, 12}}, ""},
+		{"/", []*matrix.Matrix{v, matrix.Scalar(2)}, &matrix.Matrix{Rows: 2, Cols: 1, Data: []float64{2.5, 3}}, ""},
+		{"/", []*matrix.Matrix{v, matrix.Scalar(0)}, nil, "division by zero is not allowed"},
+		{"/", []*matrix.Matrix{v, a}, nil, "cannot divide by a 2x2 matrix"},
+		{"+", []*matrix.Matrix{a, a}, &matrix.Matrix{Rows: 2, Cols: 2, Data: []float64{2, 4, 6, 8}}, ""},
+		{"-", []*matrix.Matrix{a, v}, nil, "cannot subtract 2x2 and 2x1 matrices"},
+		{"det", []*matrix.Matrix{a}, matrix.Scalar(-2), ""},
+		{"dot", []*matrix.Matrix{v, v}, matrix.Scalar(61), ""},
+		{"transpose", []*matrix.Matrix{v}, &matrix.Matrix{Rows: 1, Cols: 2, Data: []float64{5, 6}}, ""},
+		{"sqrt", []*matrix.Matrix{matrix.Scalar(16)}, matrix.Scalar(4), ""},
+		{"sqrt", []*matrix.Matrix{a}, nil, "operator sqrt does not support matrix operands"},
+		{"^", []*matrix.Matrix{a, matrix.Scalar(2)}, nil, "operator ^ does not support matrix operands"},
+	}
+	for _, tt := range tests {
+		result, err := ApplyMatrix(tt.symbol, tt.args...)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s%v: expected error %q, got %v", tt.symbol, tt.args, tt.err, err)
+			}
+			continue
+		}
+		if err != nil || !matrix.Equal(result, tt.expected, 0) {
+			t.Errorf("%s%v: expected %v, got %v (%v)", tt.symbol, tt.args, tt.expected, result, err)
+		}
+	}
+	if _, err := Apply("det", 2); err == nil || err.Error() != "operator det expects matrix operands" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -139,3 +139,48 @@ func (q *Queue) PopBack() interface{} {
 	q.lazyShrink()
 	return v
 }
+
+func (q *Queue) RemoveIf(pred func(interface{}) bool) int {
+	removed := 0
+	n := q.length
+	for i := 0; i < n; i++ {
+		v := q.PopFront()
+		if pred(v) {
+			removed++
+			continue
+		}
+		q.PushBack(v)
+	}
+	return removed
+}
+
+// RemoveFirst removes and returns the first element matching pred, keeping
+// the order of the others. Only the elements in front of the match move.
+func (q *Queue) RemoveFirst(pred func(interface{}) bool) interface{} {
+	j := q.front
+	for i := 0; i < q.length; i++ {
+		if v := q.rep[j]; pred(v) {
+			for k := j; k != q.front; k = q.dec(k) {
+				q.rep[k] = q.rep[q.dec(k)]
+			}
+			q.rep[q.front] = nil
+			q.front = q.inc(q.front)
+			q.length--
+			q.lazyShrink()
+			return v
+		}
+		j = q.inc(j)
+	}
+	return nil
+}
+
+// Each calls fn for the elements from front to back until fn returns false.
+func (q *Queue) Each(fn func(interface{}) bool) {
+	j := q.front
+	for i := 0; i < q.length; i++ {
+		if !fn(q.rep[j]) {
+			return
+		}
+		j = q.inc(j)
+	}
+}
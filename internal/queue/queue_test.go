@@ -333,3 +333,104 @@ func TestString(t *testing.T) {
 		t.Errorf("Expected string %q, got %q", expectedString, actualString)
 	}
 }
+
+func TestRemoveIf(t *testing.T) {
+	q := New()
+	for i := 1; i <= 6; i++ {
+		q.PushBack(i)
+	}
+
+	removed := q.RemoveIf(func(v interface{}) bool {
+		return v.(int)%2 == 0
+	})
+	if removed != 3 {
+		t.Errorf("Expected 3 removed elements, got %d", removed)
+	}
+
+	expectedString := "[1 3 5]"
+	actualString := q.String()
+	if actualString != expectedString {
+		t.Errorf("Expected string %q, got %q", expectedString, actualString)
+	}
+
+	removed = q.RemoveIf(func(v interface{}) bool { return false })
+	if removed != 0 {
+		t.Errorf("Expected 0 removed elements, got %d", removed)
+	}
+	if q.Len() != 3 {
+		t.Errorf("Expected length 3, got %d", q.Len())
+	}
+}
+
+func TestRemoveFirst(t *testing.T) {
+	q := New()
+	for i := 1; i <= 5; i++ {
+		q.PushBack(i)
+	}
+
+	found := q.RemoveFirst(func(v interface{}) bool {
+		return v.(int) > 2
+	})
+	if found != 3 {
+		t.Errorf("Expected 3, got %v", found)
+	}
+
+	expectedString := "[1 2 4 5]"
+	actualString := q.String()
+	if actualString != expectedString {
+		t.Errorf("Expected string %q, got %q", expectedString, actualString)
+	}
+
+	found = q.RemoveFirst(func(v interface{}) bool { return false })
+	if found != nil {
+		t.Errorf("Expected nil, got %v", found)
+	}
+	if q.Len() != 4 {
+		t.Errorf("Expected length 4, got %d", q.Len())
+	}
+}
+
+func TestRemoveFirst_Wrapped(t *testing.T) {
+	q := New()
+	for i := 1; i <= 8; i++ {
+		q.PushBack(i)
+	}
+	for i := 0; i < 5; i++ {
+		q.PopFront()
+	}
+	for i := 9; i <= 12; i++ {
+		q.PushBack(i)
+	}
+
+	found := q.RemoveFirst(func(v interface{}) bool {
+		return v.(int)%5 == 0
+	})
+	if found != 10 {
+		t.Errorf("Expected 10, got %v", found)
+	}
+	expectedString := "[6 7 8 9 11 12]"
+	if actualString := q.String(); actualString != expectedString {
+		t.Errorf("Expected string %q, got %q", expectedString, actualString)
+	}
+	if front := q.PopFront(); front != 6 {
+		t.Errorf("Expected front 6, got %v", front)
+	}
+}
+
+func TestEach(t *testing.T) {
+	q := New()
+	for i := 1; i <= 5; i++ {
+		q.PushBack(i)
+	}
+	var seen []int
+	q.Each(func(v interface{}) bool {
+		seen = append(seen, v.(int))
+		return v.(int) < 3
+	})
+	if len(seen) != 3 || seen[0] != 1 || seen[2] != 3 {
+		t.Errorf("Expected [1 2 3], got %v", seen)
+	}
+	if q.Len() != 5 {
+		t.Errorf("Expected length 5, got %d", q.Len())
+	}
+}
@@ -0,0 +1,157 @@
+package units
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Base lists the SI base units in the order of Dimension exponents.
+var Base = [7]string{"kg", "m", "s", "A", "K", "mol", "cd"}
+
+// Dimension holds the exponents of the SI base units. The zero value is
+// dimensionless.
+type Dimension [7]int
+
+// Unit is a named unit: one of it equals Scale in the SI base units of its
+// dimension.
+type Unit struct {
+	Name      string
+	Scale     float64
+	Dimension Dimension
+}
+
+var (
+	mass        = Dimension{1, 0, 0, 0, 0, 0, 0}
+	length      = Dimension{0, 1, 0, 0, 0, 0, 0}
+	duration    = Dimension{0, 0, 1, 0, 0, 0, 0}
+	current     = Dimension{0, 0, 0, 1, 0, 0, 0}
+	temperature = Dimension{0, 0, 0, 0, 1, 0, 0}
+	amount      = Dimension{0, 0, 0, 0, 0, 1, 0}
+	intensity   = Dimension{0, 0, 0, 0, 0, 0, 1}
+	force       = Dimension{1, 1, -2, 0, 0, 0, 0}
+	energy      = Dimension{1, 2, -2, 0, 0, 0, 0}
+	power       = Dimension{1, 2, -3, 0, 0, 0, 0}
+)
+
+var table = map[string]Unit{}
+
+func init() {
+	for _, unit := range []Unit{
+		{"kg", 1, mass},
+		{"g", 1e-3, mass},
+		{"mg", 1e-6, mass},
+		{"m", 1, length},
+		{"km", 1e3, length},
+		{"cm", 1e-2, length},
+		{"mm", 1e-3, length},
+		{"s", 1, duration},
+		{"ms", 1e-3, duration},
+		{"min", 60, duration},
+		{"h", 3600, duration},
+		{"A", 1, current},
+		{"K", 1, temperature},
+		{"mol", 1, amount},
+		{"cd", 1, intensity},
+		{"N", 1, force},
+		{"J", 1, energy},
+		{"W", 1, power},
+		{"Pa", 1, force.Div(length.Pow(2))},
+		{"Hz", 1, duration.Pow(-1)},
+		{"C", 1, current.Mul(duration)},
+		{"V", 1, power.Div(current)},
+		{"L", 1e-3, length.Pow(3)},
+	} {
+		table[unit.Name] = unit
+	}
+}
+
+func Lookup(name string) (Unit, bool) {
+	unit, ok := table[name]
+	return unit, ok
+}
+
+// Scaled converts value units raised to exponent into SI base units. The
+// parser and eval both use it so that they agree on the converted value.
+func (u Unit) Scaled(value float64, exponent int) float64 {
+	return value * math.Pow(u.Scale, float64(exponent))
+}
+
+func (d Dimension) Mul(other Dimension) Dimension {
+	for i := range d {
+		d[i] += other[i]
+	}
+	return d
+}
+
+func (d Dimension) Div(other Dimension) Dimension {
+	for i := range d {
+		d[i] -= other[i]
+	}
+	return d
+}
+
+func (d Dimension) Pow(n int) Dimension {
+	for i := range d {
+		d[i] *= n
+	}
+	return d
+}
+
+// Root returns the dimension whose n-th power is d, if exponents allow it.
+func (d Dimension) Root(n int) (Dimension, bool) {
+	for i := range d {
+		if d[i]%n != 0 {
+			return d, false
+		}
+		d[i] /= n
+	}
+	return d, true
+}
+
+func (d Dimension) Dimensionless() bool {
+	return d == Dimension{}
+}
+
+// String renders the dimension in base units, positive exponents first:
+// kg*m/s^2, m^2, 1/s. Dimensionless is the empty string.
+func (d Dimension) String() string {
+	var numerator, denominator []string
+	for i, exponent := range d {
+		switch {
+		case exponent > 0:
+			numerator = append(numerator, withExponent(Base[i], exponent))
+		case exponent < 0:
+			denominator = append(denominator, withExponent(Base[i], -exponent))
+		}
+	}
+	if len(denominator) == 0 {
+		return strings.Join(numerator, "*")
+	}
+	if len(numerator) == 0 {
+		numerator = []string{"1"}
+	}
+	return strings.Join(numerator, "*") + "/" + strings.Join(denominator, "/")
+}
+
+// Format renders a value with the dimension as an expression the parser
+// reads back to the same quantity, such as 5kg*m/s^2 or 3/s.
+func (d Dimension) Format(value float64) string {
+	number := strconv.FormatFloat(value, 'f', -1, 64)
+	s := d.String()
+	if s == "" {
+		return number
+	}
+	if strings.HasPrefix(s, "1/") {
+		return number + s[1:]
+	}
+	return number + s
+}
+
+func withExponent(unit string, exponent int) string {
+	if exponent == 1 {
+		return unit
+	}
+	return fmt.Sprintf("%s^%d", unit, exponent)
+}
@@ -0,0 +1,68 @@
+package units
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	km, ok := Lookup("km")
+	if !ok || km.Scale != 1000 || km.Dimension != length {
+		t.Errorf("unexpected km %+v", km)
+	}
+	if _, ok := Lookup("in"); ok {
+		t.Error("in must not be a unit")
+	}
+	newton, _ := Lookup("N")
+	if newton.Dimension.String() != "kg*m/s^2" {
+		t.Errorf("unexpected N %s", newton.Dimension)
+	}
+}
+
+func TestDimension_String(t *testing.T) {
+	tests := []struct {
+		dimension Dimension
+		expected  string
+	}{
+		{Dimension{}, ""},
+		{length, "m"},
+		{length.Div(duration), "m/s"},
+		{length.Pow(2), "m^2"},
+		{duration.Pow(-1), "1/s"},
+		{power.Div(current), "kg*m^2/s^3/A"},
+		{mass.Mul(length).Div(duration.Pow(2)), "kg*m/s^2"},
+	}
+	for _, tt := range tests {
+		if got := tt.dimension.String(); got != tt.expected {
+			t.Errorf("%v: expected %q, got %q", tt.dimension, tt.expected, got)
+		}
+	}
+}
+
+func TestDimension_Root(t *testing.T) {
+	if d, ok := length.Pow(2).Root(2); !ok || d != length {
+		t.Errorf("sqrt(m^2) = %v %v", d, ok)
+	}
+	if _, ok := length.Root(2); ok {
+		t.Error("sqrt(m) has no integer dimension")
+	}
+}
+
+func TestDimension_Format(t *testing.T) {
+	if s := force.Format(5); s != "5kg*m/s^2" {
+		t.Errorf("unexpected %s", s)
+	}
+	if s := duration.Pow(-1).Format(3); s != "3/s" {
+		t.Errorf("unexpected %s", s)
+	}
+	if s := (Dimension{}).Format(2.5); s != "2.5" {
+		t.Errorf("unexpected %s", s)
+	}
+}
+
+func TestUnit_Scaled(t *testing.T) {
+	km, _ := Lookup("km")
+	if v := km.Scaled(2, 2); v != 2e6 {
+		t.Errorf("2km^2 = %v", v)
+	}
+	if v := km.Scaled(3, -1); v != 0.003 {
+		t.Errorf("3/km = %v", v)
+	}
+}